@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"example.com/gourmetkan/internal/db"
+	"example.com/gourmetkan/internal/geocode"
+)
+
+// runCommand handles maintenance subcommands. They only need DATABASE_PATH, so
+// they can run before the OAuth settings are configured.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "import-addresses":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s import-addresses <file.csv>", os.Args[0])
+		}
+		return importAddresses(args[1])
+	case "seed-bases":
+		return seedBases(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func openDatabase() (*sql.DB, error) {
+	database, err := sql.Open("sqlite3", databaseDSN(envOrDefault("DATABASE_PATH", "./data/app.db")))
+	if err != nil {
+		return nil, fmt.Errorf("db open: %w", err)
+	}
+	if err := db.EnsureSchema(database); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return database, nil
+}
+
+// importAddresses loads an "address,latitude,longitude" CSV into the offline geocoder.
+func importAddresses(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	database, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	count, err := geocode.NewOffline(database).Import(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d addresses\n", count)
+	return nil
+}
@@ -4,17 +4,41 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"example.com/gourmetkan/internal/routing"
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
 )
 
 type config struct {
-	ListenAddr         string
-	DatabasePath       string
-	BaseURL            string
-	GitHubClientID     string
-	GitHubClientSecret string
-	CookieSecure       bool
-	SessionTTL         time.Duration
+	ListenAddr          string
+	DatabasePath        string
+	BaseURL             string
+	GitHubClientID      string
+	GitHubClientSecret  string
+	CookieSecure        bool
+	SessionTTL          time.Duration
+	MapsURLAllowlist    []string
+	Geocoders           []string
+	NominatimURL        string
+	GeocoderUserAgent   string
+	GeocoderCountries   string
+	RoutingProvider     string
+	RoutingURL          string
+	RoutingCyclingURL   string
+	RoutingAPIKey       string
+	RoutingDetourFactor float64
+	TileDir             string
+	TileUpstreamURL     string
+	TileCacheDir        string
+	TileCacheMaxBytes   int64
+	TileAttribution     string
+	TileUserAgent       string
+	AdminGitHubIDs      []string
+	PrivateMode         bool
+	Ranking             services.RankingConfig
 }
 
 func loadConfig() (config, error) {
@@ -25,6 +49,29 @@ func loadConfig() (config, error) {
 		CookieSecure: envBool("COOKIE_SECURE", false),
 		SessionTTL:   14 * 24 * time.Hour,
 	}
+	cfg.MapsURLAllowlist = envList("MAPS_URL_ALLOWLIST", util.DefaultMapsURLAllowlist)
+	cfg.Geocoders = envList("GEOCODER", []string{"offline"})
+	cfg.NominatimURL = envOrDefault("NOMINATIM_URL", "https://nominatim.openstreetmap.org")
+	cfg.GeocoderUserAgent = envOrDefault("GEOCODER_USER_AGENT", "gourmetkan (+"+cfg.BaseURL+")")
+	cfg.GeocoderCountries = envOrDefault("GEOCODER_COUNTRY_CODES", "jp")
+	cfg.RoutingProvider = os.Getenv("ROUTING_PROVIDER")
+	cfg.RoutingURL = envOrDefault("ROUTING_URL", "http://localhost:5000")
+	cfg.RoutingCyclingURL = os.Getenv("ROUTING_CYCLING_URL")
+	cfg.RoutingAPIKey = os.Getenv("ROUTING_API_KEY")
+	cfg.RoutingDetourFactor = envFloat("ROUTING_DETOUR_FACTOR", routing.DefaultDetourFactor)
+	cfg.TileDir = os.Getenv("TILE_DIR")
+	cfg.TileUpstreamURL = envOrDefault("TILE_UPSTREAM_URL", "https://tile.openstreetmap.org/{z}/{x}/{y}.png")
+	cfg.TileCacheDir = envOrDefault("TILE_CACHE_DIR", "./data/tiles")
+	cfg.TileCacheMaxBytes = int64(envFloat("TILE_CACHE_MAX_MB", 256) * (1 << 20))
+	cfg.TileAttribution = envOrDefault("TILE_ATTRIBUTION", "© OpenStreetMap contributors")
+	cfg.TileUserAgent = envOrDefault("TILE_USER_AGENT", "gourmetkan (+"+cfg.BaseURL+")")
+	cfg.AdminGitHubIDs = envList("ADMIN_GITHUB_IDS", nil)
+	cfg.PrivateMode = envBool("PRIVATE_MODE", false)
+	cfg.Ranking = services.RankingConfig{
+		PriorRating: envFloat("RANKING_PRIOR_RATING", services.DefaultRankingConfig.PriorRating),
+		PriorWeight: envFloat("RANKING_PRIOR_WEIGHT", services.DefaultRankingConfig.PriorWeight),
+		HalfLife:    time.Duration(envFloat("RANKING_HALF_LIFE_DAYS", 0) * float64(24*time.Hour)),
+	}
 	cfg.GitHubClientID = os.Getenv("GITHUB_CLIENT_ID")
 	cfg.GitHubClientSecret = os.Getenv("GITHUB_CLIENT_SECRET")
 
@@ -41,6 +88,32 @@ func envOrDefault(key, fallback string) string {
 	return fallback
 }
 
+func envList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func envBool(key string, fallback bool) bool {
 	value := os.Getenv(key)
 	if value == "" {
@@ -7,8 +7,10 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	_ "github.com/mattn/go-sqlite3"
 
@@ -16,15 +18,24 @@ import (
 	"example.com/gourmetkan/internal/db"
 	"example.com/gourmetkan/internal/handlers"
 	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/tiles"
+	"example.com/gourmetkan/internal/util"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
 
-	database, err := sql.Open("sqlite3", cfg.DatabasePath)
+	database, err := sql.Open("sqlite3", databaseDSN(cfg.DatabasePath))
 	if err != nil {
 		log.Fatalf("db open: %v", err)
 	}
@@ -33,7 +44,11 @@ func main() {
 	if err := db.EnsureSchema(database); err != nil {
 		log.Fatalf("schema: %v", err)
 	}
-	if err := db.EnsureBaseSeed(database); err != nil {
+	seeds, err := loadBaseSeeds()
+	if err != nil {
+		log.Fatalf("base seeds: %v", err)
+	}
+	if err := db.EnsureBaseSeed(database, seeds); err != nil {
 		log.Fatalf("seed: %v", err)
 	}
 
@@ -46,22 +61,81 @@ func main() {
 	})
 	baseService := services.NewBaseService(database)
 	restaurantService := services.NewRestaurantService(database)
-	reviewService := services.NewReviewService(database)
+	if err := restaurantService.RefreshStats(); err != nil {
+		log.Fatalf("restaurant stats: %v", err)
+	}
+	reviewService := services.NewReviewService(database, cfg.Ranking)
+	if err := reviewService.RefreshRankings(); err != nil {
+		log.Fatalf("rankings: %v", err)
+	}
+	// Background jobs run until shutdown cancels background.
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if cfg.Ranking.HalfLife > 0 {
+		go refreshRankings(background, reviewService, rankingRefreshInterval)
+	}
 	userService := services.NewUserService(database)
+	galleryService := services.NewGalleryService(database)
+	workspaceService := services.NewWorkspaceService(database)
+	suggestionService := services.NewSuggestionService(database, services.DefaultSuggestionWeights)
+	lunchService := services.NewLunchService(database)
+	eventService := services.NewEventService(database)
+	trainService := services.NewTrainService(database)
+	markService := services.NewMarkService(database)
+	collectionService := services.NewCollectionService(database)
+	checkinService := services.NewCheckinService(database)
+	notificationService := services.NewNotificationService(database)
+	mapLinkService := services.NewMapLinkService(database, util.NewSafeFetcher(cfg.MapsURLAllowlist, 2*time.Second))
+	geocoder, err := newGeocoder(cfg, database)
+	if err != nil {
+		log.Fatalf("geocoder: %v", err)
+	}
+	routeProvider, err := newRouteProvider(cfg)
+	if err != nil {
+		log.Fatalf("routing: %v", err)
+	}
+	travelTimeService := services.NewTravelTimeService(database, routeProvider)
+	tileSource := tiles.NewSource(tiles.Config{
+		Dir:           cfg.TileDir,
+		UpstreamURL:   cfg.TileUpstreamURL,
+		CacheDir:      cfg.TileCacheDir,
+		CacheMaxBytes: cfg.TileCacheMaxBytes,
+		UserAgent:     cfg.TileUserAgent,
+	})
 
 	router := handlers.NewRouter(
 		handlers.Config{
-			BaseURL:      cfg.BaseURL,
-			CookieSecure: cfg.CookieSecure,
-			SessionTTL:   cfg.SessionTTL,
+			BaseURL:        cfg.BaseURL,
+			CookieSecure:   cfg.CookieSecure,
+			SessionTTL:     cfg.SessionTTL,
+			MapAttribution: cfg.TileAttribution,
+			AdminGitHubIDs: cfg.AdminGitHubIDs,
+			PrivateMode:    cfg.PrivateMode,
+		},
+		handlers.Services{
+			Auth:         authService,
+			Base:         baseService,
+			Restaurant:   restaurantService,
+			Review:       reviewService,
+			User:         userService,
+			Gallery:      galleryService,
+			MapLink:      mapLinkService,
+			Geocoder:     geocoder,
+			TravelTime:   travelTimeService,
+			Tiles:        tileSource,
+			Workspace:    workspaceService,
+			Suggestion:   suggestionService,
+			Lunch:        lunchService,
+			Event:        eventService,
+			Train:        trainService,
+			Mark:         markService,
+			Collection:   collectionService,
+			Checkin:      checkinService,
+			Notification: notificationService,
+			DB:           database,
 		},
-		authService,
-		baseService,
-		restaurantService,
-		reviewService,
-		userService,
-		database,
 	)
+	go router.CloseLunches(background)
 
 	server := &http.Server{
 		Addr:              cfg.ListenAddr,
@@ -79,6 +153,7 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -86,3 +161,36 @@ func main() {
 		log.Printf("shutdown error: %v", err)
 	}
 }
+
+// databaseDSN turns on foreign keys for every pooled connection; the PRAGMA in
+// the schema only reaches the connection that applied it, and deletes rely on
+// ON DELETE CASCADE.
+func databaseDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_foreign_keys=on"
+}
+
+// rankingRefreshInterval is how often decayed rankings are recomputed. Review
+// writes only refresh their own restaurant, so without this the recency
+// weights of untouched restaurants would stay as old as the last restart.
+const rankingRefreshInterval = time.Hour
+
+// refreshRankings recomputes every ranking each interval until ctx is done.
+// A failed refresh keeps the previous scores until the next.
+func refreshRankings(ctx context.Context, reviewService *services.ReviewService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := reviewService.RefreshRankings(); err != nil {
+			log.Printf("refresh rankings: %v", err)
+		}
+	}
+}
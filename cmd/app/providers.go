@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"example.com/gourmetkan/internal/geocode"
+	"example.com/gourmetkan/internal/routing"
+)
+
+func newGeocoder(cfg config, database *sql.DB) (geocode.Geocoder, error) {
+	var chain geocode.Chain
+	for _, name := range cfg.Geocoders {
+		switch name {
+		case "offline":
+			chain = append(chain, geocode.NewOffline(database))
+		case "nominatim":
+			chain = append(chain, geocode.NewNominatim(geocode.NominatimConfig{
+				BaseURL:      cfg.NominatimURL,
+				UserAgent:    cfg.GeocoderUserAgent,
+				CountryCodes: cfg.GeocoderCountries,
+			}))
+		case "none":
+		default:
+			return nil, fmt.Errorf("unknown geocoder %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// routeProviderTimeout bounds one call to the routing provider. A page asks once
+// per travel mode, and both calls must leave time for the estimate within the
+// page's travel time budget.
+const routeProviderTimeout = time.Second
+
+// newRouteProvider puts the configured routing provider in front of the Haversine
+// estimate, which answers whenever the provider cannot.
+func newRouteProvider(cfg config) (routing.Router, error) {
+	var chain routing.Chain
+	switch cfg.RoutingProvider {
+	case "osrm":
+		chain = append(chain, routing.WithTimeout(routing.NewOSRM(routing.OSRMConfig{
+			BaseURL:    cfg.RoutingURL,
+			CyclingURL: cfg.RoutingCyclingURL,
+		}), routeProviderTimeout))
+	case "graphhopper":
+		chain = append(chain, routing.WithTimeout(routing.NewGraphHopper(routing.GraphHopperConfig{
+			BaseURL: cfg.RoutingURL,
+			APIKey:  cfg.RoutingAPIKey,
+		}), routeProviderTimeout))
+	case "", "none":
+	default:
+		return nil, fmt.Errorf("unknown routing provider %q", cfg.RoutingProvider)
+	}
+	return append(chain, routing.NewEstimate(cfg.RoutingDetourFactor)), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"example.com/gourmetkan/internal/db"
+)
+
+const defaultBaseSeedsFile = "./config/bases.yaml"
+
+// loadBaseSeeds reads the base seeds from BASE_SEEDS (an inline YAML or JSON
+// document) or else from BASE_SEEDS_FILE. A missing default file falls back
+// to db.DefaultBaseSeeds; a configured source must list at least one base.
+func loadBaseSeeds() ([]db.BaseSeed, error) {
+	if inline := strings.TrimSpace(os.Getenv("BASE_SEEDS")); inline != "" {
+		seeds, err := db.ParseBaseSeeds([]byte(inline), "yaml")
+		if err != nil {
+			return nil, fmt.Errorf("BASE_SEEDS: %w", err)
+		}
+		return seeds, nil
+	}
+	path := os.Getenv("BASE_SEEDS_FILE")
+	if path == "" {
+		seeds, err := db.LoadBaseSeeds(defaultBaseSeedsFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return db.DefaultBaseSeeds, nil
+		}
+		return seeds, err
+	}
+	return db.LoadBaseSeeds(path)
+}
+
+// seedBases reconciles the bases table with the configured seeds, or with the
+// file given on the command line.
+func seedBases(args []string) error {
+	flags := flag.NewFlagSet("seed-bases", flag.ContinueOnError)
+	prune := flags.Bool("prune", false, "delete seeded bases missing from the file unless they are referenced")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s seed-bases [-prune] [file]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+
+	var seeds []db.BaseSeed
+	var err error
+	if flags.NArg() == 1 {
+		seeds, err = db.LoadBaseSeeds(flags.Arg(0))
+	} else {
+		seeds, err = loadBaseSeeds()
+	}
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	result, err := db.ReconcileBaseSeeds(database, seeds, *prune)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bases: %d added, %d updated, %d removed\n", result.Added, result.Updated, result.Removed)
+	for _, name := range result.Kept {
+		fmt.Printf("kept referenced base %q\n", name)
+	}
+	return nil
+}
@@ -2,4 +2,8 @@ module example.com/gourmetkan
 
 go 1.22
 
-require github.com/mattn/go-sqlite3 v1.14.22
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -61,7 +61,9 @@ CREATE TABLE IF NOT EXISTS restaurant_photos (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     restaurant_id INTEGER NOT NULL,
     path TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
     sort_order INTEGER NOT NULL DEFAULT 0,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (restaurant_id, path),
     FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
@@ -84,6 +86,7 @@ CREATE TABLE IF NOT EXISTS review_photos (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     review_id INTEGER NOT NULL,
     path TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
     sort_order INTEGER NOT NULL DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (review_id, path),
@@ -105,6 +108,339 @@ CREATE TABLE IF NOT EXISTS oauth_states (
     expires_at DATETIME NOT NULL
 );
 
+CREATE TABLE IF NOT EXISTS map_url_expansions (
+    source_url TEXT PRIMARY KEY,
+    expanded_url TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS travel_times (
+    base_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    mode TEXT NOT NULL,
+    distance_km REAL NOT NULL,
+    duration_seconds INTEGER NOT NULL,
+    estimated INTEGER NOT NULL DEFAULT 0,
+    base_latitude REAL NOT NULL,
+    base_longitude REAL NOT NULL,
+    restaurant_latitude REAL NOT NULL,
+    restaurant_longitude REAL NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (base_id, restaurant_id, mode),
+    FOREIGN KEY (base_id) REFERENCES bases(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS geocode_addresses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    address TEXT NOT NULL,
+    normalized TEXT NOT NULL UNIQUE,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    is_public INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK(role IN ('owner', 'member')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (workspace_id, user_id),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_default_bases (
+    user_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    base_id INTEGER NOT NULL,
+    PRIMARY KEY (user_id, workspace_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (base_id) REFERENCES bases(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS workspace_invites (
+    token TEXT PRIMARY KEY,
+    workspace_id INTEGER NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token TEXT NOT NULL UNIQUE,
+    workspace_id INTEGER NOT NULL,
+    created_by INTEGER NOT NULL,
+    base_name TEXT NOT NULL,
+    radius_km REAL NOT NULL,
+    conditions TEXT NOT NULL DEFAULT '',
+    deadline DATETIME NOT NULL,
+    winner_restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE SET NULL,
+    closed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_candidates (
+    session_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (session_id, restaurant_id),
+    FOREIGN KEY (session_id) REFERENCES lunch_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_participants (
+    session_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, user_id),
+    FOREIGN KEY (session_id) REFERENCES lunch_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_votes (
+    session_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    value INTEGER NOT NULL CHECK(value IN (1, -1)),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, restaurant_id, user_id),
+    FOREIGN KEY (session_id) REFERENCES lunch_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME,
+    budget_per_person INTEGER,
+    note TEXT NOT NULL DEFAULT '',
+    final_restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE SET NULL,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS event_candidates (
+    event_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, restaurant_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS event_votes (
+    event_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, restaurant_id, user_id),
+    FOREIGN KEY (event_id, restaurant_id) REFERENCES event_candidates(event_id, restaurant_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS event_rsvps (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('yes', 'maybe', 'no')),
+    headcount INTEGER NOT NULL DEFAULT 1,
+    comment TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cancelled_events (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME,
+    cancelled_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_trains (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    created_by INTEGER NOT NULL,
+    departs_at DATETIME NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lunch_train_riders (
+    train_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (train_id, user_id),
+    FOREIGN KEY (train_id) REFERENCES lunch_trains(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS restaurant_marks (
+    user_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('favorite', 'want_to_go')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, restaurant_id, kind),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL,
+    owner_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'workspace', 'public')),
+    share_token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+    collection_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    added_by INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, restaurant_id),
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE,
+    FOREIGN KEY (added_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS collection_collaborators (
+    collection_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, user_id),
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS checkins (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    restaurant_id INTEGER NOT NULL,
+    visited_on TEXT NOT NULL,
+    amount INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS checkin_companions (
+    checkin_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (checkin_id, user_id),
+    FOREIGN KEY (checkin_id) REFERENCES checkins(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS restaurant_stats (
+    restaurant_id INTEGER PRIMARY KEY,
+    review_count INTEGER NOT NULL DEFAULT 0,
+    average_rating REAL NOT NULL DEFAULT 0,
+    score REAL,
+    last_reviewed_at DATETIME,
+    photo_count INTEGER NOT NULL DEFAULT 0,
+    rating_1_count INTEGER NOT NULL DEFAULT 0,
+    rating_2_count INTEGER NOT NULL DEFAULT 0,
+    rating_3_count INTEGER NOT NULL DEFAULT 0,
+    rating_4_count INTEGER NOT NULL DEFAULT 0,
+    rating_5_count INTEGER NOT NULL DEFAULT 0,
+    taste_average REAL,
+    taste_count INTEGER NOT NULL DEFAULT 0,
+    value_average REAL,
+    value_count INTEGER NOT NULL DEFAULT 0,
+    speed_average REAL,
+    speed_count INTEGER NOT NULL DEFAULT 0,
+    atmosphere_average REAL,
+    atmosphere_count INTEGER NOT NULL DEFAULT 0,
+    portion_average REAL,
+    portion_count INTEGER NOT NULL DEFAULT 0,
+    cover_photo_path TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS review_reactions (
+    review_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('helpful', 'like', 'love', 'yum', 'laugh', 'wow')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id, kind),
+    FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS review_replies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    review_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME,
+    FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('review_reply')),
+    review_id INTEGER NOT NULL,
+    reply_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    read_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (reply_id) REFERENCES review_replies(id) ON DELETE CASCADE
+);
+
 CREATE INDEX IF NOT EXISTS idx_users_github_id ON users(github_id);
 CREATE INDEX IF NOT EXISTS idx_restaurants_created_by ON restaurants(created_by);
 CREATE INDEX IF NOT EXISTS idx_restaurants_lat_lng ON restaurants(latitude, longitude);
@@ -118,8 +454,29 @@ CREATE INDEX IF NOT EXISTS idx_review_photos_review_id ON review_photos(review_i
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
+CREATE INDEX IF NOT EXISTS idx_geocode_addresses_lat_lng ON geocode_addresses(latitude, longitude);
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_workspace_invites_workspace_id ON workspace_invites(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_lunch_sessions_workspace_id ON lunch_sessions(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_events_workspace_starts_at ON events(workspace_id, starts_at);
+CREATE INDEX IF NOT EXISTS idx_event_rsvps_user_id ON event_rsvps(user_id);
+CREATE INDEX IF NOT EXISTS idx_lunch_trains_workspace_departs_at ON lunch_trains(workspace_id, departs_at);
+CREATE INDEX IF NOT EXISTS idx_restaurant_marks_restaurant_id ON restaurant_marks(restaurant_id);
+CREATE INDEX IF NOT EXISTS idx_collections_workspace_id ON collections(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_collection_items_restaurant_id ON collection_items(restaurant_id);
+CREATE INDEX IF NOT EXISTS idx_collection_collaborators_user_id ON collection_collaborators(user_id);
+CREATE INDEX IF NOT EXISTS idx_checkins_user_id_visited_on ON checkins(user_id, visited_on);
+CREATE INDEX IF NOT EXISTS idx_checkins_restaurant_id ON checkins(restaurant_id);
+CREATE INDEX IF NOT EXISTS idx_checkin_companions_user_id ON checkin_companions(user_id);
+CREATE INDEX IF NOT EXISTS idx_review_reactions_review_id_kind ON review_reactions(review_id, kind);
+CREATE INDEX IF NOT EXISTS idx_review_replies_review_id ON review_replies(review_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_workspace_id_read_at ON notifications(user_id, workspace_id, read_at);
 `
 
+// DefaultWorkspaceID is the public workspace that holds everything created
+// before workspaces existed, and the one base seeds go into.
+const DefaultWorkspaceID = 1
+
 func EnsureSchema(db *sql.DB) error {
 	if _, err := db.Exec(schemaSQL); err != nil {
 		return fmt.Errorf("apply schema: %w", err)
@@ -130,9 +487,42 @@ func EnsureSchema(db *sql.DB) error {
 	if err := ensureColumn(db, "reviews", "photo_path", "TEXT"); err != nil {
 		return fmt.Errorf("add reviews photo_path: %w", err)
 	}
+	if err := ensureColumn(db, "restaurant_photos", "caption", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("add restaurant_photos caption: %w", err)
+	}
+	if err := ensureColumn(db, "review_photos", "caption", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("add review_photos caption: %w", err)
+	}
+	if err := ensureColumn(db, "restaurant_photos", "uploaded_by", "INTEGER REFERENCES users(id) ON DELETE SET NULL"); err != nil {
+		return fmt.Errorf("add restaurant_photos uploaded_by: %w", err)
+	}
+	if err := ensureColumn(db, "bases", "created_by", "INTEGER REFERENCES users(id) ON DELETE SET NULL"); err != nil {
+		return fmt.Errorf("add bases created_by: %w", err)
+	}
+	if err := ensureColumn(db, "restaurants", "budget", "INTEGER"); err != nil {
+		return fmt.Errorf("add restaurants budget: %w", err)
+	}
+	if err := ensureColumn(db, "restaurants", "opening_hours", "TEXT"); err != nil {
+		return fmt.Errorf("add restaurants opening_hours: %w", err)
+	}
+	for _, dimension := range []string{"taste", "value", "speed", "atmosphere", "portion"} {
+		column := dimension + "_rating"
+		if err := ensureColumn(db, "reviews", column, "INTEGER CHECK ("+column+" BETWEEN 1 AND 5)"); err != nil {
+			return fmt.Errorf("add reviews %s: %w", column, err)
+		}
+	}
+	if err := ensureWorkspaceColumns(db); err != nil {
+		return err
+	}
 	if err := migrateLegacyPhotos(db); err != nil {
 		return fmt.Errorf("migrate legacy photos: %w", err)
 	}
+	if err := backfillPhotoUploaders(db); err != nil {
+		return fmt.Errorf("backfill photo uploaders: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_restaurant_photos_uploaded_by ON restaurant_photos(uploaded_by)"); err != nil {
+		return fmt.Errorf("index restaurant_photos uploaded_by: %w", err)
+	}
 	return nil
 }
 
@@ -166,3 +556,33 @@ func migrateLegacyPhotos(db *sql.DB) error {
 	}
 	return nil
 }
+
+// backfillPhotoUploaders attributes restaurant photos stored before uploaded_by
+// existed to the member who registered the restaurant.
+func backfillPhotoUploaders(db *sql.DB) error {
+	_, err := db.Exec(`
+        UPDATE restaurant_photos
+        SET uploaded_by = (SELECT created_by FROM restaurants WHERE restaurants.id = restaurant_photos.restaurant_id)
+        WHERE uploaded_by IS NULL
+    `)
+	return err
+}
+
+// ensureWorkspaceColumns creates the default public workspace and scopes bases
+// and restaurants to it. Tags and reviews follow the workspace of their
+// restaurant. The column default keeps existing rows in the default workspace.
+func ensureWorkspaceColumns(db *sql.DB) error {
+	if _, err := db.Exec("INSERT OR IGNORE INTO workspaces (id, name, is_public) VALUES (?, '共有', 1)", DefaultWorkspaceID); err != nil {
+		return fmt.Errorf("create default workspace: %w", err)
+	}
+	definition := fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", DefaultWorkspaceID)
+	for _, table := range []string{"bases", "restaurants"} {
+		if err := ensureColumn(db, table, "workspace_id", definition); err != nil {
+			return fmt.Errorf("add %s workspace_id: %w", table, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_workspace_id ON %s(workspace_id)", table, table)); err != nil {
+			return fmt.Errorf("index %s workspace_id: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -1,25 +1,132 @@
 package db
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
-type baseSeed struct {
-	Name      string
-	Latitude  float64
-	Longitude float64
+// BaseSeed is one base listed in the seed file.
+type BaseSeed struct {
+	Name      string  `json:"name" yaml:"name" toml:"name"`
+	Latitude  float64 `json:"latitude" yaml:"latitude" toml:"latitude"`
+	Longitude float64 `json:"longitude" yaml:"longitude" toml:"longitude"`
+}
+
+// baseSeedFile is the document layout shared by every format, e.g. in YAML:
+//
+//	bases:
+//	  - name: 本部
+//	    latitude: 34.810888
+//	    longitude: 135.561172
+type baseSeedFile struct {
+	Bases []BaseSeed `json:"bases" yaml:"bases" toml:"bases"`
 }
 
-var defaultBases = []baseSeed{
+// DefaultBaseSeeds are the bases seeded when no seed file is configured and
+// config/bases.yaml is missing, so the app never starts without a base.
+var DefaultBaseSeeds = []BaseSeed{
 	{Name: "立命館大学 OIC（大阪いばらきキャンパス）", Latitude: 34.810888, Longitude: 135.561172},
 	{Name: "立命館大学 BKC（びわこ・くさつキャンパス）", Latitude: 34.982189, Longitude: 135.96272},
 	{Name: "立命館大学 衣笠キャンパス（KIC）", Latitude: 35.0325428, Longitude: 135.7240146},
 }
 
-func EnsureBaseSeed(db *sql.DB) error {
+// SeedResult counts what ReconcileBaseSeeds changed.
+type SeedResult struct {
+	Added   int
+	Updated int
+	Removed int
+	// Kept lists bases missing from the seeds that were not removed because
+	// they are still referenced.
+	Kept []string
+}
+
+// LoadBaseSeeds reads seeds from a .yaml/.yml, .json or .toml file.
+func LoadBaseSeeds(path string) ([]BaseSeed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read base seeds: %w", err)
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	seeds, err := ParseBaseSeeds(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return seeds, nil
+}
+
+// ParseBaseSeeds decodes seeds in the given format ("yaml", "yml", "json" or
+// "toml") and validates them.
+func ParseBaseSeeds(data []byte, format string) ([]BaseSeed, error) {
+	var file baseSeedFile
+	switch format {
+	case "yaml", "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("parse base seeds: %w", err)
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("parse base seeds: %w", err)
+		}
+	case "toml":
+		meta, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, fmt.Errorf("parse base seeds: %w", err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("parse base seeds: unknown key %s", undecoded[0])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported base seed format %q", format)
+	}
+	if err := validateBaseSeeds(file.Bases); err != nil {
+		return nil, err
+	}
+	return file.Bases, nil
+}
+
+func validateBaseSeeds(seeds []BaseSeed) error {
+	if len(seeds) == 0 {
+		return fmt.Errorf("base seeds: no bases listed")
+	}
+	seen := make(map[string]bool, len(seeds))
+	for i := range seeds {
+		seeds[i].Name = strings.TrimSpace(seeds[i].Name)
+		seed := seeds[i]
+		if seed.Name == "" || len([]rune(seed.Name)) > 100 {
+			return fmt.Errorf("base seed %d: name must be 1-100 characters", i+1)
+		}
+		if seen[seed.Name] {
+			return fmt.Errorf("base seed %q: duplicate name", seed.Name)
+		}
+		seen[seed.Name] = true
+		if seed.Latitude < -90 || seed.Latitude > 90 || seed.Longitude < -180 || seed.Longitude > 180 {
+			return fmt.Errorf("base seed %q: coordinates out of range", seed.Name)
+		}
+	}
+	return nil
+}
+
+// EnsureBaseSeed inserts the seeds into the default workspace on first start,
+// when it has no bases yet. Pages need a base, so seeds must not be empty.
+func EnsureBaseSeed(db *sql.DB, seeds []BaseSeed) error {
+	if len(seeds) == 0 {
+		return fmt.Errorf("seed bases: no bases to seed")
+	}
 	var count int
-	if err := db.QueryRow("SELECT COUNT(*) FROM bases").Scan(&count); err != nil {
+	if err := db.QueryRow("SELECT COUNT(*) FROM bases WHERE workspace_id = ?", DefaultWorkspaceID).Scan(&count); err != nil {
 		return fmt.Errorf("count bases: %w", err)
 	}
 	if count > 0 {
@@ -32,14 +139,14 @@ func EnsureBaseSeed(db *sql.DB) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT INTO bases (name, latitude, longitude) VALUES (?, ?, ?)")
+	stmt, err := tx.Prepare("INSERT INTO bases (name, latitude, longitude, workspace_id) VALUES (?, ?, ?, ?)")
 	if err != nil {
 		return fmt.Errorf("prepare seed: %w", err)
 	}
 	defer stmt.Close()
 
-	for _, base := range defaultBases {
-		if _, err := stmt.Exec(base.Name, base.Latitude, base.Longitude); err != nil {
+	for _, base := range seeds {
+		if _, err := stmt.Exec(base.Name, base.Latitude, base.Longitude, DefaultWorkspaceID); err != nil {
 			return fmt.Errorf("seed base %s: %w", base.Name, err)
 		}
 	}
@@ -49,3 +156,105 @@ func EnsureBaseSeed(db *sql.DB) error {
 	}
 	return nil
 }
+
+// ReconcileBaseSeeds brings the default workspace's bases in line with the
+// seeds, matching by name. It adds missing bases and updates coordinates that
+// changed, so running it twice is a no-op. With prune, seeded bases (no
+// creator) that are no longer listed are deleted unless something still
+// references them. Bases added by users are never touched.
+func ReconcileBaseSeeds(db *sql.DB, seeds []BaseSeed, prune bool) (SeedResult, error) {
+	var result SeedResult
+	tx, err := db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("begin seed: %w", err)
+	}
+	defer tx.Rollback()
+
+	type existingBase struct {
+		id        int
+		latitude  float64
+		longitude float64
+		seeded    bool
+	}
+	rows, err := tx.Query("SELECT id, name, latitude, longitude, created_by IS NULL FROM bases WHERE workspace_id = ?", DefaultWorkspaceID)
+	if err != nil {
+		return result, fmt.Errorf("list bases: %w", err)
+	}
+	existing := make(map[string]existingBase)
+	for rows.Next() {
+		var name string
+		var base existingBase
+		if err := rows.Scan(&base.id, &name, &base.latitude, &base.longitude, &base.seeded); err != nil {
+			rows.Close()
+			return result, fmt.Errorf("scan base: %w", err)
+		}
+		if _, dup := existing[name]; !dup {
+			existing[name] = base
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("rows base: %w", err)
+	}
+
+	listed := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		listed[seed.Name] = true
+		base, ok := existing[seed.Name]
+		if !ok {
+			if _, err := tx.Exec("INSERT INTO bases (name, latitude, longitude, workspace_id) VALUES (?, ?, ?, ?)", seed.Name, seed.Latitude, seed.Longitude, DefaultWorkspaceID); err != nil {
+				return result, fmt.Errorf("seed base %s: %w", seed.Name, err)
+			}
+			result.Added++
+			continue
+		}
+		if sameCoordinate(base.latitude, seed.Latitude) && sameCoordinate(base.longitude, seed.Longitude) {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE bases SET latitude = ?, longitude = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", seed.Latitude, seed.Longitude, base.id); err != nil {
+			return result, fmt.Errorf("update base %s: %w", seed.Name, err)
+		}
+		result.Updated++
+	}
+
+	if prune {
+		for name, base := range existing {
+			if listed[name] || !base.seeded {
+				continue
+			}
+			referenced, err := baseReferenced(tx, base.id)
+			if err != nil {
+				return result, err
+			}
+			if referenced {
+				result.Kept = append(result.Kept, name)
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM travel_times WHERE base_id = ?", base.id); err != nil {
+				return result, fmt.Errorf("delete base travel times: %w", err)
+			}
+			if _, err := tx.Exec("DELETE FROM bases WHERE id = ?", base.id); err != nil {
+				return result, fmt.Errorf("delete base %s: %w", name, err)
+			}
+			result.Removed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit seed: %w", err)
+	}
+	return result, nil
+}
+
+// baseReferenced reports whether any row other than cached data points at the base.
+func baseReferenced(tx *sql.Tx, id int) (bool, error) {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM user_default_bases WHERE base_id = ?", id).Scan(&count); err != nil {
+		return false, fmt.Errorf("count base references: %w", err)
+	}
+	return count > 0, nil
+}
+
+// sameCoordinate ignores differences below the precision the seed files use.
+func sameCoordinate(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
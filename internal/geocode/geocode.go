@@ -0,0 +1,59 @@
+// Package geocode resolves free-form addresses into coordinates and back.
+package geocode
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by ReverseGeocode when no address is known near the point.
+var ErrNotFound = errors.New("geocode: not found")
+
+// Candidate is one possible match for an address.
+type Candidate struct {
+	Label     string
+	Latitude  float64
+	Longitude float64
+}
+
+type Geocoder interface {
+	// Geocode returns candidates for the address, best match first. An empty
+	// slice with a nil error means nothing matched.
+	Geocode(ctx context.Context, address string) ([]Candidate, error)
+	// ReverseGeocode returns a human readable address for the point.
+	ReverseGeocode(ctx context.Context, latitude, longitude float64) (string, error)
+}
+
+// Chain asks each geocoder in turn and returns the first non-empty answer.
+// Errors from earlier geocoders are skipped as long as a later one answers.
+type Chain []Geocoder
+
+func (c Chain) Geocode(ctx context.Context, address string) ([]Candidate, error) {
+	var lastErr error
+	for _, geocoder := range c {
+		candidates, err := geocoder.Geocode(ctx, address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(candidates) > 0 {
+			return candidates, nil
+		}
+	}
+	return nil, lastErr
+}
+
+func (c Chain) ReverseGeocode(ctx context.Context, latitude, longitude float64) (string, error) {
+	lastErr := ErrNotFound
+	for _, geocoder := range c {
+		address, err := geocoder.ReverseGeocode(ctx, latitude, longitude)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if address != "" {
+			return address, nil
+		}
+	}
+	return "", lastErr
+}
@@ -0,0 +1,127 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nominatim talks to a Nominatim-compatible HTTP API, either the public
+// OpenStreetMap instance or a self-hosted / local stand-in server.
+type Nominatim struct {
+	baseURL      string
+	userAgent    string
+	countryCodes string
+	limit        int
+	client       *http.Client
+}
+
+type NominatimConfig struct {
+	// BaseURL is the API root, e.g. "https://nominatim.openstreetmap.org" or "http://localhost:8088".
+	BaseURL string
+	// UserAgent identifies the application as required by the Nominatim usage policy.
+	UserAgent string
+	// CountryCodes restricts results, e.g. "jp". Empty means worldwide.
+	CountryCodes string
+	Timeout      time.Duration
+}
+
+type nominatimPlace struct {
+	DisplayName string `json:"display_name"`
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+}
+
+func NewNominatim(cfg NominatimConfig) *Nominatim {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &Nominatim{
+		baseURL:      strings.TrimRight(cfg.BaseURL, "/"),
+		userAgent:    cfg.UserAgent,
+		countryCodes: cfg.CountryCodes,
+		limit:        5,
+		client:       &http.Client{Timeout: timeout},
+	}
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, address string) ([]Candidate, error) {
+	values := url.Values{}
+	values.Set("q", address)
+	values.Set("format", "jsonv2")
+	values.Set("limit", strconv.Itoa(n.limit))
+	values.Set("accept-language", "ja")
+	if n.countryCodes != "" {
+		values.Set("countrycodes", n.countryCodes)
+	}
+	var places []nominatimPlace
+	if err := n.get(ctx, "/search", values, &places); err != nil {
+		return nil, err
+	}
+	candidates := make([]Candidate, 0, len(places))
+	for _, place := range places {
+		candidate, ok := place.candidate()
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+func (n *Nominatim) ReverseGeocode(ctx context.Context, latitude, longitude float64) (string, error) {
+	values := url.Values{}
+	values.Set("lat", strconv.FormatFloat(latitude, 'f', -1, 64))
+	values.Set("lon", strconv.FormatFloat(longitude, 'f', -1, 64))
+	values.Set("format", "jsonv2")
+	values.Set("accept-language", "ja")
+	var place nominatimPlace
+	if err := n.get(ctx, "/reverse", values, &place); err != nil {
+		return "", err
+	}
+	if place.DisplayName == "" {
+		return "", ErrNotFound
+	}
+	return place.DisplayName, nil
+}
+
+func (n *Nominatim) get(ctx context.Context, path string, values url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+path+"?"+values.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if n.userAgent != "" {
+		req.Header.Set("User-Agent", n.userAgent)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("nominatim %s failed: %d %s", path, resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func (p nominatimPlace) candidate() (Candidate, bool) {
+	lat, err1 := strconv.ParseFloat(p.Lat, 64)
+	lng, err2 := strconv.ParseFloat(p.Lon, 64)
+	if err1 != nil || err2 != nil {
+		return Candidate{}, false
+	}
+	return Candidate{Label: p.DisplayName, Latitude: lat, Longitude: lng}, true
+}
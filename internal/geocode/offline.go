@@ -0,0 +1,205 @@
+package geocode
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+// Offline resolves addresses against the geocode_addresses table, which is filled
+// from an address dataset with Import. It never touches the network.
+type Offline struct {
+	db *sql.DB
+}
+
+func NewOffline(db *sql.DB) *Offline {
+	return &Offline{db: db}
+}
+
+const offlineCandidateLimit = 5
+
+// Geocode first looks for dataset entries that are a prefix of the address, so
+// "大阪府茨木市岩倉町2-150" matches a block-level "大阪府茨木市岩倉町" entry, longest
+// (most specific) first. If none match it falls back to entries containing the text.
+func (o *Offline) Geocode(ctx context.Context, address string) ([]Candidate, error) {
+	normalized := NormalizeAddress(address)
+	if normalized == "" {
+		return nil, nil
+	}
+	runes := []rune(normalized)
+	placeholders := make([]string, 0, len(runes))
+	args := make([]interface{}, 0, len(runes)+1)
+	for i := len(runes); i > 0; i-- {
+		placeholders = append(placeholders, "?")
+		args = append(args, string(runes[:i]))
+	}
+	args = append(args, offlineCandidateLimit)
+	candidates, err := o.query(ctx, `
+		SELECT address, latitude, longitude
+		FROM geocode_addresses
+		WHERE normalized IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY length(normalized) DESC
+		LIMIT ?
+	`, args...)
+	if err != nil || len(candidates) > 0 {
+		return candidates, err
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(normalized)
+	return o.query(ctx, `
+		SELECT address, latitude, longitude
+		FROM geocode_addresses
+		WHERE normalized LIKE ? ESCAPE '\'
+		ORDER BY length(normalized) ASC
+		LIMIT ?
+	`, "%"+escaped+"%", offlineCandidateLimit)
+}
+
+// ReverseGeocode returns the nearest dataset entry within 1 km.
+func (o *Offline) ReverseGeocode(ctx context.Context, latitude, longitude float64) (string, error) {
+	const radiusKm = 1.0
+	minLat, maxLat, minLng, maxLng := util.BoundingBox(latitude, longitude, radiusKm)
+	candidates, err := o.query(ctx, `
+		SELECT address, latitude, longitude
+		FROM geocode_addresses
+		WHERE latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+	`, minLat, maxLat, minLng, maxLng)
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	bestKm := radiusKm
+	for _, candidate := range candidates {
+		distance := util.HaversineDistanceKm(latitude, longitude, candidate.Latitude, candidate.Longitude)
+		if distance <= bestKm {
+			best = candidate.Label
+			bestKm = distance
+		}
+	}
+	if best == "" {
+		return "", ErrNotFound
+	}
+	return best, nil
+}
+
+// Import loads "address,latitude,longitude" CSV rows, replacing entries with the
+// same normalized address. A header row is skipped. It returns the number of rows stored.
+func (o *Offline) Import(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO geocode_addresses (address, normalized, latitude, longitude)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(normalized) DO UPDATE SET address = excluded.address, latitude = excluded.latitude, longitude = excluded.longitude
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare import: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read line %d: %w", line, err)
+		}
+		if len(record) < 3 {
+			return 0, fmt.Errorf("line %d: expected address,latitude,longitude", line)
+		}
+		address := strings.TrimSpace(record[0])
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		lng, err2 := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err1 != nil || err2 != nil {
+			if line == 1 {
+				continue
+			}
+			return 0, fmt.Errorf("line %d: invalid coordinates", line)
+		}
+		if address == "" || !util.ValidateLatitude(lat) || !util.ValidateLongitude(lng) {
+			return 0, fmt.Errorf("line %d: invalid row", line)
+		}
+		if _, err := stmt.Exec(address, NormalizeAddress(address), lat, lng); err != nil {
+			return 0, fmt.Errorf("import line %d: %w", line, err)
+		}
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit import: %w", err)
+	}
+	return count, nil
+}
+
+func (o *Offline) query(ctx context.Context, query string, args ...interface{}) ([]Candidate, error) {
+	rows, err := o.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query geocode addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []Candidate
+	for rows.Next() {
+		var candidate Candidate
+		if err := rows.Scan(&candidate.Label, &candidate.Latitude, &candidate.Longitude); err != nil {
+			return nil, fmt.Errorf("scan geocode address: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows geocode address: %w", err)
+	}
+	return candidates, nil
+}
+
+var addressReplacer = strings.NewReplacer(
+	"丁目", "-",
+	"番地", "-",
+	"番", "-",
+	"号", "",
+	"ー", "-",
+	"‐", "-",
+	"−", "-",
+	"–", "-",
+	"—", "-",
+)
+
+// NormalizeAddress folds full-width ASCII to half-width, drops whitespace and
+// unifies block/lot notation so "岩倉町２丁目１５０番" and "岩倉町2-150" compare equal.
+func NormalizeAddress(address string) string {
+	var b strings.Builder
+	for _, r := range address {
+		switch {
+		case r >= '！' && r <= '～':
+			r -= '！' - '!'
+		case r == '　':
+			r = ' '
+		}
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	normalized := addressReplacer.Replace(b.String())
+	for strings.Contains(normalized, "--") {
+		normalized = strings.ReplaceAll(normalized, "--", "-")
+	}
+	return strings.Trim(normalized, "-")
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+
+	"example.com/gourmetkan/internal/routing"
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+type apiBase struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type apiTravelTime struct {
+	DistanceKm float64 `json:"distance_km"`
+	Minutes    int     `json:"minutes"`
+	Estimated  bool    `json:"estimated"`
+}
+
+type apiRestaurant struct {
+	ID          int                   `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Address     string                `json:"address"`
+	MapsURL     string                `json:"maps_url"`
+	Latitude    float64               `json:"latitude"`
+	Longitude   float64               `json:"longitude"`
+	Tags        []string              `json:"tags"`
+	Average     float64               `json:"average_rating"`
+	ReviewCount int                   `json:"review_count"`
+	Base        apiBase               `json:"base"`
+	DistanceKm  float64               `json:"distance_km"`
+	Walking     *apiTravelTime        `json:"walking,omitempty"`
+	Cycling     *apiTravelTime        `json:"cycling,omitempty"`
+	Navigation  []util.NavigationLink `json:"navigation"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	writeJSONContentType(w, status, "application/json", value)
+}
+
+func writeJSONContentType(w http.ResponseWriter, status int, contentType string, value interface{}) {
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// RestaurantAPI serves GET /api/restaurants/{id}: the detail page data, measured
+// from the selected base, including directions links for each map app.
+func (h *Handler) RestaurantAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := extractID(strings.TrimPrefix(r.URL.Path, "/api"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	rest, err := h.restaurantService.GetRestaurant(id)
+	if err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	if rest == nil {
+		http.NotFound(w, r)
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	stats, err := h.restaurantService.StatsForRestaurants([]services.Restaurant{*rest})
+	if err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	tagRows, err := h.restaurantService.TagsForRestaurant(rest.ID)
+	if err != nil {
+		http.Error(w, "tag error", http.StatusInternalServerError)
+		return
+	}
+	tags := make([]string, 0, len(tagRows))
+	for _, tag := range tagRows {
+		tags = append(tags, tag.Name)
+	}
+
+	result := apiRestaurant{
+		ID:          rest.ID,
+		Name:        rest.Name,
+		Description: rest.Description,
+		Address:     rest.Address,
+		MapsURL:     rest.MapsURL,
+		Latitude:    rest.Latitude,
+		Longitude:   rest.Longitude,
+		Tags:        tags,
+		Average:     stats[rest.ID].Average,
+		ReviewCount: stats[rest.ID].ReviewCount,
+		Base:        apiBase{ID: base.ID, Name: base.Name, Latitude: base.Latitude, Longitude: base.Longitude},
+		DistanceKm:  util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude),
+		Navigation:  navigationLinks(base, rest),
+	}
+	travelTime := h.travelTimes(r, base, []services.Restaurant{*rest})[rest.ID]
+	result.Walking = toAPITravelTime(travelTime.Walking)
+	result.Cycling = toAPITravelTime(travelTime.Cycling)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func toAPITravelTime(route routing.Route) *apiTravelTime {
+	if !route.Found {
+		return nil
+	}
+	return &apiTravelTime{
+		DistanceKm: route.DistanceKm,
+		Minutes:    int(math.Ceil(route.Duration.Minutes())),
+		Estimated:  route.Estimated,
+	}
+}
@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -20,12 +23,17 @@ func (h *Handler) SelectBase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	if session, _ := h.getSession(r); session != nil {
+	session, _ := h.getSession(r)
+	if session != nil {
 		if !h.verifyCSRF(r, session) {
 			http.Error(w, "invalid csrf", http.StatusForbidden)
 			return
 		}
 	}
+	if r.FormValue("base_id") == currentLocationBaseValue {
+		h.selectCurrentLocation(w, r)
+		return
+	}
 	baseID, err := strconv.Atoi(r.FormValue("base_id"))
 	if err != nil {
 		http.Error(w, "invalid base", http.StatusBadRequest)
@@ -38,14 +46,7 @@ func (h *Handler) SelectBase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     baseCookieName,
-		Value:    strconv.Itoa(base.ID),
-		Path:     "/",
-		HttpOnly: false,
-		Secure:   h.cfg.CookieSecure,
-		SameSite: http.SameSiteLaxMode,
-	})
+	h.rememberBase(w, base.ID)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
@@ -78,52 +79,377 @@ func (h *Handler) CreateBase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	if session, _ := h.getSession(r); session != nil {
+	session, _ := h.getSession(r)
+	if session != nil {
 		if !h.verifyCSRF(r, session) {
 			http.Error(w, "invalid csrf", http.StatusForbidden)
 			return
 		}
 	}
 
-	name := strings.TrimSpace(r.FormValue("name"))
-	latStr := strings.TrimSpace(r.FormValue("latitude"))
-	lngStr := strings.TrimSpace(r.FormValue("longitude"))
-	mapsURL := strings.TrimSpace(r.FormValue("maps_url"))
+	form, errors := h.parseBaseForm(r)
+	if len(errors) > 0 {
+		bases, _ := h.baseService.ListBases()
+		base, _ := h.getSelectedBase(r)
+		selectedID := 0
+		if base != nil {
+			selectedID = base.ID
+		}
+		data := TemplateData{
+			Bases:          toBaseOptions(bases),
+			SelectedBaseID: selectedID,
+			CSRFToken:      csrfTokenOrEmpty(session),
+			Errors:         errors,
+		}
+		h.render(w, "bases_new.html", data)
+		return
+	}
+
+	createdBy := 0
+	if session != nil {
+		createdBy = session.UserID
+	}
+	baseID, err := h.baseService.CreateBase(services.Base{
+		Name:      form.Name,
+		Latitude:  form.latitude,
+		Longitude: form.longitude,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+
+	h.rememberBase(w, baseID)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// BaseListItem is one row of the base management page.
+type BaseListItem struct {
+	ID        int
+	Name      string
+	Latitude  float64
+	Longitude float64
+	IsDefault bool
+	CanManage bool
+}
+
+// BaseForm holds the values of the base edit form so they survive a re-render.
+type BaseForm struct {
+	ID        int
+	Name      string
+	MapsURL   string
+	Latitude  string
+	Longitude string
+
+	latitude  float64
+	longitude float64
+}
+
+func (h *Handler) ListBases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bases, err := h.baseService.ListBases()
+	if err != nil {
+		http.Error(w, "failed to load bases", http.StatusInternalServerError)
+		return
+	}
+	selected, _ := h.getSelectedBase(r)
+	session, _ := h.getSession(r)
+	var user *services.User
+	defaultBaseID := 0
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+		if defaultBaseID, err = h.baseService.DefaultBaseID(session.UserID); err != nil {
+			log.Printf("default base: %v", err)
+		}
+	}
+	items := make([]BaseListItem, 0, len(bases))
+	for i := range bases {
+		items = append(items, BaseListItem{
+			ID:        bases[i].ID,
+			Name:      bases[i].Name,
+			Latitude:  bases[i].Latitude,
+			Longitude: bases[i].Longitude,
+			IsDefault: defaultBaseID == bases[i].ID,
+			CanManage: h.canManageBase(user, &bases[i]),
+		})
+	}
+	selectedID := 0
+	if selected != nil {
+		selectedID = selected.ID
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		BaseList:       items,
+	}
+	h.render(w, "bases_index.html", data)
+}
+
+func (h *Handler) EditBase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	user, base, ok := h.managedBase(w, r, session, "/edit")
+	if !ok {
+		return
+	}
+	form := BaseForm{
+		ID:        base.ID,
+		Name:      base.Name,
+		Latitude:  strconv.FormatFloat(base.Latitude, 'f', -1, 64),
+		Longitude: strconv.FormatFloat(base.Longitude, 'f', -1, 64),
+	}
+	h.renderBaseEdit(w, r, session, user, form, nil)
+}
+
+func (h *Handler) UpdateBase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	user, base, ok := h.managedBase(w, r, session, "/update")
+	if !ok {
+		return
+	}
+
+	form, errors := h.parseBaseForm(r)
+	form.ID = base.ID
+	if len(errors) > 0 {
+		h.renderBaseEdit(w, r, session, user, form, errors)
+		return
+	}
+	if err := h.baseService.UpdateBase(services.Base{
+		ID:        base.ID,
+		Name:      form.Name,
+		Latitude:  form.latitude,
+		Longitude: form.longitude,
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "update error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/bases", http.StatusFound)
+}
+
+func (h *Handler) DeleteBase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	_, base, ok := h.managedBase(w, r, session, "/delete")
+	if !ok {
+		return
+	}
+	if err := h.baseService.DeleteBase(base.ID); err != nil {
+		h.baseChangeError(w, r, err, "delete error")
+		return
+	}
+	http.Redirect(w, r, "/bases", http.StatusFound)
+}
+
+// SetDefaultBase makes the base the viewer's default in the workspace, the one
+// picked on devices that have not selected a base here yet, and selects it.
+func (h *Handler) SetDefaultBase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/default"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.baseService.SetDefaultBase(session.UserID, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "default base error", http.StatusInternalServerError)
+		return
+	}
+	h.rememberBase(w, id)
+	http.Redirect(w, r, "/bases", http.StatusFound)
+}
+
+// MergeBase folds the base into target_id. Only the source needs to be
+// manageable by the user, since it is the one that disappears.
+func (h *Handler) MergeBase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	_, base, ok := h.managedBase(w, r, session, "/merge")
+	if !ok {
+		return
+	}
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	if err != nil || targetID == base.ID {
+		http.Error(w, "invalid base", http.StatusBadRequest)
+		return
+	}
+	if err := h.baseService.MergeBases(base.ID, targetID); err != nil {
+		h.baseChangeError(w, r, err, "merge error")
+		return
+	}
+	http.Redirect(w, r, "/bases", http.StatusFound)
+}
+
+// managedBase loads the base named in the path and checks that the user may
+// manage it, writing the error response when not.
+func (h *Handler) managedBase(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.User, *services.Base, bool) {
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, suffix))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	base, err := h.baseService.GetBaseByID(id)
+	if err != nil || base == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canManageBase(user, base) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return user, base, true
+}
+
+func (h *Handler) baseChangeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+	case errors.Is(err, services.ErrLastBase):
+		http.Error(w, "cannot remove the last base", http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) renderBaseEdit(w http.ResponseWriter, r *http.Request, session *SessionInfo, user *services.User, form BaseForm, errors map[string]string) {
+	bases, _ := h.baseService.ListBases()
+	selected, _ := h.getSelectedBase(r)
+	selectedID := 0
+	if selected != nil {
+		selectedID = selected.ID
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Errors:         errors,
+		Base:           form,
+	}
+	h.render(w, "bases_edit.html", data)
+}
+
+// parseBaseForm validates the name and location fields shared by the create and
+// edit forms. A maps URL or coordinate text wins over the latitude/longitude fields.
+func (h *Handler) parseBaseForm(r *http.Request) (BaseForm, map[string]string) {
+	form := BaseForm{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		MapsURL:   strings.TrimSpace(r.FormValue("maps_url")),
+		Latitude:  strings.TrimSpace(r.FormValue("latitude")),
+		Longitude: strings.TrimSpace(r.FormValue("longitude")),
+	}
 
 	errors := map[string]string{}
-	if !util.ValidateRequiredText(name, 1, 100) {
+	if !util.ValidateRequiredText(form.Name, 1, 100) {
 		errors["name"] = "拠点名は1〜100文字で入力してください。"
 	}
-	latProvided := latStr != ""
-	lngProvided := lngStr != ""
-	var latitude, longitude float64
+	latProvided := form.Latitude != ""
+	lngProvided := form.Longitude != ""
 	locationSet := false
 	if latProvided || lngProvided {
 		if !(latProvided && lngProvided) {
 			errors["latitude"] = "緯度経度は両方入力してください。"
 		} else {
-			lat, err1 := strconv.ParseFloat(latStr, 64)
-			lng, err2 := strconv.ParseFloat(lngStr, 64)
+			lat, err1 := strconv.ParseFloat(form.Latitude, 64)
+			lng, err2 := strconv.ParseFloat(form.Longitude, 64)
 			if err1 != nil || err2 != nil || !util.ValidateLatitude(lat) || !util.ValidateLongitude(lng) {
 				errors["latitude"] = "緯度経度が不正です。"
 			} else {
-				latitude = lat
-				longitude = lng
+				form.latitude = lat
+				form.longitude = lng
 				locationSet = true
 			}
 		}
 	}
 
-	if mapsURL != "" {
+	if form.MapsURL != "" {
 		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 		defer cancel()
-		expanded, err := util.ExpandShortURL(ctx, mapsURL)
+		mapsURL := form.MapsURL
+		expanded, err := h.mapLinkService.Expand(ctx, mapsURL)
 		if err == nil {
 			mapsURL = expanded
 		}
 		if loc, ok := util.ParseMapLocation(mapsURL); ok {
-			latitude = loc.Latitude
-			longitude = loc.Longitude
+			form.latitude = loc.Latitude
+			form.longitude = loc.Longitude
 			locationSet = true
 		}
 	}
@@ -131,35 +457,12 @@ func (h *Handler) CreateBase(w http.ResponseWriter, r *http.Request) {
 	if !locationSet {
 		errors["latitude"] = "緯度経度が取得できませんでした。"
 	}
+	return form, errors
+}
 
-	if len(errors) > 0 {
-		bases, _ := h.baseService.ListBases()
-		base, _ := h.getSelectedBase(r)
-		session, _ := h.getSession(r)
-		selectedID := 0
-		if base != nil {
-			selectedID = base.ID
-		}
-		data := TemplateData{
-			Bases:          toBaseOptions(bases),
-			SelectedBaseID: selectedID,
-			CSRFToken:      csrfTokenOrEmpty(session),
-			Errors:         errors,
-		}
-		h.render(w, "bases_new.html", data)
-		return
-	}
-
-	baseID, err := h.baseService.CreateBase(services.Base{
-		Name:      name,
-		Latitude:  latitude,
-		Longitude: longitude,
-	})
-	if err != nil {
-		http.Error(w, "create error", http.StatusInternalServerError)
-		return
-	}
-
+// rememberBase selects the base in the cookie. It does not change the
+// viewer's default base, which only SetDefaultBase does.
+func (h *Handler) rememberBase(w http.ResponseWriter, baseID int) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     baseCookieName,
 		Value:    strconv.Itoa(baseID),
@@ -168,10 +471,15 @@ func (h *Handler) CreateBase(w http.ResponseWriter, r *http.Request) {
 		Secure:   h.cfg.CookieSecure,
 		SameSite: http.SameSiteLaxMode,
 	})
-	http.Redirect(w, r, "/", http.StatusFound)
+	h.clearLocationCookie(w)
 }
 
 func (h *Handler) getSelectedBase(r *http.Request) (*services.Base, error) {
+	if cookie, err := r.Cookie(baseCookieName); err == nil && cookie.Value == currentLocationBaseValue {
+		if base, ok := currentLocationBase(r); ok {
+			return base, nil
+		}
+	}
 	bases, err := h.baseService.ListBases()
 	if err != nil {
 		return nil, err
@@ -179,15 +487,34 @@ func (h *Handler) getSelectedBase(r *http.Request) (*services.Base, error) {
 	if len(bases) == 0 {
 		return nil, nil
 	}
-	baseID := bases[0].ID
+	// The base picked on this device wins while it is in the workspace; the
+	// cookie is shared by all workspaces, so it may name another one's base.
+	// Then comes the viewer's default base here, then the first base.
 	if cookie, err := r.Cookie(baseCookieName); err == nil {
-		if parsed, err := strconv.Atoi(cookie.Value); err == nil {
-			baseID = parsed
+		if baseID, err := strconv.Atoi(cookie.Value); err == nil {
+			if base := findBase(bases, baseID); base != nil {
+				return base, nil
+			}
 		}
 	}
-	selected, err := h.baseService.GetBaseByID(baseID)
-	if err != nil || selected == nil {
-		selected = &bases[0]
+	if session, _ := h.getSession(r); session != nil {
+		defaultBaseID, err := h.baseService.DefaultBaseID(session.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if base := findBase(bases, defaultBaseID); base != nil {
+			return base, nil
+		}
+	}
+	return &bases[0], nil
+}
+
+// findBase returns the base with the ID, or nil if bases has none.
+func findBase(bases []services.Base, id int) *services.Base {
+	for i := range bases {
+		if bases[i].ID == id {
+			return &bases[i]
+		}
 	}
-	return selected, nil
+	return nil
 }
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+func (h *Handler) BaseRouter(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/bases" {
+		if r.Method == http.MethodGet {
+			h.ListBases(w, r)
+			return
+		}
+		h.CreateBase(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/edit") {
+		h.EditBase(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/update") {
+		h.UpdateBase(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/delete") {
+		h.DeleteBase(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/default") {
+		h.SetDefaultBase(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/merge") {
+		h.MergeBase(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+const (
+	// heatmapWeeks is how many weeks the history heatmap covers, ending with
+	// the current week.
+	heatmapWeeks    = 53
+	historyCheckins = 50
+	maxCheckinSpend = 1000000
+)
+
+// HistoryPage is the data of the personal dining history page.
+type HistoryPage struct {
+	Weeks []HeatmapWeek
+	// Total counts the visits shown in the heatmap.
+	Total       int
+	Restaurants []VisitSummary
+	Checkins    []CheckinView
+}
+
+// HeatmapWeek is one column of the heatmap, Sunday first. Month is set on
+// the week a month starts in.
+type HeatmapWeek struct {
+	Month string
+	Days  []HeatmapDay
+}
+
+type HeatmapDay struct {
+	Date  string
+	Count int
+	// Level is 0 for no visits up to 4 for four or more.
+	Level int
+	// Future days after today are drawn blank.
+	Future bool
+}
+
+type VisitSummary struct {
+	RestaurantID int
+	Name         string
+	Count        int
+	LastVisited  string
+	TotalAmount  int
+}
+
+type CheckinView struct {
+	ID             int
+	RestaurantID   int
+	RestaurantName string
+	Date           string
+	Amount         int
+	// RecordedBy is set when someone else checked the viewer in as a
+	// companion.
+	RecordedBy string
+	Companions []string
+	CanDelete  bool
+}
+
+// History shows the viewer's visits in the current workspace: a calendar
+// heatmap of the last year, visit counts per restaurant and recent check-ins.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	today := localDate(time.Now())
+	start := today.AddDate(0, 0, -int(today.Weekday())-(heatmapWeeks-1)*7)
+	days, err := h.checkinService.DailyVisits(session.UserID, start, today)
+	if err != nil {
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+	visits, err := h.checkinService.VisitsByRestaurant(session.UserID)
+	if err != nil {
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+	checkins, err := h.checkinService.ListCheckins(session.UserID, historyCheckins)
+	if err != nil {
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+
+	page := HistoryPage{Weeks: buildHeatmap(start, today, days)}
+	for _, count := range days {
+		page.Total += count
+	}
+	for _, visit := range visits {
+		page.Restaurants = append(page.Restaurants, VisitSummary{
+			RestaurantID: visit.RestaurantID,
+			Name:         visit.RestaurantName,
+			Count:        visit.Count,
+			LastVisited:  formatLastVisited(visit.LastVisited, time.Now()),
+			TotalAmount:  visit.TotalAmount,
+		})
+	}
+	for _, checkin := range checkins {
+		page.Checkins = append(page.Checkins, toCheckinView(checkin, session.UserID))
+	}
+
+	bases, _ := h.baseService.ListBases()
+	user, _ := h.userService.GetUserByID(session.UserID)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		History:        page,
+	}
+	h.render(w, "history.html", data)
+}
+
+// CreateCheckin records that the viewer ate at the restaurant, on the given
+// day or today, with optional companions and amount spent.
+func (h *Handler) CreateCheckin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/checkins"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	visitedOn, ok := parseVisitDate(r.FormValue("visited_on"), time.Now())
+	if !ok {
+		http.Error(w, "invalid visit date", http.StatusBadRequest)
+		return
+	}
+	amount := 0
+	if value := strings.TrimSpace(r.FormValue("amount")); value != "" {
+		amount, err = strconv.Atoi(value)
+		if err != nil || amount < 0 || amount > maxCheckinSpend {
+			http.Error(w, "invalid amount", http.StatusBadRequest)
+			return
+		}
+	}
+	users, err := h.userService.ListUsers()
+	if err != nil {
+		http.Error(w, "user error", http.StatusInternalServerError)
+		return
+	}
+	companionIDs, ok := parseCompanions(r.Form["companion_id"], users, session.UserID)
+	if !ok {
+		http.Error(w, "invalid companion", http.StatusBadRequest)
+		return
+	}
+	checkin := services.Checkin{UserID: session.UserID, RestaurantID: id, VisitedOn: visitedOn, Amount: amount}
+	if _, err := h.checkinService.CreateCheckin(checkin, companionIDs); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, localPath(r.FormValue("next"), fmt.Sprintf("/restaurants/%d", id)), http.StatusFound)
+}
+
+// DeleteCheckin deletes one of the viewer's own check-ins.
+func (h *Handler) DeleteCheckin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/delete") {
+		http.NotFound(w, r)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/delete"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.checkinService.DeleteCheckin(id, session.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "delete error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, localPath(r.FormValue("next"), "/history"), http.StatusFound)
+}
+
+// parseVisitDate reads the day of a visit; empty means today. Days after
+// today are rejected.
+func parseVisitDate(value string, now time.Time) (time.Time, bool) {
+	today := localDate(now)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return today, true
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil || day.After(today) {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// parseCompanions checks that every companion is a user of the workspace.
+// The viewer ticking themselves is ignored.
+func parseCompanions(values []string, users []services.User, viewerID int) ([]int, bool) {
+	known := make(map[int]bool, len(users))
+	for _, user := range users {
+		known[user.ID] = true
+	}
+	var ids []int
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil || !known[id] {
+			return nil, false
+		}
+		if id != viewerID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+func buildHeatmap(start, today time.Time, days map[string]int) []HeatmapWeek {
+	weeks := make([]HeatmapWeek, 0, heatmapWeeks)
+	for day := start; !day.After(today); {
+		var week HeatmapWeek
+		for i := 0; i < 7; i++ {
+			if day.Day() == 1 || (len(weeks) == 0 && i == 0) {
+				week.Month = fmt.Sprintf("%d月", day.Month())
+			}
+			date := day.Format("2006-01-02")
+			count := days[date]
+			week.Days = append(week.Days, HeatmapDay{
+				Date:   date,
+				Count:  count,
+				Level:  min(count, 4),
+				Future: day.After(today),
+			})
+			day = day.AddDate(0, 0, 1)
+		}
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+func toCheckinView(checkin services.Checkin, viewerID int) CheckinView {
+	view := CheckinView{
+		ID:             checkin.ID,
+		RestaurantID:   checkin.RestaurantID,
+		RestaurantName: checkin.RestaurantName,
+		Date:           checkin.VisitedOn.Format("2006-01-02"),
+		Amount:         checkin.Amount,
+		CanDelete:      checkin.UserID == viewerID,
+	}
+	if checkin.UserID != viewerID {
+		view.RecordedBy = checkin.Username
+		view.Amount = 0
+	}
+	for _, companion := range checkin.Companions {
+		if companion.UserID != viewerID {
+			view.Companions = append(view.Companions, companion.Username)
+		}
+	}
+	return view
+}
+
+func toCompanionOptions(users []services.User, viewerID int) []UserOption {
+	options := make([]UserOption, 0, len(users))
+	for _, user := range users {
+		if user.ID != viewerID {
+			options = append(options, UserOption{ID: user.ID, Username: user.Username})
+		}
+	}
+	return options
+}
+
+// formatLastVisited describes a visit relative to now: 今日, 昨日, "3日前"
+// within a week, else the date. Zero times give "".
+func formatLastVisited(visited, now time.Time) string {
+	if visited.IsZero() {
+		return ""
+	}
+	day := localDate(visited)
+	today := localDate(now)
+	days := int(math.Round(today.Sub(day).Hours() / 24))
+	switch {
+	case days <= 0:
+		return "今日"
+	case days == 1:
+		return "昨日"
+	case days < 7:
+		return fmt.Sprintf("%d日前", days)
+	case day.Year() == today.Year():
+		return fmt.Sprintf("%d月%d日", day.Month(), day.Day())
+	default:
+		return fmt.Sprintf("%d年%d月%d日", day.Year(), day.Month(), day.Day())
+	}
+}
+
+// localDate returns midnight local time of t's day.
+func localDate(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
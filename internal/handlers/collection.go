@@ -0,0 +1,703 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+const sharedCollectionPrefix = "/collections/shared/"
+
+// CollectionsPage is the data of the collection list.
+type CollectionsPage struct {
+	Collections []CollectionSummary
+	Form        CollectionForm
+}
+
+type CollectionSummary struct {
+	ID          int
+	Title       string
+	Description string
+	OwnerName   string
+	Visibility  string
+	ItemCount   int
+}
+
+// CollectionPage is the data of a collection, seen either in its workspace
+// or through its share link (Shared), where restaurant pages are not linked.
+type CollectionPage struct {
+	ID            int
+	Title         string
+	Description   string
+	OwnerName     string
+	Visibility    string
+	Items         []CollectionItemView
+	Collaborators []services.CollectionCollaborator
+	Shared        bool
+	GeoJSONURL    string
+	ShareURL      string
+	CanEdit       bool
+	CanManage     bool
+	// Restaurants and Users are the choices for adding items and
+	// collaborators.
+	Restaurants []RestaurantOption
+	Users       []UserOption
+	Form        CollectionForm
+}
+
+type CollectionItemView struct {
+	RestaurantID int
+	Name         string
+	Description  string
+	Address      string
+	MapsURL      string
+	Distance     string
+	Note         string
+	First        bool
+	Last         bool
+}
+
+type CollectionForm struct {
+	Title       string
+	Description string
+	Visibility  string
+}
+
+type UserOption struct {
+	ID       int
+	Username string
+}
+
+// CollectionOption is a collection the viewer can add a restaurant to.
+type CollectionOption struct {
+	ID    int
+	Title string
+}
+
+var collectionVisibilityLabels = map[string]string{
+	services.CollectionPrivate:   "自分と共同編集者のみ",
+	services.CollectionWorkspace: "ワークスペースのメンバー",
+	services.CollectionPublic:    "リンクを知っている人",
+}
+
+func (h *Handler) CollectionRouter(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/collections" && r.Method == http.MethodGet:
+		h.ListCollections(w, r)
+	case path == "/collections":
+		h.CreateCollection(w, r)
+	case strings.HasPrefix(path, sharedCollectionPrefix):
+		h.SharedCollection(w, r)
+	case strings.HasSuffix(path, ".geojson"):
+		h.CollectionGeoJSON(w, r)
+	case strings.HasSuffix(path, "/update"):
+		h.UpdateCollection(w, r)
+	case strings.HasSuffix(path, "/delete"):
+		h.DeleteCollection(w, r)
+	case strings.HasSuffix(path, "/items/note"):
+		h.UpdateCollectionItemNote(w, r)
+	case strings.HasSuffix(path, "/items/move"):
+		h.MoveCollectionItem(w, r)
+	case strings.HasSuffix(path, "/items/remove"):
+		h.RemoveCollectionItem(w, r)
+	case strings.HasSuffix(path, "/items"):
+		h.AddCollectionItem(w, r)
+	case strings.HasSuffix(path, "/collaborators/remove"):
+		h.RemoveCollectionCollaborator(w, r)
+	case strings.HasSuffix(path, "/collaborators"):
+		h.AddCollectionCollaborator(w, r)
+	default:
+		h.ShowCollection(w, r)
+	}
+}
+
+func (h *Handler) ListCollections(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.getSession(r)
+	h.renderCollections(w, r, session, CollectionForm{Visibility: services.CollectionWorkspace}, nil)
+}
+
+func (h *Handler) renderCollections(w http.ResponseWriter, r *http.Request, session *SessionInfo, form CollectionForm, errors map[string]string) {
+	viewerID := 0
+	var user interface{}
+	if session != nil {
+		viewerID = session.UserID
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	collections, err := h.collectionService.ListCollections(viewerID)
+	if err != nil {
+		http.Error(w, "collection error", http.StatusInternalServerError)
+		return
+	}
+	page := CollectionsPage{Form: form}
+	for _, collection := range collections {
+		page.Collections = append(page.Collections, CollectionSummary{
+			ID:          collection.ID,
+			Title:       collection.Title,
+			Description: collection.Description,
+			OwnerName:   collection.OwnerName,
+			Visibility:  collectionVisibilityLabels[collection.Visibility],
+			ItemCount:   collection.ItemCount,
+		})
+	}
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Errors:         errors,
+		Collection:     page,
+	}
+	h.render(w, "collections_index.html", data)
+}
+
+func (h *Handler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	form, errors := parseCollectionForm(r)
+	if len(errors) > 0 {
+		h.renderCollections(w, r, session, form, errors)
+		return
+	}
+	id, err := h.collectionService.CreateCollection(services.Collection{
+		OwnerID:     session.UserID,
+		Title:       form.Title,
+		Description: form.Description,
+		Visibility:  form.Visibility,
+	})
+	if err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", id), http.StatusFound)
+}
+
+func (h *Handler) ShowCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, _ := h.getSession(r)
+	collection, ok := h.visibleCollection(w, r, session, "")
+	if !ok {
+		return
+	}
+	h.renderCollection(w, r, session, collection, collectionFormOf(collection), nil)
+}
+
+func (h *Handler) renderCollection(w http.ResponseWriter, r *http.Request, session *SessionInfo, collection *services.CollectionDetail, form CollectionForm, errors map[string]string) {
+	var user *services.User
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	base, _ := h.getSelectedBase(r)
+	page := h.toCollectionPage(collection, base, false)
+	page.Form = form
+	page.CanEdit = h.canEditCollection(user, collection)
+	page.CanManage = h.canManageCollection(user, &collection.Collection)
+	if collection.Visibility == services.CollectionPublic {
+		page.ShareURL = strings.TrimRight(h.cfg.BaseURL, "/") + sharedCollectionPrefix + collection.ShareToken
+	}
+	if page.CanEdit {
+		included := make(map[int]bool, len(collection.Items))
+		for _, item := range collection.Items {
+			included[item.Restaurant.ID] = true
+		}
+		restaurants, _ := h.restaurantService.ListRestaurants()
+		for _, option := range toRestaurantOptions(restaurants) {
+			if !included[option.ID] {
+				page.Restaurants = append(page.Restaurants, option)
+			}
+		}
+	}
+	if page.CanManage {
+		users, _ := h.userService.ListUsers()
+		page.Users = toCollaboratorOptions(users, collection)
+	}
+
+	bases, _ := h.baseService.ListBases()
+	var viewer interface{}
+	if user != nil {
+		viewer = user
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           viewer,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Errors:         errors,
+		Collection:     page,
+	}
+	h.render(w, "collections_show.html", data)
+}
+
+// SharedCollection serves a public collection by its share link, to anyone
+// logged in or not, whichever workspace they are in. A trailing ".geojson"
+// exports it instead.
+func (h *Handler) SharedCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, sharedCollectionPrefix)
+	geoJSON := strings.HasSuffix(token, ".geojson")
+	token = strings.TrimSuffix(token, ".geojson")
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	collection, err := h.collectionService.GetSharedCollection(token)
+	if err != nil {
+		http.Error(w, "collection error", http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if geoJSON {
+		writeCollectionGeoJSON(w, collection, true)
+		return
+	}
+	session, _ := h.getSession(r)
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	base, _ := h.getSelectedBase(r)
+	bases, _ := h.baseService.ListBases()
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Collection:     h.toCollectionPage(collection, base, true),
+	}
+	h.render(w, "collections_show.html", data)
+}
+
+func (h *Handler) CollectionGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, _ := h.getSession(r)
+	collection, ok := h.visibleCollection(w, r, session, ".geojson")
+	if !ok {
+		return
+	}
+	writeCollectionGeoJSON(w, collection, false)
+}
+
+// writeCollectionGeoJSON exports the items as a FeatureCollection in the
+// collection's order. Shared exports leave out links into the workspace.
+func writeCollectionGeoJSON(w http.ResponseWriter, collection *services.CollectionDetail, shared bool) {
+	features := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0, len(collection.Items))}
+	for i, item := range collection.Items {
+		rest := item.Restaurant
+		properties := map[string]interface{}{
+			"position": i + 1,
+			"name":     rest.Name,
+			"note":     item.Note,
+			"address":  rest.Address,
+			"maps_url": rest.MapsURL,
+		}
+		if !shared {
+			properties["id"] = rest.ID
+			properties["url"] = "/restaurants/" + strconv.Itoa(rest.ID)
+		}
+		features.Features = append(features.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   newGeoJSONPoint(rest.Latitude, rest.Longitude),
+			Properties: properties,
+		})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="collection-%d.geojson"`, collection.ID))
+	writeJSONContentType(w, http.StatusOK, "application/geo+json", features)
+}
+
+func (h *Handler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	collection, ok := h.managedCollection(w, r, session, "/update")
+	if !ok {
+		return
+	}
+	form, errors := parseCollectionForm(r)
+	if len(errors) > 0 {
+		h.renderCollection(w, r, session, collection, form, errors)
+		return
+	}
+	err := h.collectionService.UpdateCollection(services.Collection{
+		ID:          collection.ID,
+		Title:       form.Title,
+		Description: form.Description,
+		Visibility:  form.Visibility,
+	})
+	if err != nil {
+		h.collectionChangeError(w, r, err, "update error")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", collection.ID), http.StatusFound)
+}
+
+func (h *Handler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	collection, ok := h.managedCollection(w, r, session, "/delete")
+	if !ok {
+		return
+	}
+	if err := h.collectionService.DeleteCollection(collection.ID); err != nil {
+		h.collectionChangeError(w, r, err, "delete error")
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusFound)
+}
+
+// AddCollectionItem adds a restaurant from the collection page or from a
+// restaurant page, which passes "next" to return to itself.
+func (h *Handler) AddCollectionItem(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/items", false, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		note := strings.TrimSpace(r.FormValue("note"))
+		if !util.ValidateOptionalText(note, 200) {
+			return errBadCollectionInput
+		}
+		return h.collectionService.AddItem(collection.ID, restaurantID, session.UserID, note)
+	})
+}
+
+func (h *Handler) UpdateCollectionItemNote(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/items/note", false, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		note := strings.TrimSpace(r.FormValue("note"))
+		if !util.ValidateOptionalText(note, 200) {
+			return errBadCollectionInput
+		}
+		return h.collectionService.UpdateItemNote(collection.ID, restaurantID, note)
+	})
+}
+
+func (h *Handler) MoveCollectionItem(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/items/move", false, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		switch r.FormValue("direction") {
+		case "up":
+			return h.collectionService.MoveItem(collection.ID, restaurantID, -1)
+		case "down":
+			return h.collectionService.MoveItem(collection.ID, restaurantID, 1)
+		default:
+			return errBadCollectionInput
+		}
+	})
+}
+
+func (h *Handler) RemoveCollectionItem(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/items/remove", false, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.collectionService.RemoveItem(collection.ID, restaurantID)
+	})
+}
+
+func (h *Handler) AddCollectionCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/collaborators", true, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		userID, err := strconv.Atoi(r.FormValue("user_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.collectionService.AddCollaborator(collection.ID, userID)
+	})
+}
+
+func (h *Handler) RemoveCollectionCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.changeCollection(w, r, "/collaborators/remove", true, func(collection *services.CollectionDetail, session *SessionInfo) error {
+		userID, err := strconv.Atoi(r.FormValue("user_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.collectionService.RemoveCollaborator(collection.ID, userID)
+	})
+}
+
+var errBadCollectionInput = fmt.Errorf("invalid collection input")
+
+// changeCollection runs change for a collaborator, or for someone who may
+// manage the collection when manage is set, then returns to the collection.
+func (h *Handler) changeCollection(w http.ResponseWriter, r *http.Request, suffix string, manage bool, change func(*services.CollectionDetail, *SessionInfo) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	var collection *services.CollectionDetail
+	if manage {
+		collection, ok = h.managedCollection(w, r, session, suffix)
+	} else {
+		collection, ok = h.editableCollection(w, r, session, suffix)
+	}
+	if !ok {
+		return
+	}
+	if err := change(collection, session); err != nil {
+		h.collectionChangeError(w, r, err, "update error")
+		return
+	}
+	http.Redirect(w, r, localPath(r.FormValue("next"), fmt.Sprintf("/collections/%d", collection.ID)), http.StatusFound)
+}
+
+func (h *Handler) collectionChangeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+	case err == errBadCollectionInput:
+		http.Error(w, "bad request", http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) visibleCollection(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.CollectionDetail, bool) {
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, suffix))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	viewerID := 0
+	if session != nil {
+		viewerID = session.UserID
+	}
+	collection, err := h.collectionService.GetCollection(id, viewerID)
+	if err != nil || collection == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return collection, true
+}
+
+func (h *Handler) editableCollection(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.CollectionDetail, bool) {
+	collection, ok := h.visibleCollection(w, r, session, suffix)
+	if !ok {
+		return nil, false
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canEditCollection(user, collection) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return collection, true
+}
+
+func (h *Handler) managedCollection(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.CollectionDetail, bool) {
+	collection, ok := h.visibleCollection(w, r, session, suffix)
+	if !ok {
+		return nil, false
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canManageCollection(user, &collection.Collection) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return collection, true
+}
+
+func (h *Handler) toCollectionPage(collection *services.CollectionDetail, base *services.Base, shared bool) CollectionPage {
+	page := CollectionPage{
+		ID:            collection.ID,
+		Title:         collection.Title,
+		Description:   collection.Description,
+		OwnerName:     collection.OwnerName,
+		Visibility:    collectionVisibilityLabels[collection.Visibility],
+		Collaborators: collection.Collaborators,
+		Shared:        shared,
+		GeoJSONURL:    fmt.Sprintf("/collections/%d.geojson", collection.ID),
+	}
+	if shared {
+		page.GeoJSONURL = sharedCollectionPrefix + collection.ShareToken + ".geojson"
+	}
+	for i, item := range collection.Items {
+		rest := item.Restaurant
+		view := CollectionItemView{
+			RestaurantID: rest.ID,
+			Name:         rest.Name,
+			Description:  rest.Description,
+			Address:      rest.Address,
+			MapsURL:      rest.MapsURL,
+			Note:         item.Note,
+			First:        i == 0,
+			Last:         i == len(collection.Items)-1,
+		}
+		if base != nil && !shared {
+			view.Distance = util.FormatDistanceKm(util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude))
+		}
+		page.Items = append(page.Items, view)
+	}
+	return page
+}
+
+// toCollaboratorOptions lists the workspace's users who could be added as
+// collaborators: not the owner and not already collaborating.
+func toCollaboratorOptions(users []services.User, collection *services.CollectionDetail) []UserOption {
+	options := make([]UserOption, 0, len(users))
+	for _, user := range users {
+		if collection.IsCollaborator(user.ID) {
+			continue
+		}
+		options = append(options, UserOption{ID: user.ID, Username: user.Username})
+	}
+	return options
+}
+
+func toCollectionOptions(collections []services.Collection) []CollectionOption {
+	options := make([]CollectionOption, 0, len(collections))
+	for _, collection := range collections {
+		options = append(options, CollectionOption{ID: collection.ID, Title: collection.Title})
+	}
+	return options
+}
+
+func collectionFormOf(collection *services.CollectionDetail) CollectionForm {
+	return CollectionForm{
+		Title:       collection.Title,
+		Description: collection.Description,
+		Visibility:  collection.Visibility,
+	}
+}
+
+func parseCollectionForm(r *http.Request) (CollectionForm, map[string]string) {
+	form := CollectionForm{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Visibility:  r.FormValue("visibility"),
+	}
+	errors := map[string]string{}
+	if !util.ValidateRequiredText(form.Title, 1, 100) {
+		errors["title"] = "タイトルは1〜100文字で入力してください。"
+	}
+	if !util.ValidateOptionalText(form.Description, 500) {
+		errors["description"] = "説明は500文字以内で入力してください。"
+	}
+	if _, ok := collectionVisibilityLabels[form.Visibility]; !ok {
+		errors["visibility"] = "公開範囲を選んでください。"
+	}
+	return form, errors
+}
+
+// AddToCollection adds the restaurant shown on a restaurant page to one of the
+// viewer's collections.
+func (h *Handler) AddToCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	restaurantID, err := extractID(strings.TrimSuffix(r.URL.Path, "/collections"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	collectionID, err := strconv.Atoi(r.FormValue("collection_id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	collection, err := h.collectionService.GetCollection(collectionID, session.UserID)
+	if err != nil || collection == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canEditCollection(user, collection) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if err := h.collectionService.AddItem(collection.ID, restaurantID, session.UserID, ""); err != nil {
+		h.collectionChangeError(w, r, err, "update error")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", collection.ID), http.StatusFound)
+}
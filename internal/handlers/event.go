@@ -0,0 +1,769 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/ical"
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	// defaultEventDuration is used in calendars when an event has no end time.
+	defaultEventDuration = 2 * time.Hour
+	maxEventHeadcount    = 20
+	eventCalendarProduct = "-//gourmetkan//events//JA"
+)
+
+var weekdayNames = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+// EventForm holds the event form as submitted.
+type EventForm struct {
+	ID            int
+	Title         string
+	Date          string
+	StartTime     string
+	EndTime       string
+	Budget        string
+	Note          string
+	RestaurantIDs map[int]bool
+
+	startsAt time.Time
+	endsAt   time.Time
+	budget   int
+}
+
+type EventsPage struct {
+	Upcoming []EventSummary
+	Past     []EventSummary
+	FeedURL  string
+}
+
+type EventSummary struct {
+	ID     int
+	Title  string
+	When   string
+	Venue  string
+	Going  int
+	Budget int
+}
+
+type EventPage struct {
+	ID           int
+	Title        string
+	When         string
+	Budget       int
+	Note         string
+	CreatorName  string
+	FinalID      int
+	FinalName    string
+	FinalAddress string
+	Candidates   []EventCandidateView
+	RSVPs        []services.EventRSVP
+	Going        int
+	Maybe        int
+	MyRSVP       services.EventRSVP
+	Answered     bool
+	CanManage    bool
+	Past         bool
+	// Restaurants are those that can still be added as candidates.
+	Restaurants []RestaurantOption
+}
+
+type EventCandidateView struct {
+	RestaurantID int
+	Name         string
+	Address      string
+	Budget       int
+	Voters       []string
+	Voted        bool
+	IsFinal      bool
+}
+
+// EventFormPage is the data of the new and edit event forms.
+type EventFormPage struct {
+	Form        EventForm
+	Restaurants []RestaurantOption
+}
+
+func (h *Handler) EventRouter(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/events" && r.Method == http.MethodGet:
+		h.ListEvents(w, r)
+	case path == "/events":
+		h.CreateEvent(w, r)
+	case path == "/events/new":
+		h.NewEvent(w, r)
+	case strings.HasSuffix(path, ".ics"):
+		h.EventCalendar(w, r)
+	case strings.HasSuffix(path, "/edit"):
+		h.EditEvent(w, r)
+	case strings.HasSuffix(path, "/update"):
+		h.UpdateEvent(w, r)
+	case strings.HasSuffix(path, "/delete"):
+		h.DeleteEvent(w, r)
+	case strings.HasSuffix(path, "/candidates/remove"):
+		h.RemoveEventCandidate(w, r)
+	case strings.HasSuffix(path, "/candidates"):
+		h.AddEventCandidate(w, r)
+	case strings.HasSuffix(path, "/vote"):
+		h.VoteEvent(w, r)
+	case strings.HasSuffix(path, "/rsvp"):
+		h.RSVPEvent(w, r)
+	case strings.HasSuffix(path, "/decide"):
+		h.DecideEvent(w, r)
+	default:
+		h.ShowEvent(w, r)
+	}
+}
+
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := h.eventService.ListEvents()
+	if err != nil {
+		http.Error(w, "event error", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.getSession(r)
+	page := EventsPage{}
+	now := time.Now()
+	for _, event := range events {
+		summary := EventSummary{
+			ID:     event.ID,
+			Title:  event.Title,
+			When:   formatEventTime(event.StartsAt, event.EndsAt),
+			Venue:  event.FinalName,
+			Going:  event.Going,
+			Budget: event.BudgetPerPerson,
+		}
+		if eventEnd(event).Before(now) {
+			page.Past = append([]EventSummary{summary}, page.Past...)
+		} else {
+			page.Upcoming = append(page.Upcoming, summary)
+		}
+	}
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+		token, err := h.eventService.CalendarToken(session.UserID)
+		if err == nil {
+			page.FeedURL = calendarFeedURL(h.cfg.BaseURL, token)
+		}
+	}
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Event:          page,
+	}
+	h.render(w, "events_index.html", data)
+}
+
+func (h *Handler) NewEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	form := EventForm{StartTime: "19:00", RestaurantIDs: map[int]bool{}}
+	if id, err := strconv.Atoi(r.URL.Query().Get("restaurant_id")); err == nil {
+		form.RestaurantIDs[id] = true
+	}
+	h.renderEventForm(w, r, session, "events_new.html", form, nil)
+}
+
+func (h *Handler) CreateEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	form, errors := parseEventForm(r)
+	if len(errors) > 0 {
+		h.renderEventForm(w, r, session, "events_new.html", form, errors)
+		return
+	}
+	var restaurantIDs []int
+	for id := range form.RestaurantIDs {
+		restaurantIDs = append(restaurantIDs, id)
+	}
+	id, err := h.eventService.CreateEvent(services.Event{
+		Title:           form.Title,
+		StartsAt:        form.startsAt,
+		EndsAt:          form.endsAt,
+		BudgetPerPerson: form.budget,
+		Note:            form.Note,
+		CreatedBy:       session.UserID,
+	}, restaurantIDs)
+	if err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/events/%d", id), http.StatusFound)
+}
+
+func (h *Handler) EditEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	event, ok := h.managedEvent(w, r, session, "/edit")
+	if !ok {
+		return
+	}
+	form := EventForm{
+		ID:        event.ID,
+		Title:     event.Title,
+		Date:      event.StartsAt.Local().Format("2006-01-02"),
+		StartTime: event.StartsAt.Local().Format("15:04"),
+		Budget:    budgetString(event.BudgetPerPerson),
+		Note:      event.Note,
+	}
+	if !event.EndsAt.IsZero() {
+		form.EndTime = event.EndsAt.Local().Format("15:04")
+	}
+	h.renderEventForm(w, r, session, "events_edit.html", form, nil)
+}
+
+func (h *Handler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	event, ok := h.managedEvent(w, r, session, "/update")
+	if !ok {
+		return
+	}
+	form, errors := parseEventForm(r)
+	form.ID = event.ID
+	if len(errors) > 0 {
+		h.renderEventForm(w, r, session, "events_edit.html", form, errors)
+		return
+	}
+	if err := h.eventService.UpdateEvent(services.Event{
+		ID:              event.ID,
+		Title:           form.Title,
+		StartsAt:        form.startsAt,
+		EndsAt:          form.endsAt,
+		BudgetPerPerson: form.budget,
+		Note:            form.Note,
+	}); err != nil {
+		h.eventChangeError(w, r, err, "update error")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/events/%d", event.ID), http.StatusFound)
+}
+
+func (h *Handler) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	event, ok := h.managedEvent(w, r, session, "/delete")
+	if !ok {
+		return
+	}
+	if err := h.eventService.DeleteEvent(event.ID); err != nil {
+		h.eventChangeError(w, r, err, "delete error")
+		return
+	}
+	http.Redirect(w, r, "/events", http.StatusFound)
+}
+
+func (h *Handler) ShowEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	detail, err := h.eventService.GetEventDetail(id)
+	if err != nil {
+		http.Error(w, "event error", http.StatusInternalServerError)
+		return
+	}
+	if detail == nil {
+		http.NotFound(w, r)
+		return
+	}
+	session, _ := h.getSession(r)
+	var user *services.User
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+
+	page := EventPage{
+		ID:           detail.ID,
+		Title:        detail.Title,
+		When:         formatEventTime(detail.StartsAt, detail.EndsAt),
+		Budget:       detail.BudgetPerPerson,
+		Note:         detail.Note,
+		CreatorName:  detail.CreatorName,
+		FinalID:      detail.FinalRestaurantID,
+		FinalName:    detail.FinalName,
+		FinalAddress: detail.FinalAddress,
+		RSVPs:        detail.RSVPs,
+		Going:        detail.Going,
+		Maybe:        detail.Maybe,
+		MyRSVP:       services.EventRSVP{Status: services.RSVPYes, Headcount: 1},
+		CanManage:    h.canManageEvent(user, &detail.Event),
+		Past:         eventEnd(detail.Event).Before(time.Now()),
+	}
+	candidateIDs := make(map[int]bool, len(detail.Candidates))
+	for _, candidate := range detail.Candidates {
+		view := EventCandidateView{
+			RestaurantID: candidate.RestaurantID,
+			Name:         candidate.Name,
+			Address:      candidate.Address,
+			Budget:       candidate.Budget,
+			IsFinal:      candidate.RestaurantID == detail.FinalRestaurantID,
+		}
+		for _, voter := range candidate.Votes {
+			view.Voters = append(view.Voters, voter.Username)
+			if user != nil && voter.UserID == user.ID {
+				view.Voted = true
+			}
+		}
+		candidateIDs[candidate.RestaurantID] = true
+		page.Candidates = append(page.Candidates, view)
+	}
+	if user != nil {
+		for _, rsvp := range detail.RSVPs {
+			if rsvp.UserID == user.ID {
+				page.MyRSVP = rsvp
+				page.Answered = true
+			}
+		}
+		restaurants, _ := h.restaurantService.ListRestaurants()
+		for _, restaurant := range restaurants {
+			if !candidateIDs[restaurant.ID] {
+				page.Restaurants = append(page.Restaurants, RestaurantOption{ID: restaurant.ID, Name: restaurant.Name})
+			}
+		}
+	}
+
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Event:          page,
+	}
+	if user != nil {
+		data.User = user
+	}
+	h.render(w, "events_show.html", data)
+}
+
+func (h *Handler) AddEventCandidate(w http.ResponseWriter, r *http.Request) {
+	h.changeEvent(w, r, "/candidates", false, func(event *services.Event, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.eventService.AddCandidate(event.ID, restaurantID, session.UserID)
+	})
+}
+
+func (h *Handler) RemoveEventCandidate(w http.ResponseWriter, r *http.Request) {
+	h.changeEvent(w, r, "/candidates/remove", true, func(event *services.Event, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.eventService.RemoveCandidate(event.ID, restaurantID)
+	})
+}
+
+func (h *Handler) VoteEvent(w http.ResponseWriter, r *http.Request) {
+	h.changeEvent(w, r, "/vote", false, func(event *services.Event, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		return h.eventService.ToggleVote(event.ID, restaurantID, session.UserID)
+	})
+}
+
+func (h *Handler) RSVPEvent(w http.ResponseWriter, r *http.Request) {
+	h.changeEvent(w, r, "/rsvp", false, func(event *services.Event, session *SessionInfo) error {
+		status := r.FormValue("status")
+		if status != services.RSVPYes && status != services.RSVPMaybe && status != services.RSVPNo {
+			return errBadEventInput
+		}
+		headcount := 1
+		if value := strings.TrimSpace(r.FormValue("headcount")); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > maxEventHeadcount {
+				return errBadEventInput
+			}
+			headcount = parsed
+		}
+		comment := strings.TrimSpace(r.FormValue("comment"))
+		if !util.ValidateOptionalText(comment, 200) {
+			return errBadEventInput
+		}
+		return h.eventService.SetRSVP(event.ID, session.UserID, status, headcount, comment)
+	})
+}
+
+func (h *Handler) DecideEvent(w http.ResponseWriter, r *http.Request) {
+	h.changeEvent(w, r, "/decide", true, func(event *services.Event, session *SessionInfo) error {
+		restaurantID := 0
+		if value := r.FormValue("restaurant_id"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return sql.ErrNoRows
+			}
+			restaurantID = parsed
+		}
+		return h.eventService.Decide(event.ID, restaurantID)
+	})
+}
+
+var errBadEventInput = fmt.Errorf("invalid event input")
+
+// changeEvent runs a POST on an event and goes back to the event page. When
+// manage is set, only those who may manage the event can make the change.
+func (h *Handler) changeEvent(w http.ResponseWriter, r *http.Request, suffix string, manage bool, change func(*services.Event, *SessionInfo) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	var event *services.Event
+	if manage {
+		event, ok = h.managedEvent(w, r, session, suffix)
+	} else {
+		event, ok = h.visibleEvent(w, r, suffix)
+	}
+	if !ok {
+		return
+	}
+	if err := change(event, session); err != nil {
+		h.eventChangeError(w, r, err, "update error")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/events/%d", event.ID), http.StatusFound)
+}
+
+func (h *Handler) eventChangeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+	case err == errBadEventInput:
+		http.Error(w, "bad request", http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) visibleEvent(w http.ResponseWriter, r *http.Request, suffix string) (*services.Event, bool) {
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, suffix))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	event, err := h.eventService.GetEvent(id)
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return event, true
+}
+
+func (h *Handler) managedEvent(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.Event, bool) {
+	event, ok := h.visibleEvent(w, r, suffix)
+	if !ok {
+		return nil, false
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canManageEvent(user, event) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return event, true
+}
+
+func (h *Handler) renderEventForm(w http.ResponseWriter, r *http.Request, session *SessionInfo, name string, form EventForm, errors map[string]string) {
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	user, _ := h.userService.GetUserByID(session.UserID)
+	page := EventFormPage{Form: form}
+	restaurants, _ := h.restaurantService.ListRestaurants()
+	page.Restaurants = toRestaurantOptions(restaurants)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Errors:         errors,
+		Event:          page,
+	}
+	h.render(w, name, data)
+}
+
+func parseEventForm(r *http.Request) (EventForm, map[string]string) {
+	form := EventForm{
+		Title:         strings.TrimSpace(r.FormValue("title")),
+		Date:          strings.TrimSpace(r.FormValue("date")),
+		StartTime:     strings.TrimSpace(r.FormValue("start_time")),
+		EndTime:       strings.TrimSpace(r.FormValue("end_time")),
+		Budget:        strings.TrimSpace(r.FormValue("budget_per_person")),
+		Note:          strings.TrimSpace(r.FormValue("note")),
+		RestaurantIDs: map[int]bool{},
+	}
+	for _, value := range r.Form["restaurant_id"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			form.RestaurantIDs[id] = true
+		}
+	}
+
+	errors := map[string]string{}
+	if !util.ValidateRequiredText(form.Title, 1, 100) {
+		errors["title"] = "タイトルは1〜100文字で入力してください。"
+	}
+	startsAt, err := time.ParseInLocation("2006-01-02 15:04", form.Date+" "+form.StartTime, time.Local)
+	if err != nil {
+		errors["date"] = "日付と開始時刻を入力してください。"
+	}
+	form.startsAt = startsAt
+	if form.EndTime != "" && err == nil {
+		end, err := time.ParseInLocation("15:04", form.EndTime, time.Local)
+		if err != nil {
+			errors["end_time"] = "終了時刻は「21:00」の形式で入力してください。"
+		} else {
+			// An end time at or before the start is the next day, e.g. 19:00〜1:00.
+			form.endsAt = time.Date(startsAt.Year(), startsAt.Month(), startsAt.Day(), end.Hour(), end.Minute(), 0, 0, time.Local)
+			if !form.endsAt.After(startsAt) {
+				form.endsAt = form.endsAt.AddDate(0, 0, 1)
+			}
+		}
+	}
+	budget, budgetOK := parseBudget(form.Budget)
+	if !budgetOK {
+		errors["budget_per_person"] = "予算は1〜100000の整数（円）で入力してください。"
+	}
+	form.budget = budget
+	if !util.ValidateOptionalText(form.Note, 1000) {
+		errors["note"] = "メモは1000文字以内で入力してください。"
+	}
+	return form, errors
+}
+
+// EventCalendar downloads a single event as an .ics file.
+func (h *Handler) EventCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	event, ok := h.visibleEvent(w, r, ".ics")
+	if !ok {
+		return
+	}
+	calendar := ical.Calendar{
+		ProductID: eventCalendarProduct,
+		Events:    []ical.Event{h.toCalendarEvent(*event)},
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, event.ID))
+	writeCalendar(w, calendar)
+}
+
+// CalendarRouter serves the per-user calendar feed and resets its URL.
+func (h *Handler) CalendarRouter(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/calendar/reset" {
+		h.ResetCalendarFeed(w, r)
+		return
+	}
+	h.CalendarFeed(w, r)
+}
+
+// CalendarFeed serves /calendar/{token}.ics for calendar apps to subscribe
+// to. The token stands in for the login, which calendar apps cannot do.
+func (h *Handler) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	userID, events, err := h.eventService.CalendarFeed(token, time.Now())
+	if err != nil {
+		http.Error(w, "calendar error", http.StatusInternalServerError)
+		return
+	}
+	if userID == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	calendar := ical.Calendar{ProductID: eventCalendarProduct, Name: "グルメ館の予定"}
+	for _, event := range events {
+		calendar.Events = append(calendar.Events, h.toCalendarEvent(event))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	writeCalendar(w, calendar)
+}
+
+func (h *Handler) ResetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	if _, err := h.eventService.ResetCalendarToken(session.UserID); err != nil {
+		http.Error(w, "calendar error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/events", http.StatusFound)
+}
+
+func (h *Handler) toCalendarEvent(event services.Event) ical.Event {
+	var description []string
+	if event.BudgetPerPerson > 0 {
+		description = append(description, fmt.Sprintf("予算: 1人 %d円", event.BudgetPerPerson))
+	}
+	if event.Going > 0 {
+		description = append(description, fmt.Sprintf("参加: %d人", event.Going))
+	}
+	if event.Note != "" {
+		description = append(description, event.Note)
+	}
+	location := event.FinalName
+	if location != "" && event.FinalAddress != "" {
+		location += " " + event.FinalAddress
+	}
+	baseURL := strings.TrimRight(h.cfg.BaseURL, "/")
+	host := strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://")
+	if host == "" {
+		host = "gourmetkan"
+	}
+	calendarEvent := ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", event.ID, host),
+		Start:       event.StartsAt,
+		End:         eventEnd(event),
+		Updated:     event.UpdatedAt,
+		Summary:     event.Title,
+		Location:    location,
+		Description: strings.Join(description, "\n"),
+	}
+	if !event.CancelledAt.IsZero() {
+		calendarEvent.Cancelled = true
+		return calendarEvent
+	}
+	if baseURL != "" {
+		calendarEvent.URL = fmt.Sprintf("%s/events/%d", baseURL, event.ID)
+	}
+	return calendarEvent
+}
+
+func writeCalendar(w http.ResponseWriter, calendar ical.Calendar) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := calendar.Write(w); err != nil {
+		http.Error(w, "calendar error", http.StatusInternalServerError)
+	}
+}
+
+func eventEnd(event services.Event) time.Time {
+	if event.EndsAt.IsZero() {
+		return event.StartsAt.Add(defaultEventDuration)
+	}
+	return event.EndsAt
+}
+
+// formatEventTime formats e.g. "2026年10月20日(火) 19:00〜21:00".
+func formatEventTime(start, end time.Time) string {
+	start = start.Local()
+	text := fmt.Sprintf("%d年%d月%d日(%s) %s", start.Year(), start.Month(), start.Day(), weekdayNames[start.Weekday()], start.Format("15:04"))
+	if !end.IsZero() {
+		end = end.Local()
+		text += "〜"
+		if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+			text += "翌"
+		}
+		text += end.Format("15:04")
+	}
+	return text
+}
+
+func calendarFeedURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/calendar/" + token + ".ics"
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/gourmetkan/internal/pubsub"
+)
+
+// eventKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not close the connection.
+const eventKeepAlive = 25 * time.Second
+
+// streamEvents serves the topic's hub events as Server-Sent Events until the
+// client goes away. initial, when not nil, is sent first so the client starts
+// from the current state without a separate request.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request, topic string, initial *pubsub.Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := h.hub.Subscribe(topic)
+	defer unsubscribe()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if initial != nil {
+		writeEvent(w, *initial)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event pubsub.Event) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+}
+
+// publishJSON publishes value as JSON to the topic.
+func (h *Handler) publishJSON(topic, name string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("publish %s: %v", topic, err)
+		return
+	}
+	h.hub.Publish(topic, name, data)
+}
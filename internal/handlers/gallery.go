@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+const galleryPageSize = 24
+
+type GalleryTile struct {
+	Path           string
+	Caption        string
+	Link           string
+	RestaurantName string
+	UploaderID     int
+	UploaderName   string
+	FromReview     bool
+	CreatedAt      string
+}
+
+type UserProfile struct {
+	ID        int
+	Username  string
+	AvatarURL string
+}
+
+func toGalleryTiles(photos []services.GalleryPhoto) []GalleryTile {
+	tiles := make([]GalleryTile, 0, len(photos))
+	for _, photo := range photos {
+		link := "/restaurants/" + strconv.Itoa(photo.RestaurantID)
+		if photo.Source == services.PhotoSourceReview {
+			link += "#review-" + strconv.Itoa(photo.ReviewID)
+		}
+		tiles = append(tiles, GalleryTile{
+			Path:           photo.Path,
+			Caption:        photo.Caption,
+			Link:           link,
+			RestaurantName: photo.RestaurantName,
+			UploaderID:     photo.UploaderID,
+			UploaderName:   photo.UploaderName,
+			FromReview:     photo.Source == services.PhotoSourceReview,
+			CreatedAt:      dateOnly(photo.CreatedAt),
+		})
+	}
+	return tiles
+}
+
+// dateOnly trims a SQLite timestamp ("2006-01-02 15:04:05" or RFC 3339) to its date.
+func dateOnly(timestamp string) string {
+	if len(timestamp) >= len("2006-01-02") {
+		return timestamp[:len("2006-01-02")]
+	}
+	return timestamp
+}
+
+func parsePage(r *http.Request) int {
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	return page
+}
+
+// pageURL returns the current URL with the page query parameter replaced.
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+}
+
+func (h *Handler) Gallery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	selectedTag := strings.TrimSpace(query.Get("tag"))
+	radiusKm := 0.0
+	if value := query.Get("radius_km"); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
+			radiusKm = parsed
+		}
+	}
+	uploaderID := 0
+	if value := query.Get("user"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			uploaderID = parsed
+		}
+	}
+	page := parsePage(r)
+
+	filter := services.GalleryFilter{
+		Tag:        selectedTag,
+		UploaderID: uploaderID,
+		Limit:      galleryPageSize,
+		Offset:     (page - 1) * galleryPageSize,
+	}
+	// The radius is measured from the selected base, so a workspace without
+	// bases lists photos unfiltered by distance.
+	selectedBaseID := 0
+	if base != nil {
+		filter.Latitude, filter.Longitude, filter.RadiusKm = base.Latitude, base.Longitude, radiusKm
+		selectedBaseID = base.ID
+	} else {
+		radiusKm = 0
+	}
+	photos, hasMore, err := h.galleryService.ListPhotos(filter)
+	if err != nil {
+		http.Error(w, "photo error", http.StatusInternalServerError)
+		return
+	}
+
+	bases, _ := h.baseService.ListBases()
+	session, _ := h.getSession(r)
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	allTags, _ := h.restaurantService.ListTags()
+	users, _ := h.userService.ListUsers()
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedBaseID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Photos:         toGalleryTiles(photos),
+		Users:          users,
+		SelectedUserID: uploaderID,
+		AvailableTags:  toTagOptions(allTags),
+		SelectedTag:    selectedTag,
+		RadiusKm:       radiusKm,
+	}
+	if page > 1 {
+		data.PrevURL = pageURL(r, page-1)
+	}
+	if hasMore {
+		data.NextURL = pageURL(r, page+1)
+	}
+	h.render(w, "photos.html", data)
+}
+
+// UserDetail shows a member's profile with a timeline of the photos they uploaded.
+func (h *Handler) UserDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	profile, err := h.userService.GetUserByID(id)
+	if err != nil || profile == nil {
+		http.NotFound(w, r)
+		return
+	}
+	page := parsePage(r)
+	photos, hasMore, err := h.galleryService.ListPhotos(services.GalleryFilter{
+		UploaderID: profile.ID,
+		Limit:      galleryPageSize,
+		Offset:     (page - 1) * galleryPageSize,
+	})
+	if err != nil {
+		http.Error(w, "photo error", http.StatusInternalServerError)
+		return
+	}
+
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	selectedBaseID := 0
+	if base != nil {
+		selectedBaseID = base.ID
+	}
+	session, _ := h.getSession(r)
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedBaseID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Profile: UserProfile{
+			ID:        profile.ID,
+			Username:  profile.Username,
+			AvatarURL: profile.AvatarURL,
+		},
+		Photos: toGalleryTiles(photos),
+	}
+	if page > 1 {
+		data.PrevURL = pageURL(r, page-1)
+	}
+	if hasMore {
+		data.NextURL = pageURL(r, page+1)
+	}
+	h.render(w, "users_show.html", data)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	geocodeTimeout       = 3 * time.Second
+	maxGeocodeCandidates = 5
+	maxAddressRunes      = 200
+)
+
+// GeocodeCandidate is an address match offered on the restaurant form. Value is
+// the "lat,lng" posted back as geocode_candidate when it is picked.
+type GeocodeCandidate struct {
+	Label string
+	Value string
+}
+
+// geocodeAddress returns candidates for address. Geocoder failures only mean
+// there is nothing to offer, so they are logged rather than shown.
+func (h *Handler) geocodeAddress(ctx context.Context, address string) []GeocodeCandidate {
+	if h.geocoder == nil || address == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+	results, err := h.geocoder.Geocode(ctx, address)
+	if err != nil {
+		log.Printf("geocode %q: %v", address, err)
+		return nil
+	}
+	candidates := make([]GeocodeCandidate, 0, len(results))
+	for _, result := range results {
+		if len(candidates) == maxGeocodeCandidates {
+			break
+		}
+		if !util.ValidateLatitude(result.Latitude) || !util.ValidateLongitude(result.Longitude) {
+			continue
+		}
+		candidates = append(candidates, GeocodeCandidate{
+			Label: result.Label,
+			Value: fmt.Sprintf("%.6f,%.6f", result.Latitude, result.Longitude),
+		})
+	}
+	return candidates
+}
+
+// reverseGeocode returns an address for the point, or "" when none is known.
+func (h *Handler) reverseGeocode(ctx context.Context, latitude, longitude float64) string {
+	if h.geocoder == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+	address, err := h.geocoder.ReverseGeocode(ctx, latitude, longitude)
+	if err != nil {
+		return ""
+	}
+	address = strings.TrimSpace(address)
+	if !util.ValidateOptionalText(address, maxAddressRunes) {
+		return ""
+	}
+	return address
+}
+
+// pickedGeocodeCandidate reads the candidate chosen on a previous submission.
+func pickedGeocodeCandidate(r *http.Request) (float64, float64, bool) {
+	loc, ok := util.ParseMapLocation(r.FormValue("geocode_candidate"))
+	if !ok || loc.Format != util.MapFormatDecimal {
+		return 0, 0, false
+	}
+	return loc.Latitude, loc.Longitude, true
+}
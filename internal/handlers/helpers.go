@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"net/url"
 	"strings"
 
 	"example.com/gourmetkan/internal/services"
@@ -15,6 +16,11 @@ type TagOption struct {
 	Name string
 }
 
+type RestaurantOption struct {
+	ID   int
+	Name string
+}
+
 func toBaseOptions(bases []services.Base) []BaseOption {
 	options := make([]BaseOption, 0, len(bases))
 	for _, base := range bases {
@@ -23,6 +29,14 @@ func toBaseOptions(bases []services.Base) []BaseOption {
 	return options
 }
 
+func toRestaurantOptions(restaurants []services.Restaurant) []RestaurantOption {
+	options := make([]RestaurantOption, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		options = append(options, RestaurantOption{ID: restaurant.ID, Name: restaurant.Name})
+	}
+	return options
+}
+
 func toTagOptions(tags []services.Tag) []TagOption {
 	options := make([]TagOption, 0, len(tags))
 	for _, tag := range tags {
@@ -103,3 +117,11 @@ func csrfTokenOrEmpty(session *SessionInfo) string {
 	}
 	return session.CSRFToken
 }
+
+func isWebURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"net/http"
-	"sort"
 	"strings"
+	"time"
 
 	"example.com/gourmetkan/internal/services"
 	"example.com/gourmetkan/internal/util"
@@ -19,7 +19,16 @@ func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "base error", http.StatusInternalServerError)
 		return
 	}
+	session, _ := h.getSession(r)
+	viewerID := 0
+	if session != nil {
+		viewerID = session.UserID
+	}
 	selectedTag := strings.TrimSpace(r.URL.Query().Get("tag"))
+	selectedList, listFilter := parseMarkFilter(r.URL.Query().Get("list"), viewerID)
+	sortBy := parseSort(r.URL.Query().Get("sort"))
+	dimension, _ := services.ParseRatingDimension(r.URL.Query().Get("dimension"))
+	minScore := parseMinScore(r.URL.Query().Get("min_score"))
 	var restaurants []services.Restaurant
 	if selectedTag != "" {
 		restaurants, err = h.restaurantService.ListRestaurantsByTag(selectedTag)
@@ -30,31 +39,50 @@ func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "restaurant error", http.StatusInternalServerError)
 		return
 	}
+	marks, err := h.markService.Marks(viewerID)
+	if err != nil {
+		http.Error(w, "list error", http.StatusInternalServerError)
+		return
+	}
+	if listFilter {
+		restaurants = filterMarked(restaurants, marks, selectedList)
+	}
+	lastVisits, err := h.checkinService.LastVisits(viewerID)
+	if err != nil {
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+	stats, err := h.restaurantService.StatsForRestaurants(restaurants)
+	if err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	scores := overallAverages(stats)
+	if dimension != "" {
+		if scores, err = h.reviewService.ScoreAverages(dimension); err != nil {
+			http.Error(w, "review error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if minScore > 0 {
+		restaurants = filterByScore(restaurants, scores, minScore)
+	}
 
-	tagMap, err := h.restaurantService.TagsForRestaurants(restaurants)
+	items, err := h.restaurantListItems(r, base, restaurants, stats, marks, lastVisits)
 	if err != nil {
-		http.Error(w, "tag error", http.StatusInternalServerError)
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
 		return
 	}
-	items := make([]RestaurantListItem, 0, len(restaurants))
-	for _, rest := range restaurants {
-		distanceKm := util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude)
-		items = append(items, RestaurantListItem{
-			ID:          rest.ID,
-			Name:        rest.Name,
-			Description: rest.Description,
-			PhotoPath:   rest.PhotoPath,
-			DistanceKm:  distanceKm,
-			Distance:    util.FormatDistanceKm(distanceKm),
-			Tags:        tagMap[rest.ID],
-		})
+	if dimension != "" {
+		for i := range items {
+			items[i].Score = scores[items[i].ID].Average
+			items[i].ScoreCount = scores[items[i].ID].Count
+			items[i].Rank = items[i].Score
+		}
 	}
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].DistanceKm < items[j].DistanceKm
-	})
+	sortRestaurantItems(items, sortBy)
 
 	bases, _ := h.baseService.ListBases()
-	session, _ := h.getSession(r)
 	var user interface{}
 	if session != nil {
 		user, _ = h.userService.GetUserByID(session.UserID)
@@ -68,6 +96,55 @@ func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
 		CSRFToken:      csrfTokenOrEmpty(session),
 		AvailableTags:  toTagOptions(allTags),
 		SelectedTag:    selectedTag,
+		SelectedList:   string(selectedList),
+		Sort:           sortBy,
+		Dimension:      string(dimension),
+		MinScore:       r.URL.Query().Get("min_score"),
+		Dimensions:     dimensionOptions(),
+		ScoreLabel:     scoreLabel(dimension),
 	}
 	h.render(w, "index.html", data)
 }
+
+// restaurantListItems builds the cards of a restaurant list, with distances
+// and travel times from base, the restaurants' stats and the viewer's marks
+// and last visits. Items are scored by the overall rating.
+func (h *Handler) restaurantListItems(r *http.Request, base *services.Base, restaurants []services.Restaurant, stats map[int]services.RestaurantStats, marks map[int]services.RestaurantMarks, lastVisits map[int]time.Time) ([]RestaurantListItem, error) {
+	tagMap, err := h.restaurantService.TagsForRestaurants(restaurants)
+	if err != nil {
+		return nil, err
+	}
+	travelTimes := h.travelTimes(r, base, restaurants)
+	now := time.Now()
+	items := make([]RestaurantListItem, 0, len(restaurants))
+	for _, rest := range restaurants {
+		distanceKm := util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude)
+		travelTime := travelTimes[rest.ID]
+		walkingTime, cyclingTime := formatTravelTime(travelTime)
+		photoPath := rest.PhotoPath
+		if cover := stats[rest.ID].CoverPhotoPath; cover != "" {
+			photoPath = cover
+		}
+		items = append(items, RestaurantListItem{
+			ID:              rest.ID,
+			Name:            rest.Name,
+			Description:     rest.Description,
+			PhotoPath:       photoPath,
+			DistanceKm:      distanceKm,
+			Distance:        util.FormatDistanceKm(distanceKm),
+			WalkingDuration: travelTime.Walking.Duration,
+			CyclingDuration: travelTime.Cycling.Duration,
+			WalkingTime:     walkingTime,
+			CyclingTime:     cyclingTime,
+			RouteEstimated:  travelTime.Walking.Estimated || travelTime.Cycling.Estimated,
+			Tags:            tagMap[rest.ID],
+			Favorite:        marks[rest.ID].Favorite,
+			WantToGo:        marks[rest.ID].WantToGo,
+			LastVisited:     formatLastVisited(lastVisits[rest.ID], now),
+			Score:           stats[rest.ID].Average,
+			ScoreCount:      stats[rest.ID].ReviewCount,
+			Rank:            stats[rest.ID].Score,
+		})
+	}
+	return items, nil
+}
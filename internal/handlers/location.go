@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	// currentLocationBaseID marks the virtual base built from the browser's
+	// position. It is never stored in bases.
+	currentLocationBaseID    = -1
+	currentLocationBaseName  = "現在地"
+	currentLocationBaseValue = "current"
+)
+
+// currentLocationBase reads the virtual base from the location cookie.
+func currentLocationBase(r *http.Request) (*services.Base, bool) {
+	cookie, err := r.Cookie(locationCookieName)
+	if err != nil {
+		return nil, false
+	}
+	latStr, lngStr, ok := strings.Cut(cookie.Value, ",")
+	if !ok {
+		return nil, false
+	}
+	lat, err1 := strconv.ParseFloat(latStr, 64)
+	lng, err2 := strconv.ParseFloat(lngStr, 64)
+	if err1 != nil || err2 != nil || !util.ValidateLatitude(lat) || !util.ValidateLongitude(lng) {
+		return nil, false
+	}
+	return &services.Base{ID: currentLocationBaseID, Name: currentLocationBaseName, Latitude: lat, Longitude: lng}, true
+}
+
+// selectCurrentLocation makes the posted browser position the selected base. It
+// lives in a session cookie only. Posting without coordinates keeps the position
+// already stored, so the base select form can be resubmitted as is.
+func (h *Handler) selectCurrentLocation(w http.ResponseWriter, r *http.Request) {
+	latStr := strings.TrimSpace(r.FormValue("latitude"))
+	lngStr := strings.TrimSpace(r.FormValue("longitude"))
+	if latStr == "" && lngStr == "" {
+		if _, ok := currentLocationBase(r); !ok {
+			http.Error(w, "invalid location", http.StatusBadRequest)
+			return
+		}
+	} else {
+		lat, err1 := strconv.ParseFloat(latStr, 64)
+		lng, err2 := strconv.ParseFloat(lngStr, 64)
+		if err1 != nil || err2 != nil || !util.ValidateLatitude(lat) || !util.ValidateLongitude(lng) {
+			http.Error(w, "invalid location", http.StatusBadRequest)
+			return
+		}
+		// About 10 m is plenty for distance sorting and keeps less of the position around.
+		http.SetCookie(w, &http.Cookie{
+			Name:     locationCookieName,
+			Value:    fmt.Sprintf("%.4f,%.4f", roundCoordinate(lat), roundCoordinate(lng)),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   h.cfg.CookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     baseCookieName,
+		Value:    currentLocationBaseValue,
+		Path:     "/",
+		HttpOnly: false,
+		Secure:   h.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (h *Handler) clearLocationCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     locationCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*1e4) / 1e4
+}
@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/pubsub"
+	"example.com/gourmetkan/internal/services"
+)
+
+const (
+	defaultLunchCandidates = 3
+	maxLunchCandidates     = 8
+	defaultLunchMinutes    = 15
+	maxLunchMinutes        = 180
+	// lunchCloseInterval is the longest closeLunches waits between checks,
+	// so it recovers from errors and sees sessions it was not told about.
+	lunchCloseInterval = time.Minute
+)
+
+// LunchPage is the data of a lunch session page.
+type LunchPage struct {
+	Token         string
+	ShareURL      string
+	BaseName      string
+	RadiusKm      float64
+	Conditions    string
+	CreatorName   string
+	Deadline      string
+	Closed        bool
+	Winner        *LunchCandidateView
+	WinnerID      int
+	Candidates    []LunchCandidateView
+	Participants  []string
+	IsParticipant bool
+	IsCreator     bool
+}
+
+type LunchCandidateView struct {
+	RestaurantID int
+	Name         string
+	PhotoPath    string
+	Votes        []string
+	Vetoes       []string
+	MyVote       int
+}
+
+// LunchForm is the data of the new session form.
+type LunchForm struct {
+	Filter     RandomForm
+	Candidates int
+	Minutes    int
+}
+
+// lunchStateJSON is what the event stream and the vote endpoint send, the
+// same for every viewer.
+type lunchStateJSON struct {
+	Closed       bool                      `json:"closed"`
+	WinnerID     int                       `json:"winner_id"`
+	Participants []services.LunchVoter     `json:"participants"`
+	Candidates   []services.LunchCandidate `json:"candidates"`
+}
+
+func (h *Handler) LunchRouter(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/lunch" && r.Method == http.MethodGet:
+		h.NewLunch(w, r)
+	case path == "/lunch":
+		h.CreateLunch(w, r)
+	case strings.HasSuffix(path, "/join"):
+		h.JoinLunch(w, r)
+	case strings.HasSuffix(path, "/vote"):
+		h.VoteLunch(w, r)
+	case strings.HasSuffix(path, "/close"):
+		h.CloseLunch(w, r)
+	case strings.HasSuffix(path, "/events"):
+		h.LunchEvents(w, r)
+	default:
+		h.ShowLunch(w, r)
+	}
+}
+
+func (h *Handler) NewLunch(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	h.renderLunchForm(w, r, session, LunchForm{Candidates: defaultLunchCandidates, Minutes: defaultLunchMinutes}, nil)
+}
+
+func (h *Handler) CreateLunch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+
+	filter, filterForm := parseRandomFilter(r.PostForm)
+	filter.Latitude = base.Latitude
+	filter.Longitude = base.Longitude
+	filter.UserID = session.UserID
+	form := LunchForm{Filter: filterForm, Candidates: defaultLunchCandidates, Minutes: defaultLunchMinutes}
+	errors := map[string]string{}
+	if value := r.FormValue("candidates"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2 || parsed > maxLunchCandidates {
+			errors["candidates"] = fmt.Sprintf("候補の数は2〜%d件で指定してください。", maxLunchCandidates)
+		}
+		form.Candidates = parsed
+	}
+	if value := r.FormValue("minutes"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLunchMinutes {
+			errors["minutes"] = fmt.Sprintf("締切は1〜%d分後で指定してください。", maxLunchMinutes)
+		}
+		form.Minutes = parsed
+	}
+	var restaurantIDs []int
+	if len(errors) == 0 {
+		candidates, err := h.suggestionService.Candidates(filter)
+		if err != nil {
+			http.Error(w, "restaurant error", http.StatusInternalServerError)
+			return
+		}
+		for _, candidate := range services.SuggestionSequence(candidates, time.Now().UnixNano()) {
+			if len(restaurantIDs) == form.Candidates {
+				break
+			}
+			restaurantIDs = append(restaurantIDs, candidate.Restaurant.ID)
+		}
+		if len(restaurantIDs) < 2 {
+			errors["candidates"] = "条件に合うお店が2件未満です。条件をゆるめてください。"
+		}
+	}
+	if len(errors) > 0 {
+		h.renderLunchForm(w, r, session, form, errors)
+		return
+	}
+
+	token, err := h.lunchService.CreateSession(services.LunchSession{
+		CreatedBy:  session.UserID,
+		BaseName:   base.Name,
+		RadiusKm:   filter.RadiusKm,
+		Conditions: describeRandomFilter(filter),
+		Deadline:   time.Now().Add(time.Duration(form.Minutes) * time.Minute),
+	}, restaurantIDs)
+	if err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	h.wakeLunchCloser()
+	http.Redirect(w, r, "/lunch/"+token, http.StatusFound)
+}
+
+func (h *Handler) renderLunchForm(w http.ResponseWriter, r *http.Request, session *SessionInfo, form LunchForm, errors map[string]string) {
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	selectedBaseID := 0
+	if base != nil {
+		selectedBaseID = base.ID
+	}
+	allTags, _ := h.restaurantService.ListTags()
+	user, _ := h.userService.GetUserByID(session.UserID)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedBaseID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		AvailableTags:  toTagOptions(allTags),
+		Errors:         errors,
+		Lunch:          form,
+	}
+	h.render(w, "lunch_new.html", data)
+}
+
+func (h *Handler) ShowLunch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	state, ok := h.lunchState(w, r, "")
+	if !ok {
+		return
+	}
+	page := h.toLunchPage(state, session.UserID)
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	selectedBaseID := 0
+	if base != nil {
+		selectedBaseID = base.ID
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedBaseID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Lunch:          page,
+	}
+	h.render(w, "lunch_show.html", data)
+}
+
+func (h *Handler) JoinLunch(w http.ResponseWriter, r *http.Request) {
+	h.changeLunch(w, r, "/join", func(state *services.LunchState, session *SessionInfo) error {
+		return h.lunchService.Join(state.Session.ID, session.UserID)
+	})
+}
+
+func (h *Handler) VoteLunch(w http.ResponseWriter, r *http.Request) {
+	h.changeLunch(w, r, "/vote", func(state *services.LunchState, session *SessionInfo) error {
+		restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+		if err != nil {
+			return sql.ErrNoRows
+		}
+		value := services.LunchVote
+		if r.FormValue("value") == "veto" {
+			value = services.LunchVeto
+		}
+		return h.lunchService.Vote(state.Session.ID, restaurantID, session.UserID, value)
+	})
+}
+
+func (h *Handler) CloseLunch(w http.ResponseWriter, r *http.Request) {
+	h.changeLunch(w, r, "/close", func(state *services.LunchState, session *SessionInfo) error {
+		if state.Session.CreatedBy != session.UserID {
+			return errLunchForbidden
+		}
+		return h.lunchService.Close(state.Session.ID)
+	})
+}
+
+var errLunchForbidden = errors.New("not the lunch session creator")
+
+// changeLunch runs a POST that changes a session, then pushes the new state to
+// everyone watching it. Requests from the page's script get the state as JSON;
+// plain form posts are redirected back to the page.
+func (h *Handler) changeLunch(w http.ResponseWriter, r *http.Request, suffix string, change func(*services.LunchState, *SessionInfo) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	state, ok := h.lunchState(w, r, suffix)
+	if !ok {
+		return
+	}
+	if err := change(state, session); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.NotFound(w, r)
+		case errors.Is(err, services.ErrLunchClosed):
+			http.Error(w, "lunch session is closed", http.StatusConflict)
+		case err == errLunchForbidden:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "update error", http.StatusInternalServerError)
+		}
+		return
+	}
+	updated, err := h.lunchService.GetState(state.Session.Token)
+	if err != nil || updated == nil {
+		http.Error(w, "lunch error", http.StatusInternalServerError)
+		return
+	}
+	payload := toLunchStateJSON(updated)
+	h.publishJSON(lunchTopic(updated.Session.Token), "state", payload)
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, payload)
+		return
+	}
+	http.Redirect(w, r, "/lunch/"+updated.Session.Token, http.StatusFound)
+}
+
+// LunchEvents streams the session state whenever someone joins or votes.
+func (h *Handler) LunchEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.requireLogin(w, r); !ok {
+		return
+	}
+	state, ok := h.lunchState(w, r, "/events")
+	if !ok {
+		return
+	}
+	initial, err := jsonEvent(lunchTopic(state.Session.Token), "state", toLunchStateJSON(state))
+	if err != nil {
+		http.Error(w, "lunch error", http.StatusInternalServerError)
+		return
+	}
+	h.streamEvents(w, r, lunchTopic(state.Session.Token), initial)
+}
+
+// lunchState loads the session named by the path, writing a 404 when there is
+// none.
+func (h *Handler) lunchState(w http.ResponseWriter, r *http.Request, suffix string) (*services.LunchState, bool) {
+	token := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/lunch/"), suffix), "/")
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	state, err := h.lunchService.GetState(token)
+	if err != nil {
+		http.Error(w, "lunch error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if state == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return state, true
+}
+
+// closeLunches closes each session at its deadline and publishes the final
+// state to everyone watching it, until ctx is done.
+func (h *Handler) closeLunches(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-h.lunchWake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		wait := lunchCloseInterval
+		closed, next, err := h.lunchService.CloseDue()
+		if err != nil {
+			log.Printf("close lunch sessions: %v", err)
+		}
+		for _, session := range closed {
+			h.publishLunchState(session)
+		}
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// wakeLunchCloser makes closeLunches look at the deadlines again, after a
+// session was created.
+func (h *Handler) wakeLunchCloser() {
+	select {
+	case h.lunchWake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Handler) publishLunchState(session services.LunchSession) {
+	state, err := h.lunchService.InWorkspace(session.WorkspaceID).GetState(session.Token)
+	if err != nil || state == nil {
+		log.Printf("lunch session %s: %v", session.Token, err)
+		return
+	}
+	h.publishJSON(lunchTopic(state.Session.Token), "state", toLunchStateJSON(state))
+}
+
+func lunchTopic(token string) string {
+	return "lunch:" + token
+}
+
+func jsonEvent(topic, name string, value interface{}) (*pubsub.Event, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &pubsub.Event{Topic: topic, Name: name, Data: data}, nil
+}
+
+func toLunchStateJSON(state *services.LunchState) lunchStateJSON {
+	participants := state.Participants
+	if participants == nil {
+		participants = []services.LunchVoter{}
+	}
+	return lunchStateJSON{
+		Closed:       state.Session.Closed(),
+		WinnerID:     state.Session.WinnerID,
+		Participants: participants,
+		Candidates:   state.Candidates,
+	}
+}
+
+func (h *Handler) toLunchPage(state *services.LunchState, viewerID int) LunchPage {
+	lunch := state.Session
+	page := LunchPage{
+		Token:       lunch.Token,
+		ShareURL:    strings.TrimRight(h.cfg.BaseURL, "/") + "/lunch/" + lunch.Token,
+		BaseName:    lunch.BaseName,
+		RadiusKm:    math.Round(lunch.RadiusKm*10) / 10,
+		Conditions:  lunch.Conditions,
+		CreatorName: lunch.CreatorName,
+		Deadline:    lunch.Deadline.Local().Format("15:04"),
+		Closed:      lunch.Closed(),
+		WinnerID:    lunch.WinnerID,
+		IsCreator:   lunch.CreatedBy == viewerID,
+	}
+	for _, participant := range state.Participants {
+		page.Participants = append(page.Participants, participant.Username)
+		if participant.UserID == viewerID {
+			page.IsParticipant = true
+		}
+	}
+	for _, candidate := range state.Candidates {
+		view := LunchCandidateView{RestaurantID: candidate.RestaurantID, Name: candidate.Name, PhotoPath: candidate.PhotoPath}
+		for _, voter := range candidate.Votes {
+			view.Votes = append(view.Votes, voter.Username)
+			if voter.UserID == viewerID {
+				view.MyVote = services.LunchVote
+			}
+		}
+		for _, voter := range candidate.Vetoes {
+			view.Vetoes = append(view.Vetoes, voter.Username)
+			if voter.UserID == viewerID {
+				view.MyVote = services.LunchVeto
+			}
+		}
+		page.Candidates = append(page.Candidates, view)
+		if candidate.RestaurantID == lunch.WinnerID {
+			winner := view
+			page.Winner = &winner
+		}
+	}
+	return page
+}
+
+// describeRandomFilter summarises a filter for people joining a session.
+func describeRandomFilter(filter services.SuggestionFilter) string {
+	var parts []string
+	if len(filter.IncludeTags) > 0 {
+		parts = append(parts, "タグ: "+strings.Join(filter.IncludeTags, "・"))
+	}
+	if len(filter.ExcludeTags) > 0 {
+		parts = append(parts, "除外: "+strings.Join(filter.ExcludeTags, "・"))
+	}
+	if !filter.OpenAt.IsZero() {
+		parts = append(parts, "営業中")
+	}
+	if filter.MaxBudget > 0 {
+		parts = append(parts, fmt.Sprintf("予算 %d円以下", filter.MaxBudget))
+	}
+	if filter.MinRating > 0 {
+		parts = append(parts, fmt.Sprintf("★%g以上", filter.MinRating))
+	}
+	return strings.Join(parts, " / ")
+}
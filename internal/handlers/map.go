@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/tiles"
+	"example.com/gourmetkan/internal/util"
+)
+
+// A map page needs a few dozen tiles at once and more while it is panned.
+// Beyond that, tile requests are refused so that the upstream tile server is
+// not used through this proxy in bulk.
+const (
+	tileRequestsPerSecond = 20
+	tileRequestBurst      = 200
+)
+
+// MapPage is what map.js needs to draw the map; it is handed over in data attributes.
+type MapPage struct {
+	BaseName    string
+	Latitude    float64
+	Longitude   float64
+	DataURL     string
+	TileURL     string
+	MinZoom     int
+	MaxZoom     int
+	Attribution string
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func newGeoJSONPoint(latitude, longitude float64) geoJSONPoint {
+	return geoJSONPoint{Type: "Point", Coordinates: [2]float64{longitude, latitude}}
+}
+
+// MapView serves GET /map, the restaurants around the selected base on a map.
+// It takes the same filters as the index.
+func (h *Handler) MapView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	selectedTag := strings.TrimSpace(r.URL.Query().Get("tag"))
+	dataURL := "/api/restaurants.geojson"
+	if selectedTag != "" {
+		dataURL += "?tag=" + url.QueryEscape(selectedTag)
+	}
+
+	bases, _ := h.baseService.ListBases()
+	session, _ := h.getSession(r)
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	allTags, _ := h.restaurantService.ListTags()
+	h.render(w, "map.html", TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		AvailableTags:  toTagOptions(allTags),
+		SelectedTag:    selectedTag,
+		Map: MapPage{
+			BaseName:    base.Name,
+			Latitude:    base.Latitude,
+			Longitude:   base.Longitude,
+			DataURL:     dataURL,
+			TileURL:     "/tiles/{z}/{x}/{y}.png",
+			MinZoom:     tiles.MinZoom,
+			MaxZoom:     tiles.MaxZoom,
+			Attribution: h.cfg.MapAttribution,
+		},
+	})
+}
+
+// RestaurantsGeoJSON serves GET /api/restaurants.geojson?bbox=minLng,minLat,maxLng,maxLat&tag=.
+// Without bbox every restaurant is returned.
+func (h *Handler) RestaurantsGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bounds := services.Bounds{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+	if raw := r.URL.Query().Get("bbox"); raw != "" {
+		parsed, ok := parseBBox(raw)
+		if !ok {
+			http.Error(w, "invalid bbox", http.StatusBadRequest)
+			return
+		}
+		bounds = parsed
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	selectedTag := strings.TrimSpace(r.URL.Query().Get("tag"))
+	restaurants, err := h.restaurantService.ListRestaurantsInBounds(bounds, selectedTag)
+	if err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	tagMap, err := h.restaurantService.TagsForRestaurants(restaurants)
+	if err != nil {
+		http.Error(w, "tag error", http.StatusInternalServerError)
+		return
+	}
+
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0, len(restaurants))}
+	for _, rest := range restaurants {
+		distanceKm := util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude)
+		tags := tagMap[rest.ID]
+		if tags == nil {
+			tags = []string{}
+		}
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: newGeoJSONPoint(rest.Latitude, rest.Longitude),
+			Properties: map[string]interface{}{
+				"id":       rest.ID,
+				"name":     rest.Name,
+				"url":      "/restaurants/" + strconv.Itoa(rest.ID),
+				"distance": util.FormatDistanceKm(distanceKm),
+				"tags":     tags,
+			},
+		})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONContentType(w, http.StatusOK, "application/geo+json", collection)
+}
+
+// parseBBox reads the GeoJSON/OGC order minLng,minLat,maxLng,maxLat.
+func parseBBox(raw string) (services.Bounds, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return services.Bounds{}, false
+	}
+	values := make([]float64, 4)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return services.Bounds{}, false
+		}
+		values[i] = value
+	}
+	bounds := services.Bounds{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	if !util.ValidateLatitude(bounds.MinLat) || !util.ValidateLatitude(bounds.MaxLat) ||
+		!util.ValidateLongitude(bounds.MinLng) || !util.ValidateLongitude(bounds.MaxLng) ||
+		bounds.MinLat > bounds.MaxLat || bounds.MinLng > bounds.MaxLng {
+		return services.Bounds{}, false
+	}
+	return bounds, true
+}
+
+// Tile serves GET /tiles/{z}/{x}/{y}.png from the configured tile source.
+func (h *Handler) Tile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.tileSource == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.tileLimiter.allow(clientAddress(r), time.Now()) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tiles/"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	z, err1 := strconv.Atoi(parts[0])
+	x, err2 := strconv.Atoi(parts[1])
+	y, err3 := strconv.Atoi(strings.TrimSuffix(parts[2], ".png"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := h.tileSource.Tile(r.Context(), z, x, y)
+	if errors.Is(err, tiles.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "tile error", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(data)
+}
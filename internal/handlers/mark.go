@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+// ListsPage is the data of the "my lists" page.
+type ListsPage struct {
+	Favorites []RestaurantListItem
+	WantToGo  []RestaurantListItem
+}
+
+// MyLists shows the viewer's favorite and want-to-go restaurants in the
+// current workspace.
+func (h *Handler) MyLists(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	base, err := h.getSelectedBase(r)
+	if err != nil || base == nil {
+		http.Error(w, "base error", http.StatusInternalServerError)
+		return
+	}
+	marks, err := h.markService.Marks(session.UserID)
+	if err != nil {
+		http.Error(w, "list error", http.StatusInternalServerError)
+		return
+	}
+	favorites, err := h.markService.ListMarked(session.UserID, services.MarkFavorite)
+	if err != nil {
+		http.Error(w, "list error", http.StatusInternalServerError)
+		return
+	}
+	wantToGo, err := h.markService.ListMarked(session.UserID, services.MarkWantToGo)
+	if err != nil {
+		http.Error(w, "list error", http.StatusInternalServerError)
+		return
+	}
+	lastVisits, err := h.checkinService.LastVisits(session.UserID)
+	if err != nil {
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+	stats, err := h.restaurantService.StatsForRestaurants(append(append([]services.Restaurant(nil), favorites...), wantToGo...))
+	if err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	page := ListsPage{}
+	if page.Favorites, err = h.restaurantListItems(r, base, favorites, stats, marks, lastVisits); err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+	if page.WantToGo, err = h.restaurantListItems(r, base, wantToGo, stats, marks, lastVisits); err != nil {
+		http.Error(w, "restaurant error", http.StatusInternalServerError)
+		return
+	}
+
+	bases, _ := h.baseService.ListBases()
+	user, _ := h.userService.GetUserByID(session.UserID)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Lists:          page,
+	}
+	h.render(w, "lists.html", data)
+}
+
+// SetRestaurantMark puts a restaurant on or takes it off one of the viewer's
+// lists, then goes back to the page the form was on.
+func (h *Handler) SetRestaurantMark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/marks"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	kind, ok := services.ParseMarkKind(r.FormValue("kind"))
+	if !ok {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := h.markService.SetMark(session.UserID, id, kind, r.FormValue("on") == "1"); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "update error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, localPath(r.FormValue("next"), fmt.Sprintf("/restaurants/%d", id)), http.StatusFound)
+}
+
+// parseMarkFilter reads the index's list filter. Anonymous viewers have no
+// lists, so the filter is dropped for them.
+func parseMarkFilter(value string, viewerID int) (services.MarkKind, bool) {
+	if viewerID == 0 {
+		return "", false
+	}
+	return services.ParseMarkKind(value)
+}
+
+func filterMarked(restaurants []services.Restaurant, marks map[int]services.RestaurantMarks, kind services.MarkKind) []services.Restaurant {
+	var filtered []services.Restaurant
+	for _, rest := range restaurants {
+		if marks[rest.ID].Has(kind) {
+			filtered = append(filtered, rest)
+		}
+	}
+	return filtered
+}
+
+// localPath returns value if it is a path on this site, else fallback, so a
+// form's "next" field cannot redirect elsewhere.
+func localPath(value, fallback string) string {
+	if !strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//") || strings.HasPrefix(value, "/\\") {
+		return fallback
+	}
+	return value
+}
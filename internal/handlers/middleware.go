@@ -8,8 +8,10 @@ import (
 )
 
 const (
-	sessionCookieName = "session_id"
-	baseCookieName    = "base_id"
+	sessionCookieName   = "session_id"
+	baseCookieName      = "base_id"
+	locationCookieName  = "base_location"
+	workspaceCookieName = "workspace_id"
 )
 
 type SessionInfo struct {
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+// NavigationGroup is one map app's directions links on the detail page.
+type NavigationGroup struct {
+	App   string
+	Links []NavigationLinkView
+}
+
+type NavigationLinkView struct {
+	Mode string
+	URL  string
+}
+
+var navigationAppLabels = map[util.NavigationApp]string{
+	util.NavigationGoogle: "Google マップ",
+	util.NavigationApple:  "Apple マップ",
+	util.NavigationOSM:    "OpenStreetMap",
+}
+
+var navigationModeLabels = map[util.NavigationMode]string{
+	util.NavigationWalking: "徒歩",
+	util.NavigationTransit: "電車",
+	util.NavigationDriving: "車",
+}
+
+func navigationLinks(base *services.Base, rest *services.Restaurant) []util.NavigationLink {
+	if base == nil || rest == nil {
+		return nil
+	}
+	return util.NavigationLinks(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude)
+}
+
+func toNavigationGroups(links []util.NavigationLink) []NavigationGroup {
+	var groups []NavigationGroup
+	for _, link := range links {
+		label := navigationAppLabels[link.App]
+		if len(groups) == 0 || groups[len(groups)-1].App != label {
+			groups = append(groups, NavigationGroup{App: label})
+		}
+		group := &groups[len(groups)-1]
+		group.Links = append(group.Links, NavigationLinkView{Mode: navigationModeLabels[link.Mode], URL: link.URL})
+	}
+	return groups
+}
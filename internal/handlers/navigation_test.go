@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+func TestNavigationLinksNeedBaseAndRestaurant(t *testing.T) {
+	base := &services.Base{Latitude: 34.811, Longitude: 135.562}
+	rest := &services.Restaurant{Latitude: 34.82, Longitude: 135.5}
+	if links := navigationLinks(nil, rest); links != nil {
+		t.Errorf("navigationLinks(nil, rest) = %+v, want nil", links)
+	}
+	if links := navigationLinks(base, nil); links != nil {
+		t.Errorf("navigationLinks(base, nil) = %+v, want nil", links)
+	}
+	if links := navigationLinks(base, rest); len(links) == 0 {
+		t.Error("navigationLinks(base, rest) returned no links")
+	}
+}
+
+func TestToNavigationGroups(t *testing.T) {
+	base := &services.Base{Latitude: 34.811, Longitude: 135.562}
+	rest := &services.Restaurant{Latitude: 34.82, Longitude: 135.5}
+	groups := toNavigationGroups(navigationLinks(base, rest))
+	want := []struct {
+		app   string
+		modes []string
+	}{
+		{"Google マップ", []string{"徒歩", "電車", "車"}},
+		{"Apple マップ", []string{"徒歩", "電車", "車"}},
+		{"OpenStreetMap", []string{"徒歩", "車"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("toNavigationGroups returned %d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for i, group := range groups {
+		if group.App != want[i].app {
+			t.Errorf("group %d app = %q, want %q", i, group.App, want[i].app)
+		}
+		if len(group.Links) != len(want[i].modes) {
+			t.Errorf("group %q has %d links, want %d", group.App, len(group.Links), len(want[i].modes))
+			continue
+		}
+		for j, link := range group.Links {
+			if link.Mode != want[i].modes[j] {
+				t.Errorf("group %q link %d mode = %q, want %q", group.App, j, link.Mode, want[i].modes[j])
+			}
+			if link.URL == "" {
+				t.Errorf("group %q link %d has no URL", group.App, j)
+			}
+		}
+	}
+	if groups := toNavigationGroups(nil); groups != nil {
+		t.Errorf("toNavigationGroups(nil) = %+v, want nil", groups)
+	}
+}
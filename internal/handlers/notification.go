@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+const listedNotifications = 50
+
+type NotificationView struct {
+	ActorName      string
+	RestaurantName string
+	Excerpt        string
+	// URL points at the review the notification is about.
+	URL       string
+	CreatedAt string
+	Read      bool
+}
+
+// Notifications lists the viewer's notifications in the current workspace,
+// latest first.
+func (h *Handler) Notifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	notifications, err := h.notificationService.ListNotifications(session.UserID, listedNotifications)
+	if err != nil {
+		http.Error(w, "notification error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]NotificationView, 0, len(notifications))
+	for _, notification := range notifications {
+		views = append(views, toNotificationView(notification))
+	}
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	selectedBaseID := 0
+	if base != nil {
+		selectedBaseID = base.ID
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedBaseID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Notifications:  views,
+	}
+	h.render(w, "notifications.html", data)
+}
+
+// MarkNotificationsRead marks all of the viewer's notifications in the
+// current workspace read.
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	if err := h.notificationService.MarkAllRead(session.UserID); err != nil {
+		http.Error(w, "notification error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, localPath(r.FormValue("next"), "/notifications"), http.StatusFound)
+}
+
+func toNotificationView(notification services.Notification) NotificationView {
+	return NotificationView{
+		ActorName:      notification.ActorName,
+		RestaurantName: notification.RestaurantName,
+		Excerpt:        notification.Excerpt,
+		URL:            fmt.Sprintf("/restaurants/%d#review-%d", notification.RestaurantID, notification.ReviewID),
+		CreatedAt:      notification.CreatedAt.Local().Format("2006-01-02 15:04"),
+		Read:           notification.Read,
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"example.com/gourmetkan/internal/services"
+)
+
+// isAdmin reports whether the user's GitHub ID is listed in
+// Config.AdminGitHubIDs. Usernames are not trusted, since a GitHub account can
+// be renamed and its old name registered by someone else.
+func (h *Handler) isAdmin(user *services.User) bool {
+	if user == nil || user.GitHubID == "" {
+		return false
+	}
+	for _, githubID := range h.cfg.AdminGitHubIDs {
+		if githubID == user.GitHubID {
+			return true
+		}
+	}
+	return false
+}
+
+// canManageBase reports whether the user may edit, delete or merge the base.
+// Seeded bases have no creator and can only be managed by admins and the
+// workspace owner.
+func (h *Handler) canManageBase(user *services.User, base *services.Base) bool {
+	if user == nil || base == nil {
+		return false
+	}
+	if h.isAdmin(user) || h.isWorkspaceOwner() {
+		return true
+	}
+	return base.CreatedBy != 0 && base.CreatedBy == user.ID
+}
+
+// canManageEvent reports whether the user may edit or delete the event and
+// decide its venue.
+func (h *Handler) canManageEvent(user *services.User, event *services.Event) bool {
+	if user == nil || event == nil {
+		return false
+	}
+	return h.isAdmin(user) || h.isWorkspaceOwner() || event.CreatedBy == user.ID
+}
+
+// canEditCollection reports whether the user may add, reorder, annotate and
+// remove the collection's restaurants.
+func (h *Handler) canEditCollection(user *services.User, collection *services.CollectionDetail) bool {
+	if user == nil || collection == nil {
+		return false
+	}
+	return collection.IsCollaborator(user.ID) || h.canManageCollection(user, &collection.Collection)
+}
+
+// canManageCollection reports whether the user may change the collection's
+// title, visibility and collaborators, or delete it.
+func (h *Handler) canManageCollection(user *services.User, collection *services.Collection) bool {
+	if user == nil || collection == nil {
+		return false
+	}
+	return h.isAdmin(user) || h.isWorkspaceOwner() || collection.OwnerID == user.ID
+}
+
+// canDeleteReply reports whether the user may delete the reply: its author,
+// or an admin or the workspace owner moderating the thread.
+func (h *Handler) canDeleteReply(user *services.User, reply *services.Reply) bool {
+	if user == nil || reply == nil {
+		return false
+	}
+	return h.isAdmin(user) || h.isWorkspaceOwner() || reply.UserID == user.ID
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"testing"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+func TestIsAdminMatchesGitHubID(t *testing.T) {
+	h := &Handler{cfg: Config{AdminGitHubIDs: []string{"1001"}}}
+	tests := []struct {
+		name string
+		user *services.User
+		want bool
+	}{
+		{"listed account", &services.User{ID: 1, GitHubID: "1001", Username: "alice"}, true},
+		{"listed account after a rename", &services.User{ID: 1, GitHubID: "1001", Username: "alice-renamed"}, true},
+		{"another account with the admin's old name", &services.User{ID: 2, GitHubID: "2002", Username: "alice"}, false},
+		{"no github id", &services.User{ID: 3, Username: "1001"}, false},
+		{"logged out", nil, false},
+	}
+	for _, tt := range tests {
+		if got := h.isAdmin(tt.user); got != tt.want {
+			t.Errorf("%s: isAdmin = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanDeleteReply(t *testing.T) {
+	author := &services.User{ID: 1, GitHubID: "1001", Username: "alice"}
+	other := &services.User{ID: 2, GitHubID: "2002", Username: "bob"}
+	admin := &services.User{ID: 3, GitHubID: "3003", Username: "carol"}
+	reply := &services.Reply{ID: 10, UserID: author.ID}
+	tests := []struct {
+		name      string
+		workspace *services.Workspace
+		user      *services.User
+		reply     *services.Reply
+		want      bool
+	}{
+		{"author", &services.Workspace{ID: 2, Role: services.WorkspaceRoleMember}, author, reply, true},
+		{"another member", &services.Workspace{ID: 2, Role: services.WorkspaceRoleMember}, other, reply, false},
+		{"workspace owner", &services.Workspace{ID: 2, Role: services.WorkspaceRoleOwner}, other, reply, true},
+		{"admin", &services.Workspace{ID: 1}, admin, reply, true},
+		{"another user in the public workspace", &services.Workspace{ID: 1}, other, reply, false},
+		{"logged out", &services.Workspace{ID: 1}, nil, reply, false},
+		{"no reply", &services.Workspace{ID: 1}, author, nil, false},
+	}
+	for _, tt := range tests {
+		h := &Handler{cfg: Config{AdminGitHubIDs: []string{admin.GitHubID}}, workspace: tt.workspace}
+		if got := h.canDeleteReply(tt.user, tt.reply); got != tt.want {
+			t.Errorf("%s: canDeleteReply = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+const maxPhotoCaptionLength = 100
+
+// parsePhotoArrangement reads a photo arrangement form: photo ids in display
+// order, the caption for each id and an optional cover photo id.
+func parsePhotoArrangement(r *http.Request) (services.PhotoArrangement, bool) {
+	ids := r.Form["photo_id"]
+	captions := r.Form["caption"]
+	if len(captions) != 0 && len(captions) != len(ids) {
+		return services.PhotoArrangement{}, false
+	}
+	arrangement := services.PhotoArrangement{
+		Order:    make([]int, 0, len(ids)),
+		Captions: make(map[int]string, len(ids)),
+	}
+	for i, raw := range ids {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return services.PhotoArrangement{}, false
+		}
+		arrangement.Order = append(arrangement.Order, id)
+		if len(captions) == 0 {
+			continue
+		}
+		caption := strings.TrimSpace(captions[i])
+		if !util.ValidateOptionalText(caption, maxPhotoCaptionLength) {
+			return services.PhotoArrangement{}, false
+		}
+		arrangement.Captions[id] = caption
+	}
+	if raw := r.FormValue("cover_photo"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return services.PhotoArrangement{}, false
+		}
+		arrangement.CoverID = id
+	}
+	return arrangement, true
+}
+
+// UpdateRestaurantPhotos saves order, captions and the cover photo of a restaurant.
+// Like the rest of restaurant editing it is open to any logged-in member.
+func (h *Handler) UpdateRestaurantPhotos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/photos"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	rest, err := h.restaurantService.GetRestaurant(id)
+	if err != nil || rest == nil {
+		http.NotFound(w, r)
+		return
+	}
+	arrangement, ok := parsePhotoArrangement(r)
+	if !ok {
+		http.Error(w, "invalid photos", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.restaurantService.ArrangeRestaurantPhotos(rest.ID, arrangement); err != nil {
+		writePhotoError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/restaurants/"+strconv.Itoa(rest.ID)+"/edit", http.StatusFound)
+}
+
+// UpdateReviewPhotos saves order and captions of a review's photos. Only the author may do so.
+func (h *Handler) UpdateReviewPhotos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	reviewID, err := extractID(strings.TrimSuffix(r.URL.Path, "/photos"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	review, err := h.reviewService.GetReview(reviewID)
+	if err != nil || review == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if review.UserID != session.UserID {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	arrangement, ok := parsePhotoArrangement(r)
+	if !ok {
+		http.Error(w, "invalid photos", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.reviewService.ArrangeReviewPhotos(review.ID, session.UserID, arrangement); err != nil {
+		writePhotoError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/reviews/"+strconv.Itoa(review.ID)+"/edit", http.StatusFound)
+}
+
+func writePhotoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPhotoOrder):
+		http.Error(w, "invalid photos", http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "photo error", http.StatusInternalServerError)
+	}
+}
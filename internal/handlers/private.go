@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const uploadDir = "static/uploads"
+
+// privateModeMiddleware puts every page behind login when Config.PrivateMode
+// is set. Only the login flow, calendar feeds and the CSS/JS under /static/
+// stay public; uploaded images are not, since /static/uploads/ is served by
+// Upload.
+func (h *Handler) privateModeMiddleware(next http.Handler) http.Handler {
+	if !h.cfg.PrivateMode {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		session, err := h.getSession(r)
+		if err != nil || session == nil {
+			if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/tiles/") || strings.HasPrefix(r.URL.Path, "/static/") {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/auth/github/login", http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isPublicPath(path string) bool {
+	if strings.HasPrefix(path, "/auth/github/") {
+		return true
+	}
+	// Calendar feeds carry their own token since calendar apps cannot log in.
+	if strings.HasPrefix(path, "/calendar/") && strings.HasSuffix(path, ".ics") {
+		return true
+	}
+	return strings.HasPrefix(path, "/static/") && !strings.HasPrefix(path, "/static/uploads/")
+}
+
+// Upload serves an uploaded image. Uploads are kept out of the static file
+// server so private mode can put them behind login; directory listings are
+// never served.
+func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/static/uploads/")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	if h.cfg.PrivateMode {
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+	}
+	http.ServeFile(w, r, filepath.Join(uploadDir, name))
+}
@@ -1,14 +1,59 @@
 package handlers
 
 import (
-	"math/rand"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"example.com/gourmetkan/internal/services"
 	"example.com/gourmetkan/internal/util"
 )
 
+const defaultRandomRadiusKm = 2.0
+
+// RandomPage is the data of the /random page. Form holds the filter as
+// submitted so the form and the re-roll link keep it.
+type RandomPage struct {
+	Form      RandomForm
+	Pick      *RandomPick
+	RerollURL string
+	Exhausted bool
+	// Collections are the collections the viewer can draw from.
+	Collections []CollectionOption
+}
+
+type RandomForm struct {
+	RadiusKm    string
+	IncludeTags map[string]bool
+	ExcludeTags map[string]bool
+	OpenNow     bool
+	MaxBudget   string
+	MinRating   string
+	WantToGo    bool
+	Collection  int
+}
+
+type RandomPick struct {
+	ID           int
+	Name         string
+	Description  string
+	PhotoPath    string
+	Distance     string
+	Tags         []string
+	Average      float64
+	ReviewCount  int
+	Budget       int
+	OpeningHours string
+	// LastVisited is when the viewer last went there, "" if never.
+	LastVisited string
+}
+
+// RandomRestaurant suggests a restaurant near the selected base. The seed and
+// the restaurants already shown travel in the query string, so "もう一回"
+// walks the same weighted sequence without repeating a place.
 func (h *Handler) RandomRestaurant(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -19,31 +64,164 @@ func (h *Handler) RandomRestaurant(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "base error", http.StatusInternalServerError)
 		return
 	}
-	radiusKm := 2.0
-	if value := r.URL.Query().Get("radius_km"); value != "" {
-		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
-			radiusKm = parsed
-		}
+	session, _ := h.getSession(r)
+	query := r.URL.Query()
+
+	filter, form := parseRandomFilter(query)
+	filter.Latitude = base.Latitude
+	filter.Longitude = base.Longitude
+	viewerID := 0
+	if session != nil {
+		viewerID = session.UserID
+		filter.UserID = session.UserID
+	} else {
+		filter.WantToGoOnly = false
+	}
+	collections, err := h.collectionService.ListCollections(viewerID)
+	if err != nil {
+		http.Error(w, "collection error", http.StatusInternalServerError)
+		return
 	}
+	if id, err := strconv.Atoi(query.Get("collection")); err == nil && hasCollection(collections, id) {
+		filter.CollectionID = id
+		form.Collection = id
+	}
+	seed, err := strconv.ParseInt(query.Get("seed"), 10, 64)
+	if err != nil {
+		seed = time.Now().UnixNano()
+	}
+	seen := parseIDList(query.Get("seen"))
 
-	restaurants, err := h.restaurantService.ListRestaurants()
+	candidate, err := h.suggestionService.Suggest(filter, seed, seen)
 	if err != nil {
 		http.Error(w, "restaurant error", http.StatusInternalServerError)
 		return
 	}
+	page := RandomPage{Form: form, Exhausted: candidate == nil && len(seen) > 0, Collections: toCollectionOptions(collections)}
+	if candidate != nil {
+		page.Pick = toRandomPick(*candidate)
+		next := cloneValues(query)
+		next.Set("seed", strconv.FormatInt(seed, 10))
+		next.Set("seen", joinIDs(append(seen, candidate.Restaurant.ID)))
+		page.RerollURL = "/random?" + next.Encode()
+	}
+
+	bases, _ := h.baseService.ListBases()
+	allTags, _ := h.restaurantService.ListTags()
+	var user interface{}
+	if session != nil {
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		AvailableTags:  toTagOptions(allTags),
+		Suggestion:     page,
+	}
+	h.render(w, "random.html", data)
+}
+
+func parseRandomFilter(query url.Values) (services.SuggestionFilter, RandomForm) {
+	filter := services.SuggestionFilter{
+		RadiusKm:    defaultRandomRadiusKm,
+		IncludeTags: nonEmpty(query["tag"]),
+		ExcludeTags: nonEmpty(query["exclude_tag"]),
+	}
+	form := RandomForm{
+		RadiusKm:    query.Get("radius_km"),
+		IncludeTags: toSet(filter.IncludeTags),
+		ExcludeTags: toSet(filter.ExcludeTags),
+		OpenNow:     query.Get("open_now") == "1",
+		MaxBudget:   query.Get("max_budget"),
+		MinRating:   query.Get("min_rating"),
+		WantToGo:    query.Get("want_to_go") == "1",
+	}
+	if parsed, err := strconv.ParseFloat(form.RadiusKm, 64); err == nil && parsed > 0 {
+		filter.RadiusKm = parsed
+	}
+	if form.OpenNow {
+		filter.OpenAt = time.Now()
+	}
+	filter.WantToGoOnly = form.WantToGo
+	if parsed, err := strconv.Atoi(form.MaxBudget); err == nil && parsed > 0 {
+		filter.MaxBudget = parsed
+	}
+	if parsed, err := strconv.ParseFloat(form.MinRating, 64); err == nil && parsed > 0 {
+		filter.MinRating = parsed
+	}
+	return filter, form
+}
 
-	candidates := make([]int, 0)
-	for _, rest := range restaurants {
-		distance := util.HaversineDistanceKm(base.Latitude, base.Longitude, rest.Latitude, rest.Longitude)
-		if distance <= radiusKm {
-			candidates = append(candidates, rest.ID)
+// hasCollection reports whether id is one of the collections, so a filter can
+// only draw from collections the viewer may see.
+func hasCollection(collections []services.Collection, id int) bool {
+	for _, collection := range collections {
+		if collection.ID == id {
+			return true
 		}
 	}
-	if len(candidates) == 0 {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
+	return false
+}
+
+func toRandomPick(candidate services.SuggestionCandidate) *RandomPick {
+	rest := candidate.Restaurant
+	return &RandomPick{
+		ID:           rest.ID,
+		Name:         rest.Name,
+		Description:  rest.Description,
+		PhotoPath:    rest.PhotoPath,
+		Distance:     util.FormatDistanceKm(candidate.DistanceKm),
+		Tags:         candidate.Tags,
+		Average:      math.Round(candidate.Average*10) / 10,
+		ReviewCount:  candidate.ReviewCount,
+		Budget:       rest.Budget,
+		OpeningHours: rest.OpeningHours,
+		LastVisited:  formatLastVisited(candidate.LastVisited, time.Now()),
+	}
+}
+
+func parseIDList(raw string) []int {
+	var ids []int
+	for _, part := range strings.Split(raw, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func joinIDs(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func cloneValues(values url.Values) url.Values {
+	cloned := make(url.Values, len(values))
+	for key, list := range values {
+		cloned[key] = append([]string(nil), list...)
+	}
+	return cloned
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
 	}
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-	picked := candidates[rnd.Intn(len(candidates))]
-	http.Redirect(w, r, "/restaurants/"+strconv.Itoa(picked), http.StatusFound)
+	return set
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per client address. Each client may make burst
+// requests at once and then perSecond requests a second.
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu        sync.Mutex
+	clients   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond, burst float64) *rateLimiter {
+	return &rateLimiter{perSecond: perSecond, burst: burst, clients: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the client's bucket, or reports false when it is
+// empty.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	bucket, ok := l.clients[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.perSecond
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// sweep forgets clients whose buckets have filled up again, so the map only
+// holds recently active clients.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.perSecond * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for client, bucket := range l.clients {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// clientAddress is the address a request came from, without the port.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !limiter.allow("a", now) {
+			t.Fatalf("request %d in the burst was refused", i+1)
+		}
+	}
+	if limiter.allow("a", now) {
+		t.Error("request beyond the burst was allowed")
+	}
+	if !limiter.allow("b", now) {
+		t.Error("another client was refused")
+	}
+	if !limiter.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("request after a refill was refused")
+	}
+	if limiter.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("refill gave more than one token")
+	}
+	if !limiter.allow("a", now.Add(time.Hour)) {
+		t.Error("request after a long pause was refused")
+	}
+	if _, ok := limiter.clients["b"]; ok {
+		t.Error("an idle client with a full bucket was not forgotten")
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	r := httptest.NewRequest("GET", "/tiles/15/1/1.png", nil)
+	r.RemoteAddr = "203.0.113.5:51234"
+	if got := clientAddress(r); got != "203.0.113.5" {
+		t.Errorf("clientAddress = %q, want 203.0.113.5", got)
+	}
+	r.RemoteAddr = "[2001:db8::1]:443"
+	if got := clientAddress(r); got != "2001:db8::1" {
+		t.Errorf("clientAddress = %q, want 2001:db8::1", got)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+// ratingDimensionLabels names each rating dimension on screen.
+var ratingDimensionLabels = map[services.RatingDimension]string{
+	services.DimensionTaste:      "味",
+	services.DimensionValue:      "コスパ",
+	services.DimensionSpeed:      "提供の早さ",
+	services.DimensionAtmosphere: "雰囲気",
+	services.DimensionPortion:    "量",
+}
+
+// ScoreField is one sub-score of a review, for the review forms and for
+// display. Value is 0 when the reviewer skipped it.
+type ScoreField struct {
+	Name  string
+	Label string
+	Value int
+}
+
+// RatingBar is one row of the star distribution histogram.
+type RatingBar struct {
+	Stars   int
+	Count   int
+	Percent int
+}
+
+type DimensionAverage struct {
+	Label   string
+	Average float64
+	Count   int
+	Percent int
+}
+
+type DimensionOption struct {
+	Value string
+	Label string
+}
+
+// scoreFields lists every dimension with the review's score, in display order.
+func scoreFields(scores services.ReviewScores) []ScoreField {
+	fields := make([]ScoreField, 0, len(services.RatingDimensions))
+	for _, dimension := range services.RatingDimensions {
+		fields = append(fields, ScoreField{
+			Name:  "score_" + string(dimension),
+			Label: ratingDimensionLabels[dimension],
+			Value: scores[dimension],
+		})
+	}
+	return fields
+}
+
+// parseReviewScores reads the optional score_<dimension> fields. Empty fields
+// are skipped; anything but 1 to 5 is invalid.
+func parseReviewScores(r *http.Request) (services.ReviewScores, bool) {
+	scores := make(services.ReviewScores)
+	for _, dimension := range services.RatingDimensions {
+		value := r.FormValue("score_" + string(dimension))
+		if value == "" {
+			continue
+		}
+		score, err := strconv.Atoi(value)
+		if err != nil || score < 1 || score > 5 {
+			return nil, false
+		}
+		scores[dimension] = score
+	}
+	return scores, true
+}
+
+// ratingBars turns the distribution into histogram rows from 5 stars down.
+func ratingBars(summary services.RatingSummary) []RatingBar {
+	bars := make([]RatingBar, 0, len(summary.Distribution))
+	for stars := len(summary.Distribution); stars >= 1; stars-- {
+		count := summary.Distribution[stars-1]
+		bar := RatingBar{Stars: stars, Count: count}
+		if summary.Count > 0 {
+			bar.Percent = int(math.Round(float64(count) / float64(summary.Count) * 100))
+		}
+		bars = append(bars, bar)
+	}
+	return bars
+}
+
+func dimensionAverages(summary services.RatingSummary) []DimensionAverage {
+	var averages []DimensionAverage
+	for _, dimension := range services.RatingDimensions {
+		average, ok := summary.Dimensions[dimension]
+		if !ok {
+			continue
+		}
+		averages = append(averages, DimensionAverage{
+			Label:   ratingDimensionLabels[dimension],
+			Average: math.Round(average.Average*10) / 10,
+			Count:   average.Count,
+			Percent: int(math.Round(average.Average / 5 * 100)),
+		})
+	}
+	return averages
+}
+
+func dimensionOptions() []DimensionOption {
+	options := make([]DimensionOption, 0, len(services.RatingDimensions))
+	for _, dimension := range services.RatingDimensions {
+		options = append(options, DimensionOption{Value: string(dimension), Label: ratingDimensionLabels[dimension]})
+	}
+	return options
+}
+
+// scoreLabel names what the index's score column shows: a dimension, or the
+// overall rating when dimension is empty.
+func scoreLabel(dimension services.RatingDimension) string {
+	if dimension == "" {
+		return "総合"
+	}
+	return ratingDimensionLabels[dimension]
+}
+
+// parseMinScore reads the index's minimum score filter; 0 disables it.
+func parseMinScore(value string) float64 {
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil || score < 1 || score > 5 {
+		return 0
+	}
+	return score
+}
+
+// overallAverages returns the overall average of each reviewed restaurant in
+// stats, keyed like ScoreAverages.
+func overallAverages(stats map[int]services.RestaurantStats) map[int]services.ScoreAverage {
+	averages := make(map[int]services.ScoreAverage, len(stats))
+	for id, stat := range stats {
+		if stat.ReviewCount > 0 {
+			averages[id] = services.ScoreAverage{Average: stat.Average, Count: stat.ReviewCount}
+		}
+	}
+	return averages
+}
+
+// filterByScore keeps the restaurants whose average is at least minScore.
+// Restaurants nobody scored are dropped.
+func filterByScore(restaurants []services.Restaurant, averages map[int]services.ScoreAverage, minScore float64) []services.Restaurant {
+	var filtered []services.Restaurant
+	for _, rest := range restaurants {
+		if average, ok := averages[rest.ID]; ok && average.Average >= minScore {
+			filtered = append(filtered, rest)
+		}
+	}
+	return filtered
+}
+
+// sortItemsByScore orders items by rank, best first. Unscored items go last,
+// ordered by straight-line distance like ties.
+func sortItemsByScore(items []RestaurantListItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		left, right := items[i], items[j]
+		if (left.ScoreCount > 0) != (right.ScoreCount > 0) {
+			return left.ScoreCount > 0
+		}
+		if left.Rank != right.Rank {
+			return left.Rank > right.Rank
+		}
+		return left.DistanceKm < right.DistanceKm
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+)
+
+// reactionEmoji is how each emoji reaction is drawn.
+var reactionEmoji = map[services.ReactionKind]string{
+	services.ReactionLike:  "👍",
+	services.ReactionLove:  "❤️",
+	services.ReactionYum:   "😋",
+	services.ReactionLaugh: "😂",
+	services.ReactionWow:   "😮",
+}
+
+// ReactionView is one emoji reaction under a review. Mine reports whether
+// the viewer left it, so the button takes it back.
+type ReactionView struct {
+	Kind  string
+	Emoji string
+	Count int
+	Mine  bool
+}
+
+// SetReviewReaction leaves or takes back one of the viewer's reactions on a
+// review, then goes back to the review.
+func (h *Handler) SetReviewReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/reactions"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	kind, ok := services.ParseReactionKind(r.FormValue("kind"))
+	if !ok {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	review, err := h.reviewService.GetReview(id)
+	if err != nil {
+		http.Error(w, "review error", http.StatusInternalServerError)
+		return
+	}
+	if review == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.reviewService.SetReaction(id, session.UserID, kind, r.FormValue("on") == "1"); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.NotFound(w, r)
+		case services.ErrOwnReviewVote:
+			http.Error(w, "cannot vote own review", http.StatusBadRequest)
+		default:
+			http.Error(w, "update error", http.StatusInternalServerError)
+		}
+		return
+	}
+	fallback := fmt.Sprintf("/restaurants/%d#review-%d", review.RestaurantID, review.ID)
+	http.Redirect(w, r, localPath(r.FormValue("next"), fallback), http.StatusFound)
+}
+
+// reactionViews lists the emoji reactions of a review in display order,
+// including the ones nobody left yet.
+func reactionViews(reactions services.ReviewReactions) []ReactionView {
+	views := make([]ReactionView, 0, len(services.EmojiReactions))
+	for _, kind := range services.EmojiReactions {
+		views = append(views, ReactionView{
+			Kind:  string(kind),
+			Emoji: reactionEmoji[kind],
+			Count: reactions.Counts[kind],
+			Mine:  reactions.Mine[kind],
+		})
+	}
+	return views
+}
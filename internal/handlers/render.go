@@ -3,31 +3,75 @@ package handlers
 import (
 	"bytes"
 	"html/template"
+	"log"
 	"net/http"
 	"path/filepath"
 )
 
 type TemplateData struct {
-	Bases          []BaseOption
-	SelectedBaseID int
-	User           interface{}
-	CSRFToken      string
-	Restaurants    interface{}
-	Restaurant     interface{}
-	Review         interface{}
-	Reviews        interface{}
-	Errors         map[string]string
-	Notice         string
-	RadiusKm       float64
-	PresetTags     []string
-	SelectedTags   []string
-	SelectedTagSet map[string]bool
-	TagInput       string
-	AvailableTags  []TagOption
-	SelectedTag    string
+	Bases             []BaseOption
+	SelectedBaseID    int
+	User              interface{}
+	CSRFToken         string
+	Restaurants       interface{}
+	Restaurant        interface{}
+	Review            interface{}
+	Reviews           interface{}
+	Errors            map[string]string
+	Notice            string
+	RadiusKm          float64
+	PresetTags        []string
+	SelectedTags      []string
+	SelectedTagSet    map[string]bool
+	TagInput          string
+	AvailableTags     []TagOption
+	SelectedTag       string
+	SelectedList      string
+	Photos            interface{}
+	Users             interface{}
+	SelectedUserID    int
+	Profile           interface{}
+	PrevURL           string
+	NextURL           string
+	GeocodeCandidates []GeocodeCandidate
+	Sort              string
+	// Dimension and MinScore are the index's rating filter as submitted;
+	// ScoreLabel names the score each restaurant shows.
+	Dimension  string
+	MinScore   string
+	Dimensions []DimensionOption
+	ScoreLabel string
+	Map        interface{}
+	Base       interface{}
+	BaseList   interface{}
+	// Workspaces and SelectedWorkspaceID are filled in by render.
+	Workspaces          []WorkspaceOption
+	SelectedWorkspaceID int
+	WorkspacePage       interface{}
+	Suggestion          interface{}
+	Lunch               interface{}
+	Event               interface{}
+	Train               interface{}
+	Lists               interface{}
+	Collection          interface{}
+	History             interface{}
+	Notifications       interface{}
+	// UnreadNotifications is filled in by render for logged-in viewers.
+	UnreadNotifications int
 }
 
 func (h *Handler) render(w http.ResponseWriter, name string, data TemplateData) {
+	if h.workspace != nil {
+		data.Workspaces = h.workspaceOptions()
+		data.SelectedWorkspaceID = h.workspace.ID
+	}
+	if h.viewerID != 0 && h.notificationService != nil {
+		unread, err := h.notificationService.UnreadCount(h.viewerID)
+		if err != nil {
+			log.Printf("count unread notifications: %v", err)
+		}
+		data.UnreadNotifications = unread
+	}
 	if h.templates == nil {
 		h.templates = make(map[string]*template.Template)
 	}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+// ReplyView is one reply in the thread under a review.
+type ReplyView struct {
+	ID        int
+	UserID    int
+	Username  string
+	Body      string
+	CreatedAt string
+	Edited    bool
+	CanEdit   bool
+	CanDelete bool
+}
+
+func (h *Handler) ReplyRouter(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/update") {
+		h.UpdateReply(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/delete") {
+		h.DeleteReply(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// CreateReply adds the viewer's reply to a review's thread and notifies the
+// review's author.
+func (h *Handler) CreateReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	reviewID, err := extractID(strings.TrimSuffix(r.URL.Path, "/replies"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body := strings.TrimSpace(r.FormValue("body"))
+	if !util.ValidateRequiredText(body, 1, 1000) {
+		http.Error(w, "invalid reply", http.StatusBadRequest)
+		return
+	}
+	review, err := h.reviewService.GetReview(reviewID)
+	if err != nil {
+		http.Error(w, "review error", http.StatusInternalServerError)
+		return
+	}
+	if review == nil {
+		http.NotFound(w, r)
+		return
+	}
+	replyID, err := h.reviewService.CreateReply(services.Reply{ReviewID: reviewID, UserID: session.UserID, Body: body})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/restaurants/%d#reply-%d", review.RestaurantID, replyID), http.StatusFound)
+}
+
+// UpdateReply lets the author of a reply rewrite it.
+func (h *Handler) UpdateReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/update"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	reply, err := h.reviewService.GetReply(id)
+	if err != nil || reply == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if reply.UserID != session.UserID {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	body := strings.TrimSpace(r.FormValue("body"))
+	if !util.ValidateRequiredText(body, 1, 1000) {
+		http.Error(w, "invalid reply", http.StatusBadRequest)
+		return
+	}
+	if err := h.reviewService.UpdateReply(id, body); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "update error", http.StatusInternalServerError)
+		return
+	}
+	h.redirectToReply(w, r, reply.ReviewID, fmt.Sprintf("reply-%d", id))
+}
+
+// DeleteReply removes a reply. Its author and the workspace's moderators may
+// delete it.
+func (h *Handler) DeleteReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, "/delete"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	reply, err := h.reviewService.GetReply(id)
+	if err != nil || reply == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, _ := h.userService.GetUserByID(session.UserID)
+	if !h.canDeleteReply(user, reply) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if err := h.reviewService.DeleteReply(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "delete error", http.StatusInternalServerError)
+		return
+	}
+	h.redirectToReply(w, r, reply.ReviewID, fmt.Sprintf("review-%d", reply.ReviewID))
+}
+
+// redirectToReply goes back to the anchor on the page of the review's
+// restaurant.
+func (h *Handler) redirectToReply(w http.ResponseWriter, r *http.Request, reviewID int, anchor string) {
+	review, err := h.reviewService.GetReview(reviewID)
+	if err != nil || review == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	fallback := fmt.Sprintf("/restaurants/%d#%s", review.RestaurantID, anchor)
+	http.Redirect(w, r, localPath(r.FormValue("next"), fallback), http.StatusFound)
+}
+
+// replyViews turns a review's thread into its views for the viewer, who may
+// be nil when logged out.
+func (h *Handler) replyViews(replies []services.Reply, viewer *services.User) []ReplyView {
+	views := make([]ReplyView, 0, len(replies))
+	for _, reply := range replies {
+		reply := reply
+		views = append(views, ReplyView{
+			ID:        reply.ID,
+			UserID:    reply.UserID,
+			Username:  reply.Username,
+			Body:      reply.Body,
+			CreatedAt: reply.CreatedAt.Local().Format("2006-01-02 15:04"),
+			Edited:    reply.Edited,
+			CanEdit:   viewer != nil && viewer.ID == reply.UserID,
+			CanDelete: h.canDeleteReply(viewer, &reply),
+		})
+	}
+	return views
+}
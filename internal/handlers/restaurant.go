@@ -20,38 +20,95 @@ type RestaurantDetail struct {
 	Description    string
 	PhotoPath      string
 	PhotoPaths     []string
+	Photos         []services.Photo
 	Address        string
 	MapsURL        string
 	Latitude       float64
 	Longitude      float64
 	Distance       string
+	WalkingTime    string
+	CyclingTime    string
+	RouteDistance  string
+	RouteEstimated bool
+	Navigation     []NavigationGroup
 	Tags           []string
 	Average        float64
 	ReviewCount    int
 	AveragePercent int
 	CanEdit        bool
+	// Budget is kept as entered so an invalid value can be shown again.
+	Budget       string
+	OpeningHours string
+	// Favorite and WantToGo are the viewer's marks.
+	Favorite bool
+	WantToGo bool
+	// Collections are the viewer's collections it can be added to.
+	Collections []CollectionOption
+	// RatingBars is the star histogram, Dimensions the averages of the
+	// dimensions anyone scored, and ScoreFields the review form's fields.
+	RatingBars  []RatingBar
+	Dimensions  []DimensionAverage
+	ScoreFields []ScoreField
+	// Visits and LastVisited sum up the viewer's check-ins here. Companions
+	// are the users the check-in form offers, and Today bounds its date.
+	Visits      int
+	LastVisited string
+	Companions  []UserOption
+	Today       string
+	// ReviewOrder is how the reviews are sorted: "newest" or "helpful".
+	ReviewOrder string
 }
 
 type RestaurantListItem struct {
-	ID          int
-	Name        string
-	Description string
-	PhotoPath   string
-	DistanceKm  float64
-	Distance    string
-	Tags        []string
+	ID              int
+	Name            string
+	Description     string
+	PhotoPath       string
+	DistanceKm      float64
+	Distance        string
+	WalkingDuration time.Duration
+	CyclingDuration time.Duration
+	WalkingTime     string
+	CyclingTime     string
+	RouteEstimated  bool
+	Tags            []string
+	// Favorite and WantToGo are the viewer's marks.
+	Favorite bool
+	WantToGo bool
+	// LastVisited is when the viewer last went there, "" if never.
+	LastVisited string
+	// Score and ScoreCount are the average and number of scores in the
+	// rating dimension the index is showing, else of the overall rating.
+	Score      float64
+	ScoreCount int
+	// Rank orders the items when sorting by rating: the ranking score for
+	// the overall rating, else Score.
+	Rank float64
 }
 
 type ReviewDisplay struct {
 	ID            int
 	RestaurantID  int
+	UserID        int
 	Username      string
 	Rating        int
 	RatingPercent int
-	Comment       string
-	PhotoPath     string
-	PhotoPaths    []string
-	CanManage     bool
+	// Scores lists every dimension; skipped ones have Value 0.
+	Scores     []ScoreField
+	Comment    string
+	PhotoPath  string
+	PhotoPaths []string
+	Photos     []services.Photo
+	CanManage  bool
+	// Helpful counts the helpful votes and HelpfulMine reports the
+	// viewer's. CanVote is false for anonymous viewers and the author.
+	Helpful     int
+	HelpfulMine bool
+	CanVote     bool
+	Reactions   []ReactionView
+	// ReplyCount counts the replies in the thread under the review.
+	ReplyCount int
+	Replies    []ReplyView
 }
 
 var presetTags = []string{"ラーメン", "居酒屋", "寿司", "焼肉", "カフェ", "定食", "中華", "イタリアン", "カレー"}
@@ -106,7 +163,9 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 	lngStr := strings.TrimSpace(r.FormValue("longitude"))
 	selectedTags := r.Form["tags"]
 	freeform := strings.TrimSpace(r.FormValue("tag_input"))
-	photoPaths, photoErr := util.SaveUploadedImages(r, "photos", "static/uploads", util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
+	budgetInput := strings.TrimSpace(r.FormValue("budget"))
+	openingHours := strings.TrimSpace(r.FormValue("opening_hours"))
+	photoPaths, photoErr := util.SaveUploadedImages(r, "photos", uploadDir, util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
 	photoPath := ""
 	if len(photoPaths) > 0 {
 		photoPath = photoPaths[0]
@@ -122,6 +181,13 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 	if !util.ValidateOptionalText(address, 200) {
 		errors["address"] = "住所は200文字以内で入力してください。"
 	}
+	budget, budgetOK := parseBudget(budgetInput)
+	if !budgetOK {
+		errors["budget"] = "予算は1〜100000の整数（円）で入力してください。"
+	}
+	if !validOpeningHours(openingHours) {
+		errors["opening_hours"] = "営業時間は「月-金 11:00-14:00,17:00-22:00; 土 11:00-15:00」の形式で入力してください。"
+	}
 	if photoErr != nil {
 		errors["photo"] = "画像は5MB以内の JPG/PNG/GIF/WebP を指定してください。"
 	}
@@ -152,7 +218,7 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 	if mapsURL != "" {
 		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 		defer cancel()
-		expanded, err := util.ExpandShortURL(ctx, mapsURL)
+		expanded, err := h.mapLinkService.Expand(ctx, mapsURL)
 		if err == nil {
 			mapsURL = expanded
 		}
@@ -161,11 +227,30 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 			longitude = loc.Longitude
 			locationSet = true
 		}
+		// Coordinate text (DMS, plus codes, geo: URIs) has been read above; only web links are kept.
+		if !isWebURL(mapsURL) {
+			mapsURL = ""
+		}
 	}
 
+	var geocodeCandidates []GeocodeCandidate
+	if !locationSet && !latProvided && !lngProvided {
+		if lat, lng, ok := pickedGeocodeCandidate(r); ok {
+			latitude = lat
+			longitude = lng
+			locationSet = true
+		} else {
+			geocodeCandidates = h.geocodeAddress(r.Context(), address)
+		}
+	}
 	if !locationSet {
-		errors["latitude"] = "緯度経度が取得できませんでした。"
+		if len(geocodeCandidates) > 0 {
+			errors["latitude"] = "住所から位置の候補が見つかりました。正しい候補を選んでください。"
+		} else {
+			errors["latitude"] = "緯度経度が取得できませんでした。"
+		}
 	}
+
 	parsedTags := make([]string, 0)
 	for _, tag := range selectedTags {
 		parsedTags = append(parsedTags, normalizeTagName(tag))
@@ -182,6 +267,11 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Only coordinates were given, so fill in the address from them.
+	if locationSet && address == "" && len(errors) == 0 {
+		address = h.reverseGeocode(r.Context(), latitude, longitude)
+	}
+
 	if len(errors) > 0 {
 		_ = util.DeleteUploadedImages(photoPaths)
 		bases, _ := h.baseService.ListBases()
@@ -199,40 +289,45 @@ func (h *Handler) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 			CSRFToken:      csrfTokenOrEmpty(session),
 			Errors:         errors,
 			Restaurant: RestaurantDetail{
-				Name:        name,
-				Description: description,
-				Address:     address,
-				MapsURL:     mapsURL,
-				Latitude:    latitude,
-				Longitude:   longitude,
-				PhotoPath:   photoPath,
-				PhotoPaths:  photoPaths,
+				Name:         name,
+				Description:  description,
+				Address:      address,
+				MapsURL:      mapsURL,
+				Latitude:     latitude,
+				Longitude:    longitude,
+				PhotoPath:    photoPath,
+				PhotoPaths:   photoPaths,
+				Budget:       budgetInput,
+				OpeningHours: openingHours,
 			},
-			PresetTags:     presetTags,
-			AvailableTags:  toTagOptionsExcludingPreset(allTags, presetTags),
-			SelectedTagSet: selectedSet,
-			TagInput:       freeform,
+			PresetTags:        presetTags,
+			AvailableTags:     toTagOptionsExcludingPreset(allTags, presetTags),
+			SelectedTagSet:    selectedSet,
+			TagInput:          freeform,
+			GeocodeCandidates: geocodeCandidates,
 		}
 		h.render(w, "restaurants_new.html", data)
 		return
 	}
 
 	createdID, err := h.restaurantService.CreateRestaurant(services.Restaurant{
-		Name:        name,
-		Description: description,
-		PhotoPath:   photoPath,
-		Latitude:    latitude,
-		Longitude:   longitude,
-		Address:     address,
-		MapsURL:     mapsURL,
-		CreatedBy:   session.UserID,
+		Name:         name,
+		Description:  description,
+		PhotoPath:    photoPath,
+		Latitude:     latitude,
+		Longitude:    longitude,
+		Address:      address,
+		MapsURL:      mapsURL,
+		CreatedBy:    session.UserID,
+		Budget:       budget,
+		OpeningHours: openingHours,
 	})
 	if err != nil {
 		_ = util.DeleteUploadedImages(photoPaths)
 		http.Error(w, "create error", http.StatusInternalServerError)
 		return
 	}
-	if err := h.restaurantService.ReplaceRestaurantPhotos(createdID, photoPaths); err != nil {
+	if err := h.restaurantService.ReplaceRestaurantPhotos(createdID, session.UserID, photoPaths); err != nil {
 		_ = util.DeleteUploadedImages(photoPaths)
 		http.Error(w, "create error", http.StatusInternalServerError)
 		return
@@ -282,18 +377,34 @@ func (h *Handler) RestaurantDetail(w http.ResponseWriter, r *http.Request) {
 	}
 	limit := 20
 	offset := (page - 1) * limit
-	reviews, err := h.reviewService.ListReviews(rest.ID, limit, offset)
+	viewerID := 0
+	if session != nil {
+		viewerID = session.UserID
+	}
+	reviewOrder := services.ParseReviewOrder(r.URL.Query().Get("reviews"))
+	reviews, err := h.reviewService.ListReviews(rest.ID, viewerID, reviewOrder, limit, offset)
+	if err != nil {
+		http.Error(w, "review error", http.StatusInternalServerError)
+		return
+	}
+	photosByReview, err := h.reviewService.PhotosForReviews(reviews)
+	if err != nil {
+		http.Error(w, "review error", http.StatusInternalServerError)
+		return
+	}
+	repliesByReview, err := h.reviewService.RepliesForReviews(reviews)
 	if err != nil {
 		http.Error(w, "review error", http.StatusInternalServerError)
 		return
 	}
+	var viewer *services.User
+	if session != nil {
+		viewer, _ = h.userService.GetUserByID(session.UserID)
+	}
 	reviewDisplays := make([]ReviewDisplay, 0, len(reviews))
 	for _, review := range reviews {
-		reviewPhotoPaths, err := h.reviewService.ListReviewPhotos(review.ID)
-		if err != nil {
-			http.Error(w, "review error", http.StatusInternalServerError)
-			return
-		}
+		reviewPhotos := photosByReview[review.ID]
+		reviewPhotoPaths := services.PhotoPaths(reviewPhotos)
 		reviewPhotoPath := ""
 		if len(reviewPhotoPaths) > 0 {
 			reviewPhotoPath = reviewPhotoPaths[0]
@@ -301,20 +412,30 @@ func (h *Handler) RestaurantDetail(w http.ResponseWriter, r *http.Request) {
 		reviewDisplays = append(reviewDisplays, ReviewDisplay{
 			ID:            review.ID,
 			RestaurantID:  review.RestaurantID,
+			UserID:        review.UserID,
 			Username:      review.Username,
 			Rating:        review.Rating,
 			RatingPercent: review.Rating * 20,
+			Scores:        scoreFields(review.Scores),
 			Comment:       review.Comment,
 			PhotoPath:     reviewPhotoPath,
 			PhotoPaths:    reviewPhotoPaths,
+			Photos:        reviewPhotos,
 			CanManage:     session != nil && session.UserID == review.UserID,
+			Helpful:       review.Reactions.Counts[services.ReactionHelpful],
+			HelpfulMine:   review.Reactions.Mine[services.ReactionHelpful],
+			CanVote:       session != nil && session.UserID != review.UserID,
+			Reactions:     reactionViews(review.Reactions),
+			ReplyCount:    review.ReplyCount,
+			Replies:       h.replyViews(repliesByReview[review.ID], viewer),
 		})
 	}
-	avgRating, reviewCount, err := h.reviewService.AverageRating(rest.ID)
+	summary, err := h.reviewService.RatingSummary(rest.ID)
 	if err != nil {
 		http.Error(w, "review error", http.StatusInternalServerError)
 		return
 	}
+	avgRating, reviewCount := summary.Average, summary.Count
 	starAverage := math.Round(avgRating*2) / 2
 	tagRows, err := h.restaurantService.TagsForRestaurant(rest.ID)
 	if err != nil {
@@ -325,20 +446,55 @@ func (h *Handler) RestaurantDetail(w http.ResponseWriter, r *http.Request) {
 	for _, tag := range tagRows {
 		tagNames = append(tagNames, tag.Name)
 	}
-	restaurantPhotoPaths, err := h.restaurantService.ListRestaurantPhotos(rest.ID)
+	restaurantPhotos, err := h.restaurantService.ListRestaurantPhotoDetails(rest.ID)
 	if err != nil {
 		http.Error(w, "restaurant error", http.StatusInternalServerError)
 		return
 	}
+	restaurantPhotoPaths := services.PhotoPaths(restaurantPhotos)
 	restaurantPhotoPath := ""
 	if len(restaurantPhotoPaths) > 0 {
 		restaurantPhotoPath = restaurantPhotoPaths[0]
 	}
+	travelTime := h.travelTimes(r, base, []services.Restaurant{*rest})[rest.ID]
+	walkingTime, cyclingTime := formatTravelTime(travelTime)
+	routeDistance := ""
+	if travelTime.Walking.Found && travelTime.Walking.DistanceKm > 0 {
+		routeDistance = util.FormatDistanceKm(travelTime.Walking.DistanceKm)
+	}
+
+	var marks services.RestaurantMarks
+	var collections []services.Collection
+	if session != nil {
+		viewerMarks, err := h.markService.Marks(session.UserID)
+		if err != nil {
+			http.Error(w, "list error", http.StatusInternalServerError)
+			return
+		}
+		marks = viewerMarks[rest.ID]
+		collections, _ = h.collectionService.ListEditableCollections(session.UserID)
+	}
+	var visit services.RestaurantVisits
+	var companions []UserOption
+	if session != nil {
+		visits, err := h.checkinService.VisitsByRestaurant(session.UserID)
+		if err != nil {
+			http.Error(w, "history error", http.StatusInternalServerError)
+			return
+		}
+		for _, v := range visits {
+			if v.RestaurantID == rest.ID {
+				visit = v
+			}
+		}
+		users, _ := h.userService.ListUsers()
+		companions = toCompanionOptions(users, session.UserID)
+	}
 
 	bases, _ := h.baseService.ListBases()
 	var user interface{}
-	if session != nil {
-		user, _ = h.userService.GetUserByID(session.UserID)
+	if viewer != nil {
+		user = viewer
 	}
 	detail := RestaurantDetail{
 		ID:             rest.ID,
@@ -346,16 +502,35 @@ func (h *Handler) RestaurantDetail(w http.ResponseWriter, r *http.Request) {
 		Description:    rest.Description,
 		PhotoPath:      restaurantPhotoPath,
 		PhotoPaths:     restaurantPhotoPaths,
+		Photos:         restaurantPhotos,
 		Address:        rest.Address,
 		MapsURL:        rest.MapsURL,
 		Latitude:       rest.Latitude,
 		Longitude:      rest.Longitude,
 		Distance:       util.FormatDistanceKm(distanceKm),
+		WalkingTime:    walkingTime,
+		CyclingTime:    cyclingTime,
+		RouteDistance:  routeDistance,
+		RouteEstimated: travelTime.Walking.Estimated || travelTime.Cycling.Estimated,
+		Navigation:     toNavigationGroups(navigationLinks(base, rest)),
 		Tags:           tagNames,
 		Average:        avgRating,
 		ReviewCount:    reviewCount,
 		AveragePercent: int(math.Round(starAverage / 5 * 100)),
 		CanEdit:        session != nil,
+		Budget:         budgetString(rest.Budget),
+		OpeningHours:   rest.OpeningHours,
+		Favorite:       marks.Favorite,
+		WantToGo:       marks.WantToGo,
+		Collections:    toCollectionOptions(collections),
+		RatingBars:     ratingBars(summary),
+		Dimensions:     dimensionAverages(summary),
+		ScoreFields:    scoreFields(nil),
+		Visits:         visit.Count,
+		LastVisited:    formatLastVisited(visit.LastVisited, time.Now()),
+		Companions:     companions,
+		Today:          time.Now().Format("2006-01-02"),
+		ReviewOrder:    string(reviewOrder),
 	}
 	data := TemplateData{
 		Bases:          toBaseOptions(bases),
@@ -392,7 +567,8 @@ func (h *Handler) EditRestaurant(w http.ResponseWriter, r *http.Request) {
 	allTags, _ := h.restaurantService.ListTags()
 	user, _ := h.userService.GetUserByID(session.UserID)
 	tagRows, _ := h.restaurantService.TagsForRestaurant(rest.ID)
-	restaurantPhotoPaths, _ := h.restaurantService.ListRestaurantPhotos(rest.ID)
+	restaurantPhotos, _ := h.restaurantService.ListRestaurantPhotoDetails(rest.ID)
+	restaurantPhotoPaths := services.PhotoPaths(restaurantPhotos)
 	restaurantPhotoPath := ""
 	if len(restaurantPhotoPaths) > 0 {
 		restaurantPhotoPath = restaurantPhotoPaths[0]
@@ -407,15 +583,18 @@ func (h *Handler) EditRestaurant(w http.ResponseWriter, r *http.Request) {
 		User:           user,
 		CSRFToken:      csrfTokenOrEmpty(session),
 		Restaurant: RestaurantDetail{
-			ID:          rest.ID,
-			Name:        rest.Name,
-			Description: rest.Description,
-			PhotoPath:   restaurantPhotoPath,
-			PhotoPaths:  restaurantPhotoPaths,
-			Address:     rest.Address,
-			MapsURL:     rest.MapsURL,
-			Latitude:    rest.Latitude,
-			Longitude:   rest.Longitude,
+			ID:           rest.ID,
+			Name:         rest.Name,
+			Description:  rest.Description,
+			PhotoPath:    restaurantPhotoPath,
+			PhotoPaths:   restaurantPhotoPaths,
+			Photos:       restaurantPhotos,
+			Address:      rest.Address,
+			MapsURL:      rest.MapsURL,
+			Latitude:     rest.Latitude,
+			Longitude:    rest.Longitude,
+			Budget:       budgetString(rest.Budget),
+			OpeningHours: rest.OpeningHours,
 		},
 		PresetTags:     presetTags,
 		AvailableTags:  toTagOptionsExcludingPreset(allTags, presetTags),
@@ -460,6 +639,8 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	lngStr := strings.TrimSpace(r.FormValue("longitude"))
 	selectedTags := r.Form["tags"]
 	freeform := strings.TrimSpace(r.FormValue("tag_input"))
+	budgetInput := strings.TrimSpace(r.FormValue("budget"))
+	openingHours := strings.TrimSpace(r.FormValue("opening_hours"))
 	existingPhotoPaths, err := h.restaurantService.ListRestaurantPhotos(rest.ID)
 	if err != nil {
 		http.Error(w, "update error", http.StatusInternalServerError)
@@ -468,7 +649,7 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	photoPaths := append([]string(nil), existingPhotoPaths...)
 	removePhoto := r.FormValue("remove_photo") == "1"
 	removeSelected := r.Form["remove_photos"]
-	newPhotoPaths, photoErr := util.SaveUploadedImages(r, "photos", "static/uploads", util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
+	newPhotoPaths, photoErr := util.SaveUploadedImages(r, "photos", uploadDir, util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
 	if removePhoto {
 		removeSelected = photoPaths
 	}
@@ -504,6 +685,13 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	if !util.ValidateOptionalText(address, 200) {
 		errors["address"] = "住所は200文字以内で入力してください。"
 	}
+	budget, budgetOK := parseBudget(budgetInput)
+	if !budgetOK {
+		errors["budget"] = "予算は1〜100000の整数（円）で入力してください。"
+	}
+	if !validOpeningHours(openingHours) {
+		errors["opening_hours"] = "営業時間は「月-金 11:00-14:00,17:00-22:00; 土 11:00-15:00」の形式で入力してください。"
+	}
 	if photoErr != nil {
 		errors["photo"] = "画像は5MB以内の JPG/PNG/GIF/WebP を指定してください。"
 	}
@@ -536,7 +724,7 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	if mapsURL != "" {
 		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 		defer cancel()
-		expanded, err := util.ExpandShortURL(ctx, mapsURL)
+		expanded, err := h.mapLinkService.Expand(ctx, mapsURL)
 		if err == nil {
 			mapsURL = expanded
 		}
@@ -545,8 +733,24 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 			longitude = loc.Longitude
 			locationSet = true
 		}
+		// Coordinate text (DMS, plus codes, geo: URIs) has been read above; only web links are kept.
+		if !isWebURL(mapsURL) {
+			mapsURL = ""
+		}
 	}
-	if !locationSet {
+
+	// Clearing both coordinates with no map link asks for the address to be geocoded again.
+	var geocodeCandidates []GeocodeCandidate
+	if !latProvided && !lngProvided && strings.TrimSpace(r.FormValue("maps_url")) == "" {
+		if lat, lng, ok := pickedGeocodeCandidate(r); ok {
+			latitude = lat
+			longitude = lng
+		} else if geocodeCandidates = h.geocodeAddress(r.Context(), address); len(geocodeCandidates) > 0 {
+			locationSet = false
+			errors["latitude"] = "住所から位置の候補が見つかりました。正しい候補を選んでください。"
+		}
+	}
+	if !locationSet && len(geocodeCandidates) == 0 {
 		errors["latitude"] = "緯度経度が取得できませんでした。"
 	}
 
@@ -566,6 +770,11 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Only coordinates were given, so fill in the address from them.
+	if locationSet && address == "" && len(errors) == 0 {
+		address = h.reverseGeocode(r.Context(), latitude, longitude)
+	}
+
 	if len(errors) > 0 {
 		_ = util.DeleteUploadedImages(newPhotoPaths)
 		base, _ := h.getSelectedBase(r)
@@ -583,34 +792,39 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 			CSRFToken:      csrfTokenOrEmpty(session),
 			Errors:         errors,
 			Restaurant: RestaurantDetail{
-				ID:          rest.ID,
-				Name:        name,
-				Description: description,
-				PhotoPath:   photoPath,
-				PhotoPaths:  photoPaths,
-				Address:     address,
-				MapsURL:     mapsURL,
-				Latitude:    latitude,
-				Longitude:   longitude,
+				ID:           rest.ID,
+				Name:         name,
+				Description:  description,
+				PhotoPath:    photoPath,
+				PhotoPaths:   photoPaths,
+				Address:      address,
+				MapsURL:      mapsURL,
+				Latitude:     latitude,
+				Longitude:    longitude,
+				Budget:       budgetInput,
+				OpeningHours: openingHours,
 			},
-			PresetTags:     presetTags,
-			AvailableTags:  toTagOptionsExcludingPreset(allTags, presetTags),
-			SelectedTagSet: selectedSet,
-			TagInput:       freeform,
+			PresetTags:        presetTags,
+			AvailableTags:     toTagOptionsExcludingPreset(allTags, presetTags),
+			SelectedTagSet:    selectedSet,
+			TagInput:          freeform,
+			GeocodeCandidates: geocodeCandidates,
 		}
 		h.render(w, "restaurants_edit.html", data)
 		return
 	}
 
 	if err := h.restaurantService.UpdateRestaurant(services.Restaurant{
-		ID:          rest.ID,
-		Name:        name,
-		Description: description,
-		PhotoPath:   photoPath,
-		Latitude:    latitude,
-		Longitude:   longitude,
-		Address:     address,
-		MapsURL:     mapsURL,
+		ID:           rest.ID,
+		Name:         name,
+		Description:  description,
+		PhotoPath:    photoPath,
+		Latitude:     latitude,
+		Longitude:    longitude,
+		Address:      address,
+		MapsURL:      mapsURL,
+		Budget:       budget,
+		OpeningHours: openingHours,
 	}); err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
@@ -619,7 +833,7 @@ func (h *Handler) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "update error", http.StatusInternalServerError)
 		return
 	}
-	if err := h.restaurantService.ReplaceRestaurantPhotos(rest.ID, photoPaths); err != nil {
+	if err := h.restaurantService.ReplaceRestaurantPhotos(rest.ID, session.UserID, photoPaths); err != nil {
 		_ = util.DeleteUploadedImages(newPhotoPaths)
 		http.Error(w, "update error", http.StatusInternalServerError)
 		return
@@ -728,12 +942,17 @@ func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid rating", http.StatusBadRequest)
 		return
 	}
+	scores, ok := parseReviewScores(r)
+	if !ok {
+		http.Error(w, "invalid score", http.StatusBadRequest)
+		return
+	}
 	comment := strings.TrimSpace(r.FormValue("comment"))
 	if !util.ValidateRequiredText(comment, 1, 1000) {
 		http.Error(w, "invalid comment", http.StatusBadRequest)
 		return
 	}
-	photoPaths, photoErr := util.SaveUploadedImages(r, "photos", "static/uploads", util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
+	photoPaths, photoErr := util.SaveUploadedImages(r, "photos", uploadDir, util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
 	photoPath := ""
 	if len(photoPaths) > 0 {
 		photoPath = photoPaths[0]
@@ -746,6 +965,7 @@ func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
 		RestaurantID: id,
 		UserID:       session.UserID,
 		Rating:       rating,
+		Scores:       scores,
 		Comment:      comment,
 		PhotoPath:    photoPath,
 	})
@@ -811,7 +1031,8 @@ func (h *Handler) EditReview(w http.ResponseWriter, r *http.Request) {
 			PhotoPaths:   review.PhotoPaths,
 		},
 	}
-	reviewPhotoPaths, _ := h.reviewService.ListReviewPhotos(review.ID)
+	reviewPhotos, _ := h.reviewService.ListReviewPhotoDetails(review.ID)
+	reviewPhotoPaths := services.PhotoPaths(reviewPhotos)
 	reviewPhotoPath := ""
 	if len(reviewPhotoPaths) > 0 {
 		reviewPhotoPath = reviewPhotoPaths[0]
@@ -822,9 +1043,11 @@ func (h *Handler) EditReview(w http.ResponseWriter, r *http.Request) {
 		ID:           review.ID,
 		RestaurantID: review.RestaurantID,
 		Rating:       review.Rating,
+		Scores:       scoreFields(review.Scores),
 		Comment:      review.Comment,
 		PhotoPath:    reviewPhotoPath,
 		PhotoPaths:   reviewPhotoPaths,
+		Photos:       reviewPhotos,
 	}
 	h.render(w, "reviews_edit.html", data)
 }
@@ -871,6 +1094,11 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid rating", http.StatusBadRequest)
 		return
 	}
+	scores, ok := parseReviewScores(r)
+	if !ok {
+		http.Error(w, "invalid score", http.StatusBadRequest)
+		return
+	}
 	comment := strings.TrimSpace(r.FormValue("comment"))
 	existingPhotoPaths, err := h.reviewService.ListReviewPhotos(review.ID)
 	if err != nil {
@@ -900,7 +1128,7 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 	if len(photoPaths) > 0 {
 		photoPath = photoPaths[0]
 	}
-	newPhotoPaths, photoErr := util.SaveUploadedImages(r, "photos", "static/uploads", util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
+	newPhotoPaths, photoErr := util.SaveUploadedImages(r, "photos", uploadDir, util.DefaultMaxUploadBytes, util.DefaultMaxUploadFiles)
 	photoPaths = append(photoPaths, newPhotoPaths...)
 	if len(photoPaths) > 0 {
 		photoPath = photoPaths[0]
@@ -935,6 +1163,7 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 				ID:           review.ID,
 				RestaurantID: review.RestaurantID,
 				Rating:       rating,
+				Scores:       scoreFields(scores),
 				Comment:      comment,
 				PhotoPath:    photoPath,
 				PhotoPaths:   photoPaths,
@@ -948,6 +1177,7 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 		ID:        review.ID,
 		UserID:    session.UserID,
 		Rating:    rating,
+		Scores:    scores,
 		Comment:   comment,
 		PhotoPath: photoPath,
 	}); err != nil {
@@ -1033,3 +1263,33 @@ func extractID(path string) (int, error) {
 	}
 	return strconv.Atoi(parts[1])
 }
+
+// parseBudget reads the optional per-person budget in yen; empty means unknown.
+func parseBudget(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	budget, err := strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+	if err != nil || budget < 1 || budget > 100000 {
+		return 0, false
+	}
+	return budget, true
+}
+
+func budgetString(budget int) string {
+	if budget == 0 {
+		return ""
+	}
+	return strconv.Itoa(budget)
+}
+
+func validOpeningHours(value string) bool {
+	if value == "" {
+		return true
+	}
+	if !util.ValidateOptionalText(value, 200) {
+		return false
+	}
+	_, err := util.ParseOpeningHours(value)
+	return err == nil
+}
@@ -10,6 +10,22 @@ func (h *Handler) RestaurantRouter(w http.ResponseWriter, r *http.Request) {
 		h.CreateReview(w, r)
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, "/photos") {
+		h.UpdateRestaurantPhotos(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/checkins") {
+		h.CreateCheckin(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/collections") {
+		h.AddToCollection(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/marks") {
+		h.SetRestaurantMark(w, r)
+		return
+	}
 	if strings.HasSuffix(r.URL.Path, "/edit") {
 		h.EditRestaurant(w, r)
 		return
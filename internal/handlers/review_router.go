@@ -6,6 +6,10 @@ import (
 )
 
 func (h *Handler) ReviewRouter(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/photos") {
+		h.UpdateReviewPhotos(w, r)
+		return
+	}
 	if strings.HasSuffix(r.URL.Path, "/edit") {
 		h.EditReview(w, r)
 		return
@@ -18,5 +22,13 @@ func (h *Handler) ReviewRouter(w http.ResponseWriter, r *http.Request) {
 		h.DeleteReview(w, r)
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, "/reactions") {
+		h.SetReviewReaction(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/replies") {
+		h.CreateReply(w, r)
+		return
+	}
 	http.NotFound(w, r)
 }
@@ -1,59 +1,175 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"html/template"
 	"net/http"
 	"time"
 
 	"example.com/gourmetkan/internal/auth"
+	"example.com/gourmetkan/internal/geocode"
+	"example.com/gourmetkan/internal/pubsub"
 	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/tiles"
 )
 
 type Config struct {
 	BaseURL      string
 	CookieSecure bool
 	SessionTTL   time.Duration
+	// MapAttribution is shown on the map for the configured tile source.
+	MapAttribution string
+	// AdminGitHubIDs lists the GitHub account IDs allowed to manage every
+	// base.
+	AdminGitHubIDs []string
+	// PrivateMode requires login for every page and uploaded image.
+	PrivateMode bool
 }
 
 type Router struct {
-	mux *http.ServeMux
+	mux      *http.ServeMux
+	handlers *Handler
+	handler  http.Handler
 }
 
-func NewRouter(cfg Config, authService *auth.Service, baseService *services.BaseService, restaurantService *services.RestaurantService, reviewService *services.ReviewService, userService *services.UserService, db *sql.DB) http.Handler {
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// CloseLunches closes lunch sessions at their deadlines and pushes the result
+// to their pages until ctx is done. The caller runs it in a goroutine.
+func (r *Router) CloseLunches(ctx context.Context) {
+	r.handlers.closeLunches(ctx)
+}
+
+// Services are what the handlers read and write through. Every field is
+// required except Geocoder and TravelTime.
+type Services struct {
+	Auth         *auth.Service
+	Base         *services.BaseService
+	Restaurant   *services.RestaurantService
+	Review       *services.ReviewService
+	User         *services.UserService
+	Gallery      *services.GalleryService
+	MapLink      *services.MapLinkService
+	Geocoder     geocode.Geocoder
+	TravelTime   *services.TravelTimeService
+	Tiles        *tiles.Source
+	Workspace    *services.WorkspaceService
+	Suggestion   *services.SuggestionService
+	Lunch        *services.LunchService
+	Event        *services.EventService
+	Train        *services.TrainService
+	Mark         *services.MarkService
+	Collection   *services.CollectionService
+	Checkin      *services.CheckinService
+	Notification *services.NotificationService
+	DB           *sql.DB
+}
+
+func NewRouter(cfg Config, deps Services) *Router {
 	r := &Router{mux: http.NewServeMux()}
 	handlers := &Handler{
-		cfg:               cfg,
-		authService:       authService,
-		baseService:       baseService,
-		restaurantService: restaurantService,
-		reviewService:     reviewService,
-		userService:       userService,
-		db:                db,
+		cfg:                 cfg,
+		authService:         deps.Auth,
+		baseService:         deps.Base,
+		restaurantService:   deps.Restaurant,
+		reviewService:       deps.Review,
+		userService:         deps.User,
+		galleryService:      deps.Gallery,
+		mapLinkService:      deps.MapLink,
+		geocoder:            deps.Geocoder,
+		travelTimeService:   deps.TravelTime,
+		tileSource:          deps.Tiles,
+		workspaceService:    deps.Workspace,
+		suggestionService:   deps.Suggestion,
+		lunchService:        deps.Lunch,
+		eventService:        deps.Event,
+		trainService:        deps.Train,
+		markService:         deps.Mark,
+		collectionService:   deps.Collection,
+		checkinService:      deps.Checkin,
+		notificationService: deps.Notification,
+		hub:                 pubsub.NewHub(),
+		lunchWake:           make(chan struct{}, 1),
+		tileLimiter:         newRateLimiter(tileRequestsPerSecond, tileRequestBurst),
+		db:                  deps.DB,
+		templates:           make(map[string]*template.Template),
 	}
-	r.mux.HandleFunc("/", handlers.Index)
+	scoped := handlers.scoped
+	r.mux.HandleFunc("/", scoped((*Handler).Index))
 	r.mux.HandleFunc("/auth/github/login", handlers.GitHubLogin)
 	r.mux.HandleFunc("/auth/github/callback", handlers.GitHubCallback)
 	r.mux.HandleFunc("/auth/logout", handlers.Logout)
-	r.mux.HandleFunc("/bases/select", handlers.SelectBase)
-	r.mux.HandleFunc("/bases/new", handlers.NewBase)
-	r.mux.HandleFunc("/bases", handlers.CreateBase)
-	r.mux.HandleFunc("/restaurants/new", handlers.NewRestaurant)
-	r.mux.HandleFunc("/restaurants", handlers.CreateRestaurant)
-	r.mux.HandleFunc("/restaurants/", handlers.RestaurantRouter)
-	r.mux.HandleFunc("/reviews/", handlers.ReviewRouter)
-	r.mux.HandleFunc("/random", handlers.RandomRestaurant)
+	r.mux.HandleFunc("/bases/select", scoped((*Handler).SelectBase))
+	r.mux.HandleFunc("/bases/new", scoped((*Handler).NewBase))
+	r.mux.HandleFunc("/bases", scoped((*Handler).BaseRouter))
+	r.mux.HandleFunc("/bases/", scoped((*Handler).BaseRouter))
+	r.mux.HandleFunc("/restaurants/new", scoped((*Handler).NewRestaurant))
+	r.mux.HandleFunc("/restaurants", scoped((*Handler).CreateRestaurant))
+	r.mux.HandleFunc("/restaurants/", scoped((*Handler).RestaurantRouter))
+	r.mux.HandleFunc("/reviews/", scoped((*Handler).ReviewRouter))
+	r.mux.HandleFunc("/replies/", scoped((*Handler).ReplyRouter))
+	r.mux.HandleFunc("/notifications", scoped((*Handler).Notifications))
+	r.mux.HandleFunc("/notifications/read", scoped((*Handler).MarkNotificationsRead))
+	r.mux.HandleFunc("/random", scoped((*Handler).RandomRestaurant))
+	r.mux.HandleFunc("/lunch", scoped((*Handler).LunchRouter))
+	r.mux.HandleFunc("/lunch/", scoped((*Handler).LunchRouter))
+	r.mux.HandleFunc("/events", scoped((*Handler).EventRouter))
+	r.mux.HandleFunc("/events/", scoped((*Handler).EventRouter))
+	r.mux.HandleFunc("/trains", scoped((*Handler).TrainRouter))
+	r.mux.HandleFunc("/trains/", scoped((*Handler).TrainRouter))
+	r.mux.HandleFunc("/calendar/", handlers.CalendarRouter)
+	r.mux.HandleFunc("/lists", scoped((*Handler).MyLists))
+	r.mux.HandleFunc("/collections", scoped((*Handler).CollectionRouter))
+	r.mux.HandleFunc("/collections/", scoped((*Handler).CollectionRouter))
+	r.mux.HandleFunc("/history", scoped((*Handler).History))
+	r.mux.HandleFunc("/checkins/", scoped((*Handler).DeleteCheckin))
+	r.mux.HandleFunc("/photos", scoped((*Handler).Gallery))
+	r.mux.HandleFunc("/users/", scoped((*Handler).UserDetail))
+	r.mux.HandleFunc("/api/restaurants/", scoped((*Handler).RestaurantAPI))
+	r.mux.HandleFunc("/api/restaurants.geojson", scoped((*Handler).RestaurantsGeoJSON))
+	r.mux.HandleFunc("/map", scoped((*Handler).MapView))
+	r.mux.HandleFunc("/workspaces", scoped((*Handler).WorkspaceRouter))
+	r.mux.HandleFunc("/workspaces/", scoped((*Handler).WorkspaceRouter))
+	r.mux.HandleFunc("/invites/", scoped((*Handler).Invite))
+	r.mux.HandleFunc("/tiles/", handlers.Tile)
+	r.mux.HandleFunc("/static/uploads/", handlers.Upload)
 	r.mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-	return securityHeadersMiddleware(r.mux)
+	r.handlers = handlers
+	r.handler = securityHeadersMiddleware(handlers.privateModeMiddleware(r.mux))
+	return r
 }
 
 type Handler struct {
-	cfg               Config
-	authService       *auth.Service
-	baseService       *services.BaseService
-	restaurantService *services.RestaurantService
-	reviewService     *services.ReviewService
-	userService       *services.UserService
-	db                *sql.DB
-	templates         map[string]*template.Template
+	cfg                 Config
+	authService         *auth.Service
+	baseService         *services.BaseService
+	restaurantService   *services.RestaurantService
+	reviewService       *services.ReviewService
+	userService         *services.UserService
+	galleryService      *services.GalleryService
+	mapLinkService      *services.MapLinkService
+	geocoder            geocode.Geocoder
+	travelTimeService   *services.TravelTimeService
+	tileSource          *tiles.Source
+	workspaceService    *services.WorkspaceService
+	suggestionService   *services.SuggestionService
+	lunchService        *services.LunchService
+	eventService        *services.EventService
+	trainService        *services.TrainService
+	markService         *services.MarkService
+	collectionService   *services.CollectionService
+	checkinService      *services.CheckinService
+	notificationService *services.NotificationService
+	hub                 *pubsub.Hub
+	lunchWake           chan struct{}
+	tileLimiter         *rateLimiter
+	db                  *sql.DB
+	templates           map[string]*template.Template
+
+	// Set on the per-request copies made by scoped.
+	workspace *services.Workspace
+	viewerID  int
 }
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+// maxTrainLead is how far ahead a lunch train may be announced.
+const maxTrainLead = 12 * time.Hour
+
+// TrainPage is the data of the lunch train board.
+type TrainPage struct {
+	Trains        []TrainView
+	Restaurants   []RestaurantOption
+	Form          TrainForm
+	ExpiryMinutes int
+}
+
+type TrainView struct {
+	ID             int
+	RestaurantID   int
+	RestaurantName string
+	CreatorName    string
+	Departs        string
+	ExpiresISO     string
+	Note           string
+	Riders         []string
+	Joined         bool
+	IsCreator      bool
+}
+
+type TrainForm struct {
+	RestaurantID int
+	Departs      string
+	Note         string
+}
+
+// trainStateJSON is sent on the board's event stream after every change.
+type trainStateJSON struct {
+	Trains []services.Train `json:"trains"`
+}
+
+func (h *Handler) TrainRouter(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/trains" && r.Method == http.MethodGet:
+		h.TrainBoard(w, r)
+	case path == "/trains":
+		h.CreateTrain(w, r)
+	case path == "/trains/events":
+		h.TrainEvents(w, r)
+	case strings.HasSuffix(path, "/join"):
+		h.JoinTrain(w, r)
+	case strings.HasSuffix(path, "/leave"):
+		h.LeaveTrain(w, r)
+	case strings.HasSuffix(path, "/cancel"):
+		h.CancelTrain(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) TrainBoard(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.getSession(r)
+	form := TrainForm{Departs: defaultTrainDeparture(time.Now())}
+	if id, err := strconv.Atoi(r.URL.Query().Get("restaurant_id")); err == nil {
+		form.RestaurantID = id
+	}
+	h.renderTrainBoard(w, r, session, form, nil)
+}
+
+func (h *Handler) renderTrainBoard(w http.ResponseWriter, r *http.Request, session *SessionInfo, form TrainForm, errors map[string]string) {
+	trains, err := h.trainService.ListTrains()
+	if err != nil {
+		http.Error(w, "train error", http.StatusInternalServerError)
+		return
+	}
+	viewerID := 0
+	var user interface{}
+	if session != nil {
+		viewerID = session.UserID
+		user, _ = h.userService.GetUserByID(session.UserID)
+	}
+	page := TrainPage{Form: form, ExpiryMinutes: int(services.TrainExpiry / time.Minute)}
+	for _, train := range trains {
+		page.Trains = append(page.Trains, toTrainView(train, viewerID))
+	}
+	if session != nil {
+		restaurants, _ := h.restaurantService.ListRestaurants()
+		page.Restaurants = toRestaurantOptions(restaurants)
+	}
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: base.ID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		Errors:         errors,
+		Train:          page,
+	}
+	h.render(w, "trains.html", data)
+}
+
+func (h *Handler) CreateTrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+
+	form := TrainForm{
+		Departs: strings.TrimSpace(r.FormValue("departs")),
+		Note:    strings.TrimSpace(r.FormValue("note")),
+	}
+	errors := map[string]string{}
+	restaurantID, err := strconv.Atoi(r.FormValue("restaurant_id"))
+	if err != nil {
+		errors["restaurant_id"] = "お店を選んでください。"
+	}
+	form.RestaurantID = restaurantID
+	now := time.Now()
+	departsAt, ok := parseTrainDeparture(form.Departs, now)
+	if !ok {
+		errors["departs"] = "出発時刻は「12:10」の形式で、これから12時間以内を入力してください。"
+	}
+	if !util.ValidateOptionalText(form.Note, 100) {
+		errors["note"] = "ひとことは100文字以内で入力してください。"
+	}
+	if len(errors) > 0 {
+		h.renderTrainBoard(w, r, session, form, errors)
+		return
+	}
+
+	if _, err := h.trainService.CreateTrain(restaurantID, session.UserID, departsAt, form.Note); err != nil {
+		if err == sql.ErrNoRows {
+			h.renderTrainBoard(w, r, session, form, map[string]string{"restaurant_id": "お店を選んでください。"})
+			return
+		}
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	h.publishTrains()
+	http.Redirect(w, r, "/trains", http.StatusFound)
+}
+
+func (h *Handler) JoinTrain(w http.ResponseWriter, r *http.Request) {
+	h.changeTrain(w, r, "/join", h.trainService.Join)
+}
+
+func (h *Handler) LeaveTrain(w http.ResponseWriter, r *http.Request) {
+	h.changeTrain(w, r, "/leave", h.trainService.Leave)
+}
+
+func (h *Handler) CancelTrain(w http.ResponseWriter, r *http.Request) {
+	h.changeTrain(w, r, "/cancel", h.trainService.Cancel)
+}
+
+func (h *Handler) changeTrain(w http.ResponseWriter, r *http.Request, suffix string, change func(trainID, userID int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, suffix))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := change(id, session.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "update error", http.StatusInternalServerError)
+		return
+	}
+	h.publishTrains()
+	http.Redirect(w, r, "/trains", http.StatusFound)
+}
+
+// TrainEvents streams the workspace's board whenever a train is announced,
+// joined, left or cancelled. Expiry is left to the page, which knows when
+// each train leaves the board.
+func (h *Handler) TrainEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.workspace == nil {
+		http.NotFound(w, r)
+		return
+	}
+	trains, err := h.trainService.ListTrains()
+	if err != nil {
+		http.Error(w, "train error", http.StatusInternalServerError)
+		return
+	}
+	topic := trainTopic(h.workspace.ID)
+	initial, err := jsonEvent(topic, "trains", trainStateJSON{Trains: trains})
+	if err != nil {
+		http.Error(w, "train error", http.StatusInternalServerError)
+		return
+	}
+	h.streamEvents(w, r, topic, initial)
+}
+
+// publishTrains sends the current board to everyone watching it.
+func (h *Handler) publishTrains() {
+	if h.workspace == nil {
+		return
+	}
+	trains, err := h.trainService.ListTrains()
+	if err != nil {
+		return
+	}
+	h.publishJSON(trainTopic(h.workspace.ID), "trains", trainStateJSON{Trains: trains})
+}
+
+func trainTopic(workspaceID int) string {
+	return fmt.Sprintf("trains:%d", workspaceID)
+}
+
+func toTrainView(train services.Train, viewerID int) TrainView {
+	view := TrainView{
+		ID:             train.ID,
+		RestaurantID:   train.RestaurantID,
+		RestaurantName: train.RestaurantName,
+		CreatorName:    train.CreatorName,
+		Departs:        train.DepartsAt.Local().Format("15:04"),
+		ExpiresISO:     train.ExpiresAt().UTC().Format(time.RFC3339),
+		Note:           train.Note,
+		IsCreator:      viewerID != 0 && train.CreatedBy == viewerID,
+	}
+	for _, rider := range train.Riders {
+		view.Riders = append(view.Riders, rider.Username)
+		if viewerID != 0 && rider.UserID == viewerID {
+			view.Joined = true
+		}
+	}
+	return view
+}
+
+// parseTrainDeparture reads "12:10" as the next such time from now, allowing
+// a few minutes in the past for a train that is just leaving.
+func parseTrainDeparture(value string, now time.Time) (time.Time, bool) {
+	clock, err := time.ParseInLocation("15:04", value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now = now.Local()
+	departsAt := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if departsAt.Before(now.Add(-5 * time.Minute)) {
+		departsAt = departsAt.AddDate(0, 0, 1)
+	}
+	if departsAt.After(now.Add(maxTrainLead)) {
+		return time.Time{}, false
+	}
+	return departsAt, true
+}
+
+// defaultTrainDeparture suggests ten minutes from now, rounded up to five.
+func defaultTrainDeparture(now time.Time) string {
+	departs := now.Local().Add(10 * time.Minute)
+	if rest := departs.Minute() % 5; rest != 0 {
+		departs = departs.Add(time.Duration(5-rest) * time.Minute)
+	}
+	return departs.Format("15:04")
+}
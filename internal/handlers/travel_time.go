@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+// travelTimeTimeout bounds looking up travel times during a page render. Each
+// routing provider call has its own shorter timeout, so routes that do not
+// arrive in time still fall back to the estimate.
+const travelTimeTimeout = 3 * time.Second
+
+const (
+	sortByDistance = "distance"
+	sortByWalking  = "walking"
+	sortByCycling  = "cycling"
+	// sortByRating orders by the ranking score, or by the average of the
+	// chosen rating dimension.
+	sortByRating = "rating"
+)
+
+// travelTimes looks up routes from base. Failures only hide the travel times.
+func (h *Handler) travelTimes(r *http.Request, base *services.Base, restaurants []services.Restaurant) map[int]services.TravelTime {
+	if h.travelTimeService == nil || base == nil || len(restaurants) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), travelTimeTimeout)
+	defer cancel()
+	travelTimes, err := h.travelTimeService.TravelTimes(ctx, *base, restaurants)
+	if err != nil {
+		log.Printf("travel times: %v", err)
+		return nil
+	}
+	return travelTimes
+}
+
+func formatTravelTime(travelTime services.TravelTime) (walking, cycling string) {
+	if travelTime.Walking.Found {
+		walking = "徒歩" + util.FormatMinutes(travelTime.Walking.Duration)
+	}
+	if travelTime.Cycling.Found {
+		cycling = "自転車" + util.FormatMinutes(travelTime.Cycling.Duration)
+	}
+	return walking, cycling
+}
+
+func parseSort(value string) string {
+	switch value {
+	case sortByWalking, sortByCycling, sortByRating:
+		return value
+	default:
+		return sortByDistance
+	}
+}
+
+// sortRestaurantItems orders items by the chosen key. Items without a route for
+// that mode go last, ordered by straight-line distance.
+func sortRestaurantItems(items []RestaurantListItem, by string) {
+	if by == sortByRating {
+		sortItemsByScore(items)
+		return
+	}
+	key := func(item RestaurantListItem) (time.Duration, bool) {
+		switch by {
+		case sortByWalking:
+			return item.WalkingDuration, item.WalkingTime != ""
+		case sortByCycling:
+			return item.CyclingDuration, item.CyclingTime != ""
+		}
+		return 0, false
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		left, leftOK := key(items[i])
+		right, rightOK := key(items[j])
+		if leftOK != rightOK {
+			return leftOK
+		}
+		if leftOK && left != right {
+			return left < right
+		}
+		return items[i].DistanceKm < items[j].DistanceKm
+	})
+}
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/services"
+	"example.com/gourmetkan/internal/util"
+)
+
+const workspaceInviteTTL = 7 * 24 * time.Hour
+
+type WorkspaceOption struct {
+	ID   int
+	Name string
+}
+
+// WorkspacePage is the data of the workspace management page.
+type WorkspacePage struct {
+	Workspaces []services.Workspace
+	Current    *services.Workspace
+	IsOwner    bool
+	Members    []services.WorkspaceMember
+	Invites    []WorkspaceInviteView
+}
+
+type WorkspaceInviteView struct {
+	URL       string
+	ExpiresAt string
+}
+
+// scoped wraps a handler method so it runs on a copy of the handler whose
+// services only see the request's workspace. Handlers never get unscoped
+// services, which see no data at all.
+func (h *Handler) scoped(fn func(*Handler, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fn(h.forRequest(r), w, r)
+	}
+}
+
+func (h *Handler) forRequest(r *http.Request) *Handler {
+	viewerID := 0
+	if session, _ := h.getSession(r); session != nil {
+		viewerID = session.UserID
+	}
+	workspace := h.currentWorkspace(r, viewerID)
+	workspaceID := 0
+	if workspace != nil {
+		workspaceID = workspace.ID
+	}
+	scoped := *h
+	scoped.workspace = workspace
+	scoped.viewerID = viewerID
+	scoped.baseService = h.baseService.InWorkspace(workspaceID)
+	scoped.restaurantService = h.restaurantService.InWorkspace(workspaceID)
+	scoped.reviewService = h.reviewService.InWorkspace(workspaceID)
+	scoped.userService = h.userService.InWorkspace(workspaceID)
+	scoped.galleryService = h.galleryService.InWorkspace(workspaceID)
+	if h.travelTimeService != nil {
+		scoped.travelTimeService = h.travelTimeService.InWorkspace(workspaceID)
+	}
+	scoped.suggestionService = h.suggestionService.InWorkspace(workspaceID)
+	scoped.lunchService = h.lunchService.InWorkspace(workspaceID)
+	scoped.eventService = h.eventService.InWorkspace(workspaceID)
+	scoped.trainService = h.trainService.InWorkspace(workspaceID)
+	scoped.markService = h.markService.InWorkspace(workspaceID)
+	scoped.collectionService = h.collectionService.InWorkspace(workspaceID)
+	scoped.checkinService = h.checkinService.InWorkspace(workspaceID)
+	scoped.notificationService = h.notificationService.InWorkspace(workspaceID)
+	return &scoped
+}
+
+// currentWorkspace picks the workspace from the cookie when the viewer may use
+// it, else the first workspace they belong to, else the public pool.
+func (h *Handler) currentWorkspace(r *http.Request, viewerID int) *services.Workspace {
+	if cookie, err := r.Cookie(workspaceCookieName); err == nil {
+		if id, err := strconv.Atoi(cookie.Value); err == nil {
+			workspace, err := h.workspaceService.GetWorkspace(id, viewerID)
+			if err != nil {
+				log.Printf("get workspace: %v", err)
+			}
+			if workspace != nil {
+				return workspace
+			}
+		}
+	}
+	workspaces, err := h.workspaceService.ListWorkspaces(viewerID)
+	if err != nil {
+		log.Printf("list workspaces: %v", err)
+		return nil
+	}
+	for i := range workspaces {
+		if workspaces[i].Role != "" {
+			return &workspaces[i]
+		}
+	}
+	if len(workspaces) > 0 {
+		return &workspaces[0]
+	}
+	return nil
+}
+
+func (h *Handler) workspaceOptions() []WorkspaceOption {
+	workspaces, err := h.workspaceService.ListWorkspaces(h.viewerID)
+	if err != nil {
+		return nil
+	}
+	options := make([]WorkspaceOption, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		options = append(options, WorkspaceOption{ID: workspace.ID, Name: workspace.Name})
+	}
+	return options
+}
+
+func (h *Handler) isWorkspaceOwner() bool {
+	return h.workspace != nil && h.workspace.Role == services.WorkspaceRoleOwner
+}
+
+func (h *Handler) setWorkspaceCookie(w http.ResponseWriter, workspaceID int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     workspaceCookieName,
+		Value:    strconv.Itoa(workspaceID),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   h.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) WorkspaceRouter(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/workspaces" {
+		if r.Method == http.MethodGet {
+			h.ListWorkspaces(w, r)
+			return
+		}
+		h.CreateWorkspace(w, r)
+		return
+	}
+	if r.URL.Path == "/workspaces/select" {
+		h.SelectWorkspace(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/invites") {
+		h.CreateWorkspaceInvite(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/members/remove") {
+		h.RemoveWorkspaceMember(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (h *Handler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	workspaces, err := h.workspaceService.ListWorkspaces(session.UserID)
+	if err != nil {
+		http.Error(w, "failed to load workspaces", http.StatusInternalServerError)
+		return
+	}
+	page := WorkspacePage{Workspaces: workspaces, Current: h.workspace, IsOwner: h.isWorkspaceOwner()}
+	if h.workspace != nil && !h.workspace.IsPublic {
+		page.Members, _ = h.workspaceService.ListMembers(h.workspace.ID)
+	}
+	if page.IsOwner {
+		invites, _ := h.workspaceService.ListInvites(h.workspace.ID)
+		for _, invite := range invites {
+			page.Invites = append(page.Invites, WorkspaceInviteView{
+				URL:       h.inviteURL(invite.Token),
+				ExpiresAt: invite.ExpiresAt.Local().Format("2006-01-02 15:04"),
+			})
+		}
+	}
+
+	bases, _ := h.baseService.ListBases()
+	base, _ := h.getSelectedBase(r)
+	user, _ := h.userService.GetUserByID(session.UserID)
+	selectedID := 0
+	if base != nil {
+		selectedID = base.ID
+	}
+	data := TemplateData{
+		Bases:          toBaseOptions(bases),
+		SelectedBaseID: selectedID,
+		User:           user,
+		CSRFToken:      csrfTokenOrEmpty(session),
+		WorkspacePage:  page,
+	}
+	h.render(w, "workspaces.html", data)
+}
+
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if !util.ValidateRequiredText(name, 1, 100) {
+		http.Error(w, "invalid name", http.StatusBadRequest)
+		return
+	}
+	copyBasesFrom := 0
+	if h.workspace != nil {
+		copyBasesFrom = h.workspace.ID
+	}
+	workspaceID, err := h.workspaceService.CreateWorkspace(name, session.UserID, copyBasesFrom)
+	if err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	h.setWorkspaceCookie(w, workspaceID)
+	http.Redirect(w, r, "/workspaces", http.StatusFound)
+}
+
+// SelectWorkspace switches the workspace. Anonymous visitors can only pick
+// public workspaces, which GetWorkspace enforces.
+func (h *Handler) SelectWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	session, _ := h.getSession(r)
+	if session != nil {
+		if !h.verifyCSRF(r, session) {
+			http.Error(w, "invalid csrf", http.StatusForbidden)
+			return
+		}
+	}
+	workspaceID, err := strconv.Atoi(r.FormValue("workspace_id"))
+	if err != nil {
+		http.Error(w, "invalid workspace", http.StatusBadRequest)
+		return
+	}
+	workspace, err := h.workspaceService.GetWorkspace(workspaceID, h.viewerID)
+	if err != nil || workspace == nil {
+		http.Error(w, "invalid workspace", http.StatusBadRequest)
+		return
+	}
+	h.setWorkspaceCookie(w, workspace.ID)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (h *Handler) CreateWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	workspace, ok := h.ownedWorkspace(w, r, session, "/invites")
+	if !ok {
+		return
+	}
+	if _, err := h.workspaceService.CreateInvite(workspace.ID, session.UserID, workspaceInviteTTL); err != nil {
+		http.Error(w, "create error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/workspaces", http.StatusFound)
+}
+
+func (h *Handler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := h.requireLogin(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !h.verifyCSRF(r, session) {
+		http.Error(w, "invalid csrf", http.StatusForbidden)
+		return
+	}
+	workspace, ok := h.ownedWorkspace(w, r, session, "/members/remove")
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "invalid user", http.StatusBadRequest)
+		return
+	}
+	if err := h.workspaceService.RemoveMember(workspace.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "remove error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/workspaces", http.StatusFound)
+}
+
+// ownedWorkspace loads the workspace named in the path and checks that the
+// user owns it, writing the error response when not.
+func (h *Handler) ownedWorkspace(w http.ResponseWriter, r *http.Request, session *SessionInfo, suffix string) (*services.Workspace, bool) {
+	id, err := extractID(strings.TrimSuffix(r.URL.Path, suffix))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	workspace, err := h.workspaceService.GetWorkspace(id, session.UserID)
+	if err != nil || workspace == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if workspace.Role != services.WorkspaceRoleOwner {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return workspace, true
+}
+
+// Invite shows an invite link (GET) and joins its workspace (POST). The page
+// is readable before logging in so the link can be opened from chat.
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, "/invites/"), "/")
+	invite, err := h.workspaceService.GetInvite(token)
+	if err != nil {
+		http.Error(w, "failed to load invite", http.StatusInternalServerError)
+		return
+	}
+	if invite == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		session, _ := h.getSession(r)
+		var user *services.User
+		if session != nil {
+			user, _ = h.userService.GetUserByID(session.UserID)
+		}
+		bases, _ := h.baseService.ListBases()
+		base, _ := h.getSelectedBase(r)
+		selectedID := 0
+		if base != nil {
+			selectedID = base.ID
+		}
+		data := TemplateData{
+			Bases:          toBaseOptions(bases),
+			SelectedBaseID: selectedID,
+			User:           user,
+			CSRFToken:      csrfTokenOrEmpty(session),
+			WorkspacePage:  invite,
+		}
+		h.render(w, "invite.html", data)
+	case http.MethodPost:
+		session, ok := h.requireLogin(w, r)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if !h.verifyCSRF(r, session) {
+			http.Error(w, "invalid csrf", http.StatusForbidden)
+			return
+		}
+		workspaceID, err := h.workspaceService.AcceptInvite(token, session.UserID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, "join error", http.StatusInternalServerError)
+			return
+		}
+		h.setWorkspaceCookie(w, workspaceID)
+		http.Redirect(w, r, "/", http.StatusFound)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) inviteURL(token string) string {
+	return strings.TrimRight(h.cfg.BaseURL, "/") + "/invites/" + token
+}
@@ -0,0 +1,114 @@
+// Package ical writes iCalendar (RFC 5545) files with VEVENT entries, enough
+// for calendar apps to import a download or subscribe to a feed.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest a content line may be before it is folded.
+const maxLineOctets = 75
+
+const timeFormat = "20060102T150405Z"
+
+type Calendar struct {
+	// ProductID identifies the application, e.g. "-//gourmetkan//events//JA".
+	ProductID string
+	// Name is shown by calendar apps for subscribed feeds.
+	Name   string
+	Events []Event
+}
+
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Updated     time.Time
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+	// Cancelled marks the event STATUS:CANCELLED so subscribers drop it.
+	Cancelled bool
+}
+
+// Write encodes the calendar. Times are written in UTC.
+func (c Calendar) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(out, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", escapeText(c.ProductID))
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	for _, event := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(event.UID))
+		stamp := event.Updated
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		line("DTSTAMP", formatTime(stamp))
+		line("DTSTART", formatTime(event.Start))
+		if !event.End.IsZero() {
+			line("DTEND", formatTime(event.End))
+		}
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		if event.Cancelled {
+			line("STATUS", "CANCELLED")
+		} else {
+			line("STATUS", "CONFIRMED")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return out.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// escapeText escapes a TEXT value: backslashes, semicolons, commas and
+// newlines.
+func escapeText(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(value)
+}
+
+// writeLine writes a content line with CRLF, folding it so that no physical
+// line is longer than 75 octets. Folds never split a UTF-8 sequence.
+func writeLine(w *bufio.Writer, content string) {
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", content[:cut])
+		content = content[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = maxLineOctets - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", content)
+}
@@ -0,0 +1,33 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStatus(t *testing.T) {
+	start := time.Date(2026, 12, 20, 10, 0, 0, 0, time.UTC)
+	calendar := Calendar{
+		ProductID: "-//gourmetkan//events//JA",
+		Events: []Event{
+			{UID: "event-1@example.com", Start: start, Summary: "忘年会"},
+			{UID: "event-2@example.com", Start: start, Summary: "歓迎会", Cancelled: true},
+		},
+	}
+	var out bytes.Buffer
+	if err := calendar.Write(&out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	events := strings.Split(out.String(), "BEGIN:VEVENT\r\n")[1:]
+	if len(events) != 2 {
+		t.Fatalf("wrote %d events, want 2:\n%s", len(events), out.String())
+	}
+	if !strings.Contains(events[0], "STATUS:CONFIRMED\r\n") {
+		t.Errorf("first event is not confirmed:\n%s", events[0])
+	}
+	if !strings.Contains(events[1], "UID:event-2@example.com\r\n") || !strings.Contains(events[1], "STATUS:CANCELLED\r\n") {
+		t.Errorf("second event is not cancelled:\n%s", events[1])
+	}
+}
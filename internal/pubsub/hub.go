@@ -0,0 +1,79 @@
+// Package pubsub is an in-process publish/subscribe hub. Features publish
+// events to named topics, and long-lived requests such as Server-Sent Events
+// streams subscribe to the topics they show.
+package pubsub
+
+import "sync"
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// further events to it are dropped.
+const subscriberBuffer = 16
+
+// Event is one message on a topic. Name is the SSE event name and Data its
+// payload, usually JSON.
+type Event struct {
+	Topic string
+	Name  string
+	Data  []byte
+}
+
+// Hub fans events out to the subscribers of each topic. Publishing never
+// blocks: a subscriber that is not keeping up misses events rather than
+// stalling the publisher, so subscribers should treat each event as a full
+// snapshot or refetch state after reconnecting.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of the topic's events and a function that
+// unsubscribes and closes the channel. The function must be called once the
+// subscriber is done.
+func (h *Hub) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	subscribers, ok := h.topics[topic]
+	if !ok {
+		subscribers = make(map[chan Event]struct{})
+		h.topics[topic] = subscribers
+	}
+	subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(subscribers, ch)
+			if len(h.topics[topic]) == 0 {
+				delete(h.topics, topic)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to every current subscriber of the topic.
+func (h *Hub) Publish(topic, name string, data []byte) {
+	event := Event{Topic: topic, Name: name, Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.topics[topic] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribers returns how many subscribers the topic has.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[topic])
+}
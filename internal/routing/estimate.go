@@ -0,0 +1,50 @@
+package routing
+
+import (
+	"context"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+// DefaultDetourFactor is the typical ratio of street distance to straight-line
+// distance in a city grid.
+const DefaultDetourFactor = 1.3
+
+// Speeds in metres per minute. Walking uses the 80 m/min figure common in
+// Japanese property listings.
+var defaultSpeeds = map[Mode]float64{
+	ModeWalking: 80,
+	ModeCycling: 250,
+}
+
+// Estimate approximates routes as the Haversine distance times a detour factor.
+// It needs no network and never fails, so it is the last link of a Chain.
+type Estimate struct {
+	detourFactor float64
+}
+
+func NewEstimate(detourFactor float64) *Estimate {
+	if detourFactor < 1 {
+		detourFactor = DefaultDetourFactor
+	}
+	return &Estimate{detourFactor: detourFactor}
+}
+
+func (e *Estimate) Routes(_ context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error) {
+	speed, ok := defaultSpeeds[mode]
+	if !ok {
+		return nil, ErrNoRoute
+	}
+	routes := make([]Route, len(destinations))
+	for i, destination := range destinations {
+		km := util.HaversineDistanceKm(origin.Latitude, origin.Longitude, destination.Latitude, destination.Longitude) * e.detourFactor
+		routes[i] = Route{
+			DistanceKm: km,
+			Duration:   time.Duration(km * 1000 / speed * float64(time.Minute)),
+			Found:      true,
+			Estimated:  true,
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,151 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const graphHopperConcurrency = 4
+
+// GraphHopper uses the /route endpoint of a GraphHopper server, one request per
+// destination, since the matrix API is not part of the open source server. At
+// most graphHopperConcurrency requests are in flight at once.
+type GraphHopper struct {
+	baseURL  string
+	apiKey   string
+	profiles map[Mode]string
+	client   *http.Client
+}
+
+type GraphHopperConfig struct {
+	// BaseURL is the API root, e.g. "http://localhost:8989" or "https://graphhopper.com/api/1".
+	BaseURL string
+	// APIKey is only needed for the hosted service.
+	APIKey  string
+	Timeout time.Duration
+}
+
+type graphHopperResponse struct {
+	Paths []struct {
+		Distance float64 `json:"distance"`
+		Time     int64   `json:"time"`
+	} `json:"paths"`
+}
+
+func NewGraphHopper(cfg GraphHopperConfig) *GraphHopper {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &GraphHopper{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:  cfg.APIKey,
+		profiles: map[Mode]string{
+			ModeWalking: "foot",
+			ModeCycling: "bike",
+		},
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (g *GraphHopper) Routes(ctx context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error) {
+	profile, ok := g.profiles[mode]
+	if !ok {
+		return nil, ErrNoRoute
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	routes := make([]Route, len(destinations))
+	slots := make(chan struct{}, graphHopperConcurrency)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i, destination := range destinations {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(i int, destination Point) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			route, err := g.route(ctx, profile, origin, destination)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				// The whole call fails on the first error, so stop the others.
+				cancel()
+				return
+			}
+			routes[i] = route
+		}(i, destination)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (g *GraphHopper) route(ctx context.Context, profile string, origin, destination Point) (Route, error) {
+	values := url.Values{}
+	values.Add("point", formatPoint(origin))
+	values.Add("point", formatPoint(destination))
+	values.Set("profile", profile)
+	values.Set("calc_points", "false")
+	if g.apiKey != "" {
+		values.Set("key", g.apiKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+"/route?"+values.Encode(), nil)
+	if err != nil {
+		return Route{}, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return Route{}, fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// GraphHopper answers 400 when either point cannot be snapped to the network;
+	// that only means there is no route to this destination.
+	if resp.StatusCode == http.StatusBadRequest {
+		return Route{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Route{}, fmt.Errorf("graphhopper route failed: %d %s", resp.StatusCode, string(body))
+	}
+	var body graphHopperResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return Route{}, fmt.Errorf("decode route: %w", err)
+	}
+	if len(body.Paths) == 0 {
+		return Route{}, nil
+	}
+	return Route{
+		DistanceKm: body.Paths[0].Distance / 1000,
+		Duration:   time.Duration(body.Paths[0].Time) * time.Millisecond,
+		Found:      true,
+	}, nil
+}
+
+func formatPoint(point Point) string {
+	return strconv.FormatFloat(point.Latitude, 'f', 6, 64) + "," + strconv.FormatFloat(point.Longitude, 'f', 6, 64)
+}
@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// osrmMaxTableSize stays below the default --max-table-size of osrm-routed (100),
+// counting the origin.
+const osrmMaxTableSize = 99
+
+// OSRM uses the table service of an OSRM server. osrm-routed serves one profile
+// per process, so walking and cycling may point at different servers.
+type OSRM struct {
+	baseURLs map[Mode]string
+	client   *http.Client
+}
+
+type OSRMConfig struct {
+	// BaseURL is the server for walking, and for cycling unless CyclingURL is set,
+	// e.g. "http://localhost:5000".
+	BaseURL    string
+	CyclingURL string
+	Timeout    time.Duration
+}
+
+var osrmProfiles = map[Mode]string{
+	ModeWalking: "foot",
+	ModeCycling: "bike",
+}
+
+type osrmTableResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Durations [][]*float64 `json:"durations"`
+	Distances [][]*float64 `json:"distances"`
+}
+
+func NewOSRM(cfg OSRMConfig) *OSRM {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	cycling := cfg.CyclingURL
+	if cycling == "" {
+		cycling = cfg.BaseURL
+	}
+	return &OSRM{
+		baseURLs: map[Mode]string{
+			ModeWalking: strings.TrimRight(cfg.BaseURL, "/"),
+			ModeCycling: strings.TrimRight(cycling, "/"),
+		},
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (o *OSRM) Routes(ctx context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error) {
+	baseURL, ok := o.baseURLs[mode]
+	if !ok || baseURL == "" {
+		return nil, ErrNoRoute
+	}
+	routes := make([]Route, 0, len(destinations))
+	for start := 0; start < len(destinations); start += osrmMaxTableSize {
+		end := start + osrmMaxTableSize
+		if end > len(destinations) {
+			end = len(destinations)
+		}
+		chunk, err := o.table(ctx, baseURL, osrmProfiles[mode], origin, destinations[start:end])
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, chunk...)
+	}
+	return routes, nil
+}
+
+func (o *OSRM) table(ctx context.Context, baseURL, profile string, origin Point, destinations []Point) ([]Route, error) {
+	coordinates := make([]string, 0, len(destinations)+1)
+	for _, point := range append([]Point{origin}, destinations...) {
+		coordinates = append(coordinates, strconv.FormatFloat(point.Longitude, 'f', 6, 64)+","+strconv.FormatFloat(point.Latitude, 'f', 6, 64))
+	}
+	endpoint := fmt.Sprintf("%s/table/v1/%s/%s?sources=0&annotations=duration,distance", baseURL, profile, strings.Join(coordinates, ";"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var table osrmTableResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&table); err != nil {
+		return nil, fmt.Errorf("decode table: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || table.Code != "Ok" {
+		return nil, fmt.Errorf("osrm table failed: %d %s %s", resp.StatusCode, table.Code, table.Message)
+	}
+	if len(table.Durations) != 1 || len(table.Durations[0]) != len(destinations)+1 {
+		return nil, fmt.Errorf("osrm table: unexpected size")
+	}
+
+	routes := make([]Route, len(destinations))
+	for i := range destinations {
+		duration := table.Durations[0][i+1]
+		if duration == nil {
+			continue
+		}
+		route := Route{Duration: time.Duration(*duration * float64(time.Second)), Found: true}
+		if len(table.Distances) == 1 && len(table.Distances[0]) == len(destinations)+1 && table.Distances[0][i+1] != nil {
+			route.DistanceKm = *table.Distances[0][i+1] / 1000
+		}
+		routes[i] = route
+	}
+	return routes, nil
+}
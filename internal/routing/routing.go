@@ -0,0 +1,98 @@
+// Package routing estimates travel distance and time between points.
+package routing
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoRoute is returned when a provider cannot route between the points at all.
+var ErrNoRoute = errors.New("routing: no route")
+
+type Mode string
+
+const (
+	ModeWalking Mode = "walking"
+	ModeCycling Mode = "cycling"
+)
+
+// Modes lists every supported travel mode.
+var Modes = []Mode{ModeWalking, ModeCycling}
+
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Route is the travel distance and time to one destination. Found is false when
+// the provider had no route to that destination; Estimated is true when the route
+// was approximated instead of computed on a road network.
+type Route struct {
+	DistanceKm float64
+	Duration   time.Duration
+	Found      bool
+	Estimated  bool
+}
+
+type Router interface {
+	// Routes returns one route from origin to each destination, in the same order.
+	Routes(ctx context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error)
+}
+
+// WithTimeout bounds each call to router by timeout, so that a slow provider in
+// a Chain leaves the rest of the caller's deadline to the routers after it.
+func WithTimeout(router Router, timeout time.Duration) Router {
+	return timeoutRouter{router: router, timeout: timeout}
+}
+
+type timeoutRouter struct {
+	router  Router
+	timeout time.Duration
+}
+
+func (t timeoutRouter) Routes(ctx context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.router.Routes(ctx, mode, origin, destinations)
+}
+
+// Chain asks each router in turn. Destinations a router fails on, or has no route
+// to, are passed on to the next one, so an Estimate at the end always answers.
+type Chain []Router
+
+func (c Chain) Routes(ctx context.Context, mode Mode, origin Point, destinations []Point) ([]Route, error) {
+	routes := make([]Route, len(destinations))
+	pending := make([]int, len(destinations))
+	for i := range pending {
+		pending[i] = i
+	}
+	var lastErr error
+	for _, router := range c {
+		if len(pending) == 0 {
+			break
+		}
+		points := make([]Point, len(pending))
+		for i, index := range pending {
+			points[i] = destinations[index]
+		}
+		found, err := router.Routes(ctx, mode, origin, points)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		remaining := pending[:0]
+		for i, index := range pending {
+			if i < len(found) && found[i].Found {
+				routes[index] = found[i]
+				continue
+			}
+			remaining = append(remaining, index)
+		}
+		pending = remaining
+	}
+	if len(pending) == len(destinations) && lastErr != nil {
+		return nil, lastErr
+	}
+	return routes, nil
+}
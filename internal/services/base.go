@@ -2,26 +2,41 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 )
 
+// ErrLastBase is returned when deleting or merging away the only remaining base.
+var ErrLastBase = errors.New("cannot remove the last base")
+
 type Base struct {
 	ID        int
 	Name      string
 	Latitude  float64
 	Longitude float64
+	// CreatedBy is 0 for seeded bases.
+	CreatedBy int
 }
 
+// BaseService reads and writes the bases of one workspace. The service
+// returned by NewBaseService is not scoped to any workspace and sees no bases;
+// use InWorkspace to get a scoped copy.
 type BaseService struct {
-	db *sql.DB
+	db          *sql.DB
+	workspaceID int
 }
 
 func NewBaseService(db *sql.DB) *BaseService {
 	return &BaseService{db: db}
 }
 
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *BaseService) InWorkspace(workspaceID int) *BaseService {
+	return &BaseService{db: s.db, workspaceID: workspaceID}
+}
+
 func (s *BaseService) ListBases() ([]Base, error) {
-	rows, err := s.db.Query("SELECT id, name, latitude, longitude FROM bases ORDER BY id ASC")
+	rows, err := s.db.Query("SELECT id, name, latitude, longitude, COALESCE(created_by, 0) FROM bases WHERE workspace_id = ? ORDER BY id ASC", s.workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("list bases: %w", err)
 	}
@@ -30,7 +45,7 @@ func (s *BaseService) ListBases() ([]Base, error) {
 	var bases []Base
 	for rows.Next() {
 		var base Base
-		if err := rows.Scan(&base.ID, &base.Name, &base.Latitude, &base.Longitude); err != nil {
+		if err := rows.Scan(&base.ID, &base.Name, &base.Latitude, &base.Longitude, &base.CreatedBy); err != nil {
 			return nil, fmt.Errorf("scan base: %w", err)
 		}
 		bases = append(bases, base)
@@ -43,8 +58,8 @@ func (s *BaseService) ListBases() ([]Base, error) {
 
 func (s *BaseService) GetBaseByID(id int) (*Base, error) {
 	var base Base
-	err := s.db.QueryRow("SELECT id, name, latitude, longitude FROM bases WHERE id = ?", id).
-		Scan(&base.ID, &base.Name, &base.Latitude, &base.Longitude)
+	err := s.db.QueryRow("SELECT id, name, latitude, longitude, COALESCE(created_by, 0) FROM bases WHERE id = ? AND workspace_id = ?", id, s.workspaceID).
+		Scan(&base.ID, &base.Name, &base.Latitude, &base.Longitude, &base.CreatedBy)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -55,7 +70,7 @@ func (s *BaseService) GetBaseByID(id int) (*Base, error) {
 }
 
 func (s *BaseService) CreateBase(base Base) (int, error) {
-	result, err := s.db.Exec("INSERT INTO bases (name, latitude, longitude) VALUES (?, ?, ?)", base.Name, base.Latitude, base.Longitude)
+	result, err := s.db.Exec("INSERT INTO bases (name, latitude, longitude, created_by, workspace_id) VALUES (?, ?, ?, NULLIF(?, 0), ?)", base.Name, base.Latitude, base.Longitude, base.CreatedBy, s.workspaceID)
 	if err != nil {
 		return 0, fmt.Errorf("create base: %w", err)
 	}
@@ -65,3 +80,138 @@ func (s *BaseService) CreateBase(base Base) (int, error) {
 	}
 	return int(createdID), nil
 }
+
+func (s *BaseService) UpdateBase(base Base) error {
+	result, err := s.db.Exec(`
+		UPDATE bases
+		SET name = ?, latitude = ?, longitude = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND workspace_id = ?
+	`, base.Name, base.Latitude, base.Longitude, base.ID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("update base: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DefaultBaseID returns the base the user made their default in the
+// workspace, or 0 if they have none there.
+func (s *BaseService) DefaultBaseID(userID int) (int, error) {
+	var baseID int
+	err := s.db.QueryRow(`
+        SELECT d.base_id
+        FROM user_default_bases d
+        INNER JOIN bases b ON b.id = d.base_id
+        WHERE d.user_id = ? AND d.workspace_id = ? AND b.workspace_id = ?
+    `, userID, s.workspaceID, s.workspaceID).Scan(&baseID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get default base: %w", err)
+	}
+	return baseID, nil
+}
+
+// SetDefaultBase makes the base the user's default in the workspace. It
+// returns sql.ErrNoRows if the base is not in the workspace.
+func (s *BaseService) SetDefaultBase(userID, baseID int) error {
+	result, err := s.db.Exec(`
+        INSERT INTO user_default_bases (user_id, workspace_id, base_id)
+        SELECT ?, workspace_id, id FROM bases WHERE id = ? AND workspace_id = ?
+        ON CONFLICT(user_id, workspace_id) DO UPDATE SET base_id = excluded.base_id
+    `, userID, baseID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("set default base: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// DeleteBase removes a base. Users who had it as their default fall back to
+// the first base, and cached travel times for it are dropped.
+func (s *BaseService) DeleteBase(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ensureOtherBase(tx, s.workspaceID, id); err != nil {
+		return err
+	}
+	if err := deleteBase(tx, s.workspaceID, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// MergeBases folds the source base into the target: everything that pointed at
+// the source is moved to the target, then the source is deleted.
+func (s *BaseService) MergeBases(sourceID, targetID int) error {
+	if sourceID == targetID {
+		return fmt.Errorf("merge base into itself")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM bases WHERE id = ? AND workspace_id = ?", targetID, s.workspaceID).Scan(&exists); err != nil {
+		return fmt.Errorf("check merge target: %w", err)
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("UPDATE user_default_bases SET base_id = ? WHERE base_id = ?", targetID, sourceID); err != nil {
+		return fmt.Errorf("move default base: %w", err)
+	}
+	if err := deleteBase(tx, s.workspaceID, sourceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+func ensureOtherBase(tx *sql.Tx, workspaceID, id int) error {
+	var others int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM bases WHERE id <> ? AND workspace_id = ?", id, workspaceID).Scan(&others); err != nil {
+		return fmt.Errorf("count bases: %w", err)
+	}
+	if others == 0 {
+		return ErrLastBase
+	}
+	return nil
+}
+
+func deleteBase(tx *sql.Tx, workspaceID, id int) error {
+	result, err := tx.Exec("DELETE FROM bases WHERE id = ? AND workspace_id = ?", id, workspaceID)
+	if err != nil {
+		return fmt.Errorf("delete base: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM travel_times WHERE base_id = ?", id); err != nil {
+		return fmt.Errorf("delete base travel times: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestDefaultBaseIsPerWorkspace(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	other := insertWorkspace(t, database, "other")
+	public := insertBase(t, database, 1, "OIC")
+	publicOther := insertBase(t, database, 1, "BKC")
+	private := insertBase(t, database, other, "Office")
+	bases := NewBaseService(database)
+
+	if err := bases.InWorkspace(1).SetDefaultBase(alice, public.ID); err != nil {
+		t.Fatalf("SetDefaultBase: %v", err)
+	}
+	if err := bases.InWorkspace(other).SetDefaultBase(alice, private.ID); err != nil {
+		t.Fatalf("SetDefaultBase: %v", err)
+	}
+	if err := bases.InWorkspace(other).SetDefaultBase(alice, publicOther.ID); err != sql.ErrNoRows {
+		t.Errorf("SetDefaultBase with another workspace's base = %v, want sql.ErrNoRows", err)
+	}
+	for _, tt := range []struct {
+		workspaceID int
+		want        int
+	}{{1, public.ID}, {other, private.ID}} {
+		if got, err := bases.InWorkspace(tt.workspaceID).DefaultBaseID(alice); err != nil || got != tt.want {
+			t.Errorf("workspace %d DefaultBaseID = %d, %v; want %d", tt.workspaceID, got, err, tt.want)
+		}
+	}
+
+	// Merging moves the default to the target; deleting the target clears it.
+	if err := bases.InWorkspace(1).MergeBases(public.ID, publicOther.ID); err != nil {
+		t.Fatalf("MergeBases: %v", err)
+	}
+	if got, err := bases.InWorkspace(1).DefaultBaseID(alice); err != nil || got != publicOther.ID {
+		t.Errorf("after merge DefaultBaseID = %d, %v; want %d", got, err, publicOther.ID)
+	}
+	insertBase(t, database, 1, "KIC")
+	if err := bases.InWorkspace(1).DeleteBase(publicOther.ID); err != nil {
+		t.Fatalf("DeleteBase: %v", err)
+	}
+	if got, err := bases.InWorkspace(1).DefaultBaseID(alice); err != nil || got != 0 {
+		t.Errorf("after delete DefaultBaseID = %d, %v; want 0", got, err)
+	}
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// visitDateLayout is how checkins.visited_on is stored: the local date of the
+// visit, with no time of day.
+const visitDateLayout = "2006-01-02"
+
+// Checkin records that UserID ate at a restaurant on a day, optionally with
+// other users and the amount spent.
+type Checkin struct {
+	ID             int
+	UserID         int
+	Username       string
+	RestaurantID   int
+	RestaurantName string
+	// VisitedOn is midnight local time of the day of the visit.
+	VisitedOn time.Time
+	// Amount is what the user spent in yen, 0 if not given.
+	Amount     int
+	Companions []CheckinCompanion
+}
+
+type CheckinCompanion struct {
+	UserID   int
+	Username string
+}
+
+// RestaurantVisits sums up a user's visits to one restaurant.
+type RestaurantVisits struct {
+	RestaurantID   int
+	RestaurantName string
+	Count          int
+	LastVisited    time.Time
+	// TotalAmount adds up the amounts the user gave on their own check-ins.
+	TotalAmount int
+}
+
+// CheckinService keeps the visits users record. A user's visits are their own
+// check-ins and the check-ins that list them as a companion.
+type CheckinService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewCheckinService(db *sql.DB) *CheckinService {
+	return &CheckinService{db: db}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *CheckinService) InWorkspace(workspaceID int) *CheckinService {
+	return &CheckinService{db: s.db, workspaceID: workspaceID}
+}
+
+// userVisits selects the check-ins that count as visits of the user (bound
+// twice), joined to their restaurant r and their author u.
+const userVisits = `
+        checkins c
+        INNER JOIN restaurants r ON r.id = c.restaurant_id
+        INNER JOIN users u ON u.id = c.user_id
+        WHERE r.workspace_id = ?
+          AND (c.user_id = ? OR EXISTS (SELECT 1 FROM checkin_companions p WHERE p.checkin_id = c.id AND p.user_id = ?))
+`
+
+// CreateCheckin stores the check-in and its companions. The user is never
+// stored as their own companion.
+func (s *CheckinService) CreateCheckin(checkin Checkin, companionIDs []int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ensureRestaurantInWorkspace(tx, s.workspaceID, checkin.RestaurantID); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+        INSERT INTO checkins (user_id, restaurant_id, visited_on, amount)
+        VALUES (?, ?, ?, NULLIF(?, 0))
+    `, checkin.UserID, checkin.RestaurantID, checkin.VisitedOn.Format(visitDateLayout), checkin.Amount)
+	if err != nil {
+		return 0, fmt.Errorf("create checkin: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("checkin id: %w", err)
+	}
+	for _, companionID := range companionIDs {
+		if companionID == checkin.UserID {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO checkin_companions (checkin_id, user_id) VALUES (?, ?)", id, companionID); err != nil {
+			return 0, fmt.Errorf("add checkin companion: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+	return int(id), nil
+}
+
+// DeleteCheckin deletes one of the user's own check-ins. Companions cannot
+// delete a check-in that lists them.
+func (s *CheckinService) DeleteCheckin(id, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        DELETE FROM checkins
+        WHERE id = ? AND user_id = ?
+          AND restaurant_id IN (SELECT id FROM restaurants WHERE workspace_id = ?)
+    `, id, userID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("delete checkin: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM checkin_companions WHERE checkin_id = ?", id); err != nil {
+		return fmt.Errorf("delete checkin companions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// ListCheckins returns up to limit of the user's visits, latest first.
+func (s *CheckinService) ListCheckins(userID, limit int) ([]Checkin, error) {
+	rows, err := s.db.Query(`
+        SELECT c.id, c.user_id, u.username, c.restaurant_id, r.name, c.visited_on, COALESCE(c.amount, 0)
+        FROM `+userVisits+`
+        ORDER BY c.visited_on DESC, c.id DESC
+        LIMIT ?
+    `, s.workspaceID, userID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list checkins: %w", err)
+	}
+	var checkins []Checkin
+	index := make(map[int]int)
+	for rows.Next() {
+		var checkin Checkin
+		var visitedOn string
+		if err := rows.Scan(&checkin.ID, &checkin.UserID, &checkin.Username, &checkin.RestaurantID, &checkin.RestaurantName, &visitedOn, &checkin.Amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan checkin: %w", err)
+		}
+		checkin.VisitedOn = parseVisitDate(visitedOn)
+		index[checkin.ID] = len(checkins)
+		checkins = append(checkins, checkin)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows checkin: %w", err)
+	}
+	if len(checkins) == 0 {
+		return checkins, nil
+	}
+
+	rows, err = s.db.Query(`
+        SELECT p.checkin_id, u.id, u.username
+        FROM checkin_companions p
+        INNER JOIN users u ON u.id = p.user_id
+        INNER JOIN checkins c ON c.id = p.checkin_id
+        INNER JOIN restaurants r ON r.id = c.restaurant_id
+        WHERE r.workspace_id = ?
+          AND (c.user_id = ? OR EXISTS (SELECT 1 FROM checkin_companions q WHERE q.checkin_id = c.id AND q.user_id = ?))
+        ORDER BY u.username ASC
+    `, s.workspaceID, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list checkin companions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var checkinID int
+		var companion CheckinCompanion
+		if err := rows.Scan(&checkinID, &companion.UserID, &companion.Username); err != nil {
+			return nil, fmt.Errorf("scan checkin companion: %w", err)
+		}
+		if i, ok := index[checkinID]; ok {
+			checkins[i].Companions = append(checkins[i].Companions, companion)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows checkin companion: %w", err)
+	}
+	return checkins, nil
+}
+
+// DailyVisits counts the user's visits per day from from to to inclusive,
+// keyed by the date as "2006-01-02". Days without visits are absent.
+func (s *CheckinService) DailyVisits(userID int, from, to time.Time) (map[string]int, error) {
+	rows, err := s.db.Query(`
+        SELECT c.visited_on, COUNT(*)
+        FROM `+userVisits+`
+          AND c.visited_on BETWEEN ? AND ?
+        GROUP BY c.visited_on
+    `, s.workspaceID, userID, userID, from.Format(visitDateLayout), to.Format(visitDateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("count daily visits: %w", err)
+	}
+	defer rows.Close()
+	days := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, fmt.Errorf("scan daily visits: %w", err)
+		}
+		days[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows daily visits: %w", err)
+	}
+	return days, nil
+}
+
+// VisitsByRestaurant sums up the user's visits per restaurant, most visited
+// first.
+func (s *CheckinService) VisitsByRestaurant(userID int) ([]RestaurantVisits, error) {
+	rows, err := s.db.Query(`
+        SELECT r.id, r.name, COUNT(*), MAX(c.visited_on),
+               COALESCE(SUM(CASE WHEN c.user_id = ? THEN c.amount END), 0)
+        FROM `+userVisits+`
+        GROUP BY r.id
+        ORDER BY COUNT(*) DESC, MAX(c.visited_on) DESC, r.id ASC
+    `, userID, s.workspaceID, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list restaurant visits: %w", err)
+	}
+	defer rows.Close()
+	var visits []RestaurantVisits
+	for rows.Next() {
+		var visit RestaurantVisits
+		var lastVisited string
+		if err := rows.Scan(&visit.RestaurantID, &visit.RestaurantName, &visit.Count, &lastVisited, &visit.TotalAmount); err != nil {
+			return nil, fmt.Errorf("scan restaurant visits: %w", err)
+		}
+		visit.LastVisited = parseVisitDate(lastVisited)
+		visits = append(visits, visit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows restaurant visits: %w", err)
+	}
+	return visits, nil
+}
+
+// LastVisits returns when the user last went to each of the workspace's
+// restaurants, keyed by restaurant ID. Reviews count as visits too, so places
+// reviewed before check-ins existed keep a date.
+func (s *CheckinService) LastVisits(userID int) (map[int]time.Time, error) {
+	visits := make(map[int]time.Time)
+	if userID == 0 {
+		return visits, nil
+	}
+	rows, err := s.db.Query(`
+        SELECT r.id, MAX(c.visited_on)
+        FROM `+userVisits+`
+        GROUP BY r.id
+    `, s.workspaceID, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list last visits: %w", err)
+	}
+	for rows.Next() {
+		var restaurantID int
+		var visitedOn string
+		if err := rows.Scan(&restaurantID, &visitedOn); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan last visit: %w", err)
+		}
+		visits[restaurantID] = parseVisitDate(visitedOn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows last visit: %w", err)
+	}
+
+	rows, err = s.db.Query(`
+        SELECT r.id, MAX(v.created_at)
+        FROM reviews v
+        INNER JOIN restaurants r ON r.id = v.restaurant_id
+        WHERE v.user_id = ? AND r.workspace_id = ?
+        GROUP BY r.id
+    `, userID, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list last reviews: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var restaurantID int
+		var reviewedAt string
+		if err := rows.Scan(&restaurantID, &reviewedAt); err != nil {
+			return nil, fmt.Errorf("scan last review: %w", err)
+		}
+		visits[restaurantID] = laterVisit(visits[restaurantID], parseTimestamp(reviewedAt))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows last review: %w", err)
+	}
+	return visits, nil
+}
+
+// parseVisitDate reads a visited_on date as midnight local time, or zero if
+// it is empty.
+func parseVisitDate(value string) time.Time {
+	parsed, err := time.ParseInLocation(visitDateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+// laterVisit returns the later of two visit times, ignoring zero times.
+func laterVisit(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
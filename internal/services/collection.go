@@ -0,0 +1,483 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	// CollectionPrivate collections are seen only by the owner and
+	// collaborators.
+	CollectionPrivate = "private"
+	// CollectionWorkspace collections are seen by everyone who can see the
+	// workspace.
+	CollectionWorkspace = "workspace"
+	// CollectionPublic collections are also seen by anyone with the share
+	// link, even outside the workspace.
+	CollectionPublic = "public"
+)
+
+// Collection is a named, ordered list of restaurants such as "雨の日ランチ
+// 300m 以内". The owner and collaborators edit its items; only the owner
+// changes the rest.
+type Collection struct {
+	ID          int
+	WorkspaceID int
+	OwnerID     int
+	OwnerName   string
+	Title       string
+	Description string
+	Visibility  string
+	ShareToken  string
+	ItemCount   int
+	UpdatedAt   time.Time
+}
+
+type CollectionItem struct {
+	Restaurant Restaurant
+	Note       string
+}
+
+type CollectionCollaborator struct {
+	UserID   int
+	Username string
+}
+
+// CollectionDetail is a collection with its items in order and its
+// collaborators.
+type CollectionDetail struct {
+	Collection
+	Items         []CollectionItem
+	Collaborators []CollectionCollaborator
+}
+
+// IsCollaborator reports whether the user may edit the collection's items.
+func (d *CollectionDetail) IsCollaborator(userID int) bool {
+	if userID == 0 {
+		return false
+	}
+	if d.OwnerID == userID {
+		return true
+	}
+	for _, collaborator := range d.Collaborators {
+		if collaborator.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+type CollectionService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewCollectionService(db *sql.DB) *CollectionService {
+	return &CollectionService{db: db}
+}
+
+// InWorkspace returns a copy of the service that only sees the workspace's
+// collections.
+func (s *CollectionService) InWorkspace(workspaceID int) *CollectionService {
+	scoped := *s
+	scoped.workspaceID = workspaceID
+	return &scoped
+}
+
+const collectionColumns = `
+        c.id, c.workspace_id, c.owner_id, u.username, c.title, c.description, c.visibility, c.share_token, c.updated_at,
+        (SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)
+`
+
+// collectionVisible limits a query to collections the viewer (bound twice)
+// may see.
+const collectionVisible = `
+        (c.visibility <> 'private' OR c.owner_id = ?
+         OR EXISTS (SELECT 1 FROM collection_collaborators k WHERE k.collection_id = c.id AND k.user_id = ?))
+`
+
+func scanCollection(row rowScanner) (Collection, error) {
+	var collection Collection
+	err := row.Scan(
+		&collection.ID,
+		&collection.WorkspaceID,
+		&collection.OwnerID,
+		&collection.OwnerName,
+		&collection.Title,
+		&collection.Description,
+		&collection.Visibility,
+		&collection.ShareToken,
+		&collection.UpdatedAt,
+		&collection.ItemCount,
+	)
+	return collection, err
+}
+
+// ListCollections returns the workspace's collections the viewer may see,
+// recently updated first. A viewerID of 0 sees only shared collections.
+func (s *CollectionService) ListCollections(viewerID int) ([]Collection, error) {
+	return s.queryCollections(`SELECT `+collectionColumns+`
+        FROM collections c
+        JOIN users u ON u.id = c.owner_id
+        WHERE c.workspace_id = ? AND `+collectionVisible+`
+        ORDER BY c.updated_at DESC, c.id DESC
+    `, s.workspaceID, viewerID, viewerID)
+}
+
+// ListEditableCollections returns the workspace's collections the user owns
+// or collaborates on, by title.
+func (s *CollectionService) ListEditableCollections(userID int) ([]Collection, error) {
+	return s.queryCollections(`SELECT `+collectionColumns+`
+        FROM collections c
+        JOIN users u ON u.id = c.owner_id
+        WHERE c.workspace_id = ?
+          AND (c.owner_id = ? OR EXISTS (SELECT 1 FROM collection_collaborators k WHERE k.collection_id = c.id AND k.user_id = ?))
+        ORDER BY c.title ASC, c.id ASC
+    `, s.workspaceID, userID, userID)
+}
+
+func (s *CollectionService) queryCollections(query string, args ...interface{}) ([]Collection, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan collection: %w", err)
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows collection: %w", err)
+	}
+	return collections, nil
+}
+
+// GetCollection returns the collection with its items, or nil when the
+// workspace has no such collection or the viewer may not see it.
+func (s *CollectionService) GetCollection(id, viewerID int) (*CollectionDetail, error) {
+	collection, err := scanCollection(s.db.QueryRow(`SELECT `+collectionColumns+`
+        FROM collections c
+        JOIN users u ON u.id = c.owner_id
+        WHERE c.id = ? AND c.workspace_id = ? AND `+collectionVisible,
+		id, s.workspaceID, viewerID, viewerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get collection: %w", err)
+	}
+	return s.detail(collection)
+}
+
+// GetSharedCollection returns the public collection with the share token from
+// any workspace, or nil if there is none.
+func (s *CollectionService) GetSharedCollection(token string) (*CollectionDetail, error) {
+	collection, err := scanCollection(s.db.QueryRow(`SELECT `+collectionColumns+`
+        FROM collections c
+        JOIN users u ON u.id = c.owner_id
+        WHERE c.share_token = ? AND c.visibility = ?
+    `, token, CollectionPublic))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get shared collection: %w", err)
+	}
+	return s.detail(collection)
+}
+
+func (s *CollectionService) detail(collection Collection) (*CollectionDetail, error) {
+	detail := &CollectionDetail{Collection: collection}
+
+	rows, err := s.db.Query(`
+        SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url, r.created_by, r.created_at, COALESCE(r.budget, 0), COALESCE(r.opening_hours, ''),
+               i.note
+        FROM collection_items i
+        JOIN restaurants r ON r.id = i.restaurant_id
+        WHERE i.collection_id = ? AND r.workspace_id = ?
+        ORDER BY i.position ASC, i.created_at ASC
+    `, collection.ID, collection.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list collection items: %w", err)
+	}
+	for rows.Next() {
+		var item CollectionItem
+		rest := &item.Restaurant
+		if err := rows.Scan(&rest.ID, &rest.Name, &rest.Description, &rest.PhotoPath, &rest.Latitude, &rest.Longitude, &rest.Address, &rest.MapsURL,
+			&rest.CreatedBy, &rest.CreatedAt, &rest.Budget, &rest.OpeningHours, &item.Note); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan collection item: %w", err)
+		}
+		detail.Items = append(detail.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows collection item: %w", err)
+	}
+
+	rows, err = s.db.Query(`
+        SELECT u.id, u.username
+        FROM collection_collaborators k
+        JOIN users u ON u.id = k.user_id
+        WHERE k.collection_id = ?
+        ORDER BY u.username ASC
+    `, collection.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list collection collaborators: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var collaborator CollectionCollaborator
+		if err := rows.Scan(&collaborator.UserID, &collaborator.Username); err != nil {
+			return nil, fmt.Errorf("scan collection collaborator: %w", err)
+		}
+		detail.Collaborators = append(detail.Collaborators, collaborator)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows collection collaborator: %w", err)
+	}
+	return detail, nil
+}
+
+// CreateCollection stores a collection in the workspace. Every collection gets
+// a share token up front so the link stays the same when it is made public.
+func (s *CollectionService) CreateCollection(collection Collection) (int, error) {
+	token, err := util.RandomToken(24)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(`
+        INSERT INTO collections (workspace_id, owner_id, title, description, visibility, share_token)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, s.workspaceID, collection.OwnerID, collection.Title, collection.Description, collection.Visibility, token)
+	if err != nil {
+		return 0, fmt.Errorf("create collection: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("collection id: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateCollection saves the collection's title, description and visibility.
+func (s *CollectionService) UpdateCollection(collection Collection) error {
+	result, err := s.db.Exec(`
+        UPDATE collections
+        SET title = ?, description = ?, visibility = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND workspace_id = ?
+    `, collection.Title, collection.Description, collection.Visibility, collection.ID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("update collection: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// DeleteCollection deletes the collection with its items and collaborators.
+func (s *CollectionService) DeleteCollection(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM collections WHERE id = ? AND workspace_id = ?", id, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	for _, table := range []string{"collection_items", "collection_collaborators"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE collection_id = ?", id); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// AddItem appends a restaurant of the workspace to the collection. Adding one
+// that is already there only replaces its note when a note is given.
+func (s *CollectionService) AddItem(collectionID, restaurantID, userID int, note string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ensureRestaurantInWorkspace(tx, s.workspaceID, restaurantID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
+        INSERT INTO collection_items (collection_id, restaurant_id, position, note, added_by)
+        SELECT c.id, ?, COALESCE((SELECT MAX(position) + 1 FROM collection_items WHERE collection_id = c.id), 0), ?, ?
+        FROM collections c
+        WHERE c.id = ? AND c.workspace_id = ?
+        ON CONFLICT (collection_id, restaurant_id) DO UPDATE SET note = CASE WHEN excluded.note <> '' THEN excluded.note ELSE note END
+    `, restaurantID, note, userID, collectionID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("add collection item: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	if err := touchCollection(tx, collectionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// UpdateItemNote replaces the note on a restaurant in the collection.
+func (s *CollectionService) UpdateItemNote(collectionID, restaurantID int, note string) error {
+	return s.changeItems(collectionID, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("UPDATE collection_items SET note = ? WHERE collection_id = ? AND restaurant_id = ?", note, collectionID, restaurantID)
+	})
+}
+
+// RemoveItem takes a restaurant out of the collection.
+func (s *CollectionService) RemoveItem(collectionID, restaurantID int) error {
+	return s.changeItems(collectionID, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("DELETE FROM collection_items WHERE collection_id = ? AND restaurant_id = ?", collectionID, restaurantID)
+	})
+}
+
+// MoveItem moves a restaurant one place up (offset -1) or down (offset 1).
+// Moving past either end leaves the order as it is.
+func (s *CollectionService) MoveItem(collectionID, restaurantID, offset int) error {
+	return s.changeItems(collectionID, func(tx *sql.Tx) (sql.Result, error) {
+		rows, err := tx.Query("SELECT restaurant_id FROM collection_items WHERE collection_id = ? ORDER BY position ASC, created_at ASC", collectionID)
+		if err != nil {
+			return nil, err
+		}
+		var order []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			order = append(order, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		from := -1
+		for i, id := range order {
+			if id == restaurantID {
+				from = i
+			}
+		}
+		if from < 0 {
+			return nil, sql.ErrNoRows
+		}
+		if to := from + offset; to >= 0 && to < len(order) {
+			order[from], order[to] = order[to], order[from]
+		}
+		var result sql.Result
+		for position, id := range order {
+			if result, err = tx.Exec("UPDATE collection_items SET position = ? WHERE collection_id = ? AND restaurant_id = ?", position, collectionID, id); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	})
+}
+
+// changeItems runs change on the items of a collection in the workspace and
+// marks the collection updated. change's result must affect a row.
+func (s *CollectionService) changeItems(collectionID int, change func(tx *sql.Tx) (sql.Result, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM collections WHERE id = ? AND workspace_id = ?", collectionID, s.workspaceID).Scan(&exists); err != nil {
+		return fmt.Errorf("check collection: %w", err)
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	result, err := change(tx)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("change collection items: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	if err := touchCollection(tx, collectionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+func touchCollection(db execer, id int) error {
+	if _, err := db.Exec("UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		return fmt.Errorf("touch collection: %w", err)
+	}
+	return nil
+}
+
+// AddCollaborator lets the user edit the collection's items. Adding the owner
+// or someone already collaborating is not an error.
+func (s *CollectionService) AddCollaborator(collectionID, userID int) error {
+	result, err := s.db.Exec(`
+        INSERT OR IGNORE INTO collection_collaborators (collection_id, user_id)
+        SELECT c.id, u.id FROM collections c, users u
+        WHERE c.id = ? AND c.workspace_id = ? AND u.id = ? AND c.owner_id <> u.id
+    `, collectionID, s.workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("add collaborator: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		var exists int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM collections c, users u WHERE c.id = ? AND c.workspace_id = ? AND u.id = ?", collectionID, s.workspaceID, userID).Scan(&exists); err != nil {
+			return fmt.Errorf("check collaborator: %w", err)
+		}
+		if exists == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+func (s *CollectionService) RemoveCollaborator(collectionID, userID int) error {
+	result, err := s.db.Exec(`
+        DELETE FROM collection_collaborators
+        WHERE collection_id = ? AND user_id = ?
+          AND collection_id IN (SELECT id FROM collections WHERE workspace_id = ?)
+    `, collectionID, userID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("remove collaborator: %w", err)
+	}
+	return requireAffected(result)
+}
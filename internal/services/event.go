@@ -0,0 +1,634 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	RSVPYes   = "yes"
+	RSVPMaybe = "maybe"
+	RSVPNo    = "no"
+)
+
+// calendarFeedHistory is how far back the calendar feed goes.
+const calendarFeedHistory = 90 * 24 * time.Hour
+
+// Event is a planned get-together such as a 飲み会. EndsAt is zero when no end
+// time was given and FinalRestaurantID is 0 until a venue is decided.
+type Event struct {
+	ID                int
+	WorkspaceID       int
+	Title             string
+	StartsAt          time.Time
+	EndsAt            time.Time
+	BudgetPerPerson   int
+	Note              string
+	FinalRestaurantID int
+	FinalName         string
+	FinalAddress      string
+	CreatedBy         int
+	CreatorName       string
+	UpdatedAt         time.Time
+	// Going is the total headcount of "yes" answers.
+	Going int
+	// CancelledAt is only set on the deleted events CalendarFeed returns,
+	// so that subscribed calendars drop them.
+	CancelledAt time.Time
+}
+
+type EventVoter struct {
+	UserID   int
+	Username string
+}
+
+type EventCandidate struct {
+	RestaurantID int
+	Name         string
+	Address      string
+	Budget       int
+	Votes        []EventVoter
+}
+
+type EventRSVP struct {
+	UserID    int
+	Username  string
+	AvatarURL string
+	Status    string
+	Headcount int
+	Comment   string
+}
+
+// EventDetail is an event with its candidate venues, most voted first, and
+// everyone's answers.
+type EventDetail struct {
+	Event
+	Candidates []EventCandidate
+	RSVPs      []EventRSVP
+	// Maybe is the total headcount of "maybe" answers.
+	Maybe int
+}
+
+type EventService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewEventService(db *sql.DB) *EventService {
+	return &EventService{db: db}
+}
+
+// InWorkspace returns a copy of the service that only sees the workspace's
+// events.
+func (s *EventService) InWorkspace(workspaceID int) *EventService {
+	scoped := *s
+	scoped.workspaceID = workspaceID
+	return &scoped
+}
+
+const eventColumns = `
+        e.id, e.workspace_id, e.title, e.starts_at, e.ends_at, COALESCE(e.budget_per_person, 0), e.note,
+        COALESCE(r.id, 0), COALESCE(r.name, ''), COALESCE(r.address, ''), e.created_by, u.username, e.updated_at,
+        COALESCE((SELECT SUM(headcount) FROM event_rsvps WHERE event_id = e.id AND status = 'yes'), 0)
+`
+
+const eventJoins = `
+        FROM events e
+        JOIN users u ON u.id = e.created_by
+        LEFT JOIN restaurants r ON r.id = e.final_restaurant_id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row rowScanner) (Event, error) {
+	var event Event
+	var endsAt sql.NullTime
+	err := row.Scan(
+		&event.ID,
+		&event.WorkspaceID,
+		&event.Title,
+		&event.StartsAt,
+		&endsAt,
+		&event.BudgetPerPerson,
+		&event.Note,
+		&event.FinalRestaurantID,
+		&event.FinalName,
+		&event.FinalAddress,
+		&event.CreatedBy,
+		&event.CreatorName,
+		&event.UpdatedAt,
+		&event.Going,
+	)
+	if endsAt.Valid {
+		event.EndsAt = endsAt.Time
+	}
+	return event, err
+}
+
+// ListEvents returns the workspace's events, soonest first.
+func (s *EventService) ListEvents() ([]Event, error) {
+	rows, err := s.db.Query(`SELECT `+eventColumns+eventJoins+`
+        WHERE e.workspace_id = ?
+        ORDER BY e.starts_at ASC, e.id ASC
+    `, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows event: %w", err)
+	}
+	return events, nil
+}
+
+// GetEvent returns the event, or nil when the workspace has no such event.
+func (s *EventService) GetEvent(id int) (*Event, error) {
+	event, err := scanEvent(s.db.QueryRow(`SELECT `+eventColumns+eventJoins+`
+        WHERE e.id = ? AND e.workspace_id = ?
+    `, id, s.workspaceID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	return &event, nil
+}
+
+// GetEventDetail returns the event with its candidates and answers, or nil
+// when the workspace has no such event.
+func (s *EventService) GetEventDetail(id int) (*EventDetail, error) {
+	event, err := s.GetEvent(id)
+	if err != nil || event == nil {
+		return nil, err
+	}
+	detail := &EventDetail{Event: *event}
+
+	rows, err := s.db.Query(`
+        SELECT r.id, r.name, r.address, COALESCE(r.budget, 0)
+        FROM event_candidates c
+        JOIN restaurants r ON r.id = c.restaurant_id
+        WHERE c.event_id = ?
+        ORDER BY (SELECT COUNT(*) FROM event_votes v WHERE v.event_id = c.event_id AND v.restaurant_id = c.restaurant_id) DESC, c.created_at ASC, r.id ASC
+    `, id)
+	if err != nil {
+		return nil, fmt.Errorf("list event candidates: %w", err)
+	}
+	index := make(map[int]int)
+	for rows.Next() {
+		var candidate EventCandidate
+		if err := rows.Scan(&candidate.RestaurantID, &candidate.Name, &candidate.Address, &candidate.Budget); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan event candidate: %w", err)
+		}
+		index[candidate.RestaurantID] = len(detail.Candidates)
+		detail.Candidates = append(detail.Candidates, candidate)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows event candidate: %w", err)
+	}
+
+	rows, err = s.db.Query(`
+        SELECT v.restaurant_id, u.id, u.username
+        FROM event_votes v
+        JOIN users u ON u.id = v.user_id
+        WHERE v.event_id = ?
+        ORDER BY v.created_at ASC, u.id ASC
+    `, id)
+	if err != nil {
+		return nil, fmt.Errorf("list event votes: %w", err)
+	}
+	for rows.Next() {
+		var restaurantID int
+		var voter EventVoter
+		if err := rows.Scan(&restaurantID, &voter.UserID, &voter.Username); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan event vote: %w", err)
+		}
+		if i, ok := index[restaurantID]; ok {
+			detail.Candidates[i].Votes = append(detail.Candidates[i].Votes, voter)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows event vote: %w", err)
+	}
+
+	rows, err = s.db.Query(`
+        SELECT u.id, u.username, u.avatar_url, a.status, a.headcount, a.comment
+        FROM event_rsvps a
+        JOIN users u ON u.id = a.user_id
+        WHERE a.event_id = ?
+        ORDER BY CASE a.status WHEN 'yes' THEN 0 WHEN 'maybe' THEN 1 ELSE 2 END, a.updated_at ASC
+    `, id)
+	if err != nil {
+		return nil, fmt.Errorf("list event rsvps: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rsvp EventRSVP
+		if err := rows.Scan(&rsvp.UserID, &rsvp.Username, &rsvp.AvatarURL, &rsvp.Status, &rsvp.Headcount, &rsvp.Comment); err != nil {
+			return nil, fmt.Errorf("scan event rsvp: %w", err)
+		}
+		if rsvp.Status == RSVPMaybe {
+			detail.Maybe += rsvp.Headcount
+		}
+		detail.RSVPs = append(detail.RSVPs, rsvp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows event rsvp: %w", err)
+	}
+	return detail, nil
+}
+
+// CreateEvent stores an event in the workspace with the given candidate
+// venues. Restaurants outside the workspace are skipped.
+func (s *EventService) CreateEvent(event Event, restaurantIDs []int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO events (workspace_id, title, starts_at, ends_at, budget_per_person, note, created_by)
+        VALUES (?, ?, ?, ?, NULLIF(?, 0), ?, ?)
+    `, s.workspaceID, event.Title, event.StartsAt.UTC(), nullTime(event.EndsAt), event.BudgetPerPerson, event.Note, event.CreatedBy)
+	if err != nil {
+		return 0, fmt.Errorf("create event: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("event id: %w", err)
+	}
+	for _, restaurantID := range restaurantIDs {
+		if err := addEventCandidate(tx, s.workspaceID, int(id), restaurantID, event.CreatedBy); err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateEvent saves the event's title, times, budget and note.
+func (s *EventService) UpdateEvent(event Event) error {
+	result, err := s.db.Exec(`
+        UPDATE events
+        SET title = ?, starts_at = ?, ends_at = ?, budget_per_person = NULLIF(?, 0), note = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND workspace_id = ?
+    `, event.Title, event.StartsAt.UTC(), nullTime(event.EndsAt), event.BudgetPerPerson, event.Note, event.ID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("update event: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// DeleteEvent deletes the event with its candidates, votes and answers. The
+// calendar feeds it appeared in keep it as cancelled until it is older than
+// the feed's history.
+func (s *EventService) DeleteEvent(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+        INSERT OR IGNORE INTO cancelled_events (event_id, user_id, workspace_id, title, starts_at, ends_at)
+        SELECT e.id, f.user_id, e.workspace_id, e.title, e.starts_at, e.ends_at
+        FROM events e
+        JOIN (
+            SELECT created_by AS user_id FROM events WHERE id = ?
+            UNION SELECT user_id FROM event_rsvps WHERE event_id = ? AND status IN ('yes', 'maybe')
+        ) f
+        WHERE e.id = ? AND e.workspace_id = ?
+    `, id, id, id, s.workspaceID); err != nil {
+		return fmt.Errorf("record cancelled event: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM cancelled_events WHERE starts_at < ?", time.Now().Add(-calendarFeedHistory).UTC()); err != nil {
+		return fmt.Errorf("prune cancelled events: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM events WHERE id = ? AND workspace_id = ?", id, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("delete event: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	for _, table := range []string{"event_votes", "event_candidates", "event_rsvps"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE event_id = ?", id); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// AddCandidate adds a restaurant of the workspace as a candidate venue. Adding
+// one twice is not an error.
+func (s *EventService) AddCandidate(eventID, restaurantID, userID int) error {
+	return addEventCandidate(s.db, s.workspaceID, eventID, restaurantID, userID)
+}
+
+// eventCandidateWriter is a *sql.DB or *sql.Tx.
+type eventCandidateWriter interface {
+	execer
+	rowQueryer
+}
+
+func addEventCandidate(db eventCandidateWriter, workspaceID, eventID, restaurantID, userID int) error {
+	var exists int
+	err := db.QueryRow(`
+        SELECT 1 FROM events e
+        JOIN restaurants r ON r.id = ? AND r.workspace_id = e.workspace_id
+        WHERE e.id = ? AND e.workspace_id = ?
+    `, restaurantID, eventID, workspaceID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("find event restaurant: %w", err)
+	}
+	if _, err := db.Exec(`
+        INSERT OR IGNORE INTO event_candidates (event_id, restaurant_id, added_by)
+        VALUES (?, ?, NULLIF(?, 0))
+    `, eventID, restaurantID, userID); err != nil {
+		return fmt.Errorf("add event candidate: %w", err)
+	}
+	return nil
+}
+
+// RemoveCandidate removes a candidate venue and its votes. When it was the
+// decided venue, the event goes back to undecided.
+func (s *EventService) RemoveCandidate(eventID, restaurantID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        DELETE FROM event_candidates
+        WHERE event_id = ? AND restaurant_id = ?
+          AND event_id IN (SELECT id FROM events WHERE workspace_id = ?)
+    `, eventID, restaurantID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("remove event candidate: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM event_votes WHERE event_id = ? AND restaurant_id = ?", eventID, restaurantID); err != nil {
+		return fmt.Errorf("delete event votes: %w", err)
+	}
+	if _, err := tx.Exec(`
+        UPDATE events SET final_restaurant_id = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND final_restaurant_id = ?
+    `, eventID, restaurantID); err != nil {
+		return fmt.Errorf("clear event venue: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// ToggleVote adds the user's vote for a candidate, or takes it back when the
+// user has already voted for it. It returns sql.ErrNoRows when the restaurant
+// is not a candidate of the event.
+func (s *EventService) ToggleVote(eventID, restaurantID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`
+        SELECT 1 FROM event_candidates c
+        JOIN events e ON e.id = c.event_id
+        WHERE c.event_id = ? AND c.restaurant_id = ? AND e.workspace_id = ?
+    `, eventID, restaurantID, s.workspaceID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("find event candidate: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM event_votes WHERE event_id = ? AND restaurant_id = ? AND user_id = ?", eventID, restaurantID, userID)
+	if err != nil {
+		return fmt.Errorf("delete event vote: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if affected == 0 {
+		if _, err := tx.Exec("INSERT INTO event_votes (event_id, restaurant_id, user_id) VALUES (?, ?, ?)", eventID, restaurantID, userID); err != nil {
+			return fmt.Errorf("add event vote: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// SetRSVP records the user's answer. headcount includes the user and any
+// guests they bring.
+func (s *EventService) SetRSVP(eventID, userID int, status string, headcount int, comment string) error {
+	switch status {
+	case RSVPYes, RSVPMaybe:
+	case RSVPNo:
+		headcount = 0
+	default:
+		return fmt.Errorf("set rsvp: invalid status %q", status)
+	}
+	result, err := s.db.Exec(`
+        INSERT INTO event_rsvps (event_id, user_id, status, headcount, comment)
+        SELECT id, ?, ?, ?, ? FROM events WHERE id = ? AND workspace_id = ?
+        ON CONFLICT(event_id, user_id) DO UPDATE SET
+            status = excluded.status,
+            headcount = excluded.headcount,
+            comment = excluded.comment,
+            updated_at = CURRENT_TIMESTAMP
+    `, userID, status, headcount, comment, eventID, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("set rsvp: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// Decide sets the event's venue to one of its candidates, or clears it when
+// restaurantID is 0.
+func (s *EventService) Decide(eventID, restaurantID int) error {
+	var result sql.Result
+	var err error
+	if restaurantID == 0 {
+		result, err = s.db.Exec(`
+            UPDATE events SET final_restaurant_id = NULL, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND workspace_id = ?
+        `, eventID, s.workspaceID)
+	} else {
+		result, err = s.db.Exec(`
+            UPDATE events SET final_restaurant_id = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND workspace_id = ?
+              AND EXISTS (SELECT 1 FROM event_candidates WHERE event_id = ? AND restaurant_id = ?)
+        `, restaurantID, eventID, s.workspaceID, eventID, restaurantID)
+	}
+	if err != nil {
+		return fmt.Errorf("decide event venue: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// CalendarToken returns the user's calendar feed token, creating one the
+// first time.
+func (s *EventService) CalendarToken(userID int) (string, error) {
+	var token string
+	err := s.db.QueryRow("SELECT token FROM calendar_feeds WHERE user_id = ?", userID).Scan(&token)
+	if err == nil {
+		return token, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("get calendar token: %w", err)
+	}
+	return s.ResetCalendarToken(userID)
+}
+
+// ResetCalendarToken replaces the user's calendar feed token, so the old feed
+// URL stops working.
+func (s *EventService) ResetCalendarToken(userID int) (string, error) {
+	token, err := util.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.Exec(`
+        INSERT INTO calendar_feeds (user_id, token) VALUES (?, ?)
+        ON CONFLICT(user_id) DO UPDATE SET token = excluded.token, created_at = CURRENT_TIMESTAMP
+    `, userID, token); err != nil {
+		return "", fmt.Errorf("reset calendar token: %w", err)
+	}
+	return token, nil
+}
+
+// CalendarFeed returns the owner of the feed token and the events for their
+// feed: those they created or answered yes or maybe to, from the last 90 days
+// on, in every workspace they can still see, with the ones deleted since
+// marked by CancelledAt. The user ID is 0 when the token is unknown.
+func (s *EventService) CalendarFeed(token string, now time.Time) (int, []Event, error) {
+	var userID int
+	err := s.db.QueryRow("SELECT user_id FROM calendar_feeds WHERE token = ?", token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("get calendar feed: %w", err)
+	}
+	rows, err := s.db.Query(`SELECT `+eventColumns+eventJoins+`
+        JOIN workspaces w ON w.id = e.workspace_id
+        WHERE e.starts_at >= ?
+          AND (w.is_public = 1 OR EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = e.workspace_id AND m.user_id = ?))
+          AND (e.created_by = ? OR EXISTS (SELECT 1 FROM event_rsvps a WHERE a.event_id = e.id AND a.user_id = ? AND a.status IN ('yes', 'maybe')))
+        ORDER BY e.starts_at ASC, e.id ASC
+    `, now.Add(-calendarFeedHistory).UTC(), userID, userID, userID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("list calendar feed: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return 0, nil, fmt.Errorf("scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("rows event: %w", err)
+	}
+	cancelled, err := s.cancelledEvents(userID, now)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(cancelled) > 0 {
+		events = append(events, cancelled...)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].StartsAt.Before(events[j].StartsAt) })
+	}
+	return userID, events, nil
+}
+
+// cancelledEvents returns the deleted events that were in the user's feed.
+func (s *EventService) cancelledEvents(userID int, now time.Time) ([]Event, error) {
+	rows, err := s.db.Query(`
+        SELECT c.event_id, c.workspace_id, c.title, c.starts_at, c.ends_at, c.cancelled_at
+        FROM cancelled_events c
+        JOIN workspaces w ON w.id = c.workspace_id
+        WHERE c.user_id = ? AND c.starts_at >= ?
+          AND (w.is_public = 1 OR EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = c.workspace_id AND m.user_id = ?))
+        ORDER BY c.starts_at ASC, c.event_id ASC
+    `, userID, now.Add(-calendarFeedHistory).UTC(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list cancelled events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var endsAt sql.NullTime
+		if err := rows.Scan(&event.ID, &event.WorkspaceID, &event.Title, &event.StartsAt, &endsAt, &event.CancelledAt); err != nil {
+			return nil, fmt.Errorf("scan cancelled event: %w", err)
+		}
+		if endsAt.Valid {
+			event.EndsAt = endsAt.Time
+		}
+		event.UpdatedAt = event.CancelledAt
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows cancelled event: %w", err)
+	}
+	return events, nil
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeletedEventStaysInFeedsAsCancelled(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	bob := insertUser(t, database, "bob")
+	carol := insertUser(t, database, "carol")
+	events := NewEventService(database).InWorkspace(1)
+	now := time.Now()
+	startsAt := now.Add(48 * time.Hour).Truncate(time.Second)
+
+	id, err := events.CreateEvent(Event{Title: "忘年会", StartsAt: startsAt, CreatedBy: alice}, nil)
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if err := events.SetRSVP(id, bob, RSVPYes, 2, ""); err != nil {
+		t.Fatalf("SetRSVP: %v", err)
+	}
+	if err := events.SetRSVP(id, carol, RSVPNo, 1, ""); err != nil {
+		t.Fatalf("SetRSVP: %v", err)
+	}
+	if err := events.DeleteEvent(id); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		userID int
+		want   bool
+	}{
+		{"creator", alice, true},
+		{"attendee", bob, true},
+		{"declined", carol, false},
+	} {
+		token, err := events.CalendarToken(tt.userID)
+		if err != nil {
+			t.Fatalf("CalendarToken: %v", err)
+		}
+		_, feed, err := events.CalendarFeed(token, now)
+		if err != nil {
+			t.Fatalf("CalendarFeed: %v", err)
+		}
+		if !tt.want {
+			if len(feed) != 0 {
+				t.Errorf("%s: feed = %+v, want empty", tt.name, feed)
+			}
+			continue
+		}
+		if len(feed) != 1 {
+			t.Fatalf("%s: feed has %d events, want 1", tt.name, len(feed))
+		}
+		event := feed[0]
+		if event.ID != id || event.Title != "忘年会" || !event.StartsAt.Equal(startsAt) || event.CancelledAt.IsZero() {
+			t.Errorf("%s: feed event = %+v, want event %d cancelled", tt.name, event, id)
+		}
+	}
+
+	if err := events.DeleteEvent(id); err == nil {
+		t.Error("deleting the event again succeeded")
+	}
+	other := NewEventService(database).InWorkspace(insertWorkspace(t, database, "lab"))
+	kept, err := events.CreateEvent(Event{Title: "歓迎会", StartsAt: startsAt, CreatedBy: alice}, nil)
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if err := other.DeleteEvent(kept); err == nil {
+		t.Error("deleted an event from another workspace")
+	}
+	var tombstones int
+	if err := database.QueryRow("SELECT COUNT(*) FROM cancelled_events WHERE event_id = ?", kept).Scan(&tombstones); err != nil {
+		t.Fatal(err)
+	}
+	if tombstones != 0 {
+		t.Errorf("a failed delete left %d cancelled records", tombstones)
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	PhotoSourceRestaurant = "restaurant"
+	PhotoSourceReview     = "review"
+)
+
+// GalleryPhoto is a photo from either restaurant_photos or review_photos,
+// together with what it belongs to and who uploaded it.
+type GalleryPhoto struct {
+	Source         string
+	ID             int
+	Path           string
+	Caption        string
+	RestaurantID   int
+	RestaurantName string
+	ReviewID       int
+	UploaderID     int
+	UploaderName   string
+	Latitude       float64
+	Longitude      float64
+	CreatedAt      string
+}
+
+// GalleryFilter narrows the gallery. Zero values disable a filter; the radius
+// filter applies only when RadiusKm > 0.
+type GalleryFilter struct {
+	Tag        string
+	UploaderID int
+	Latitude   float64
+	Longitude  float64
+	RadiusKm   float64
+	Limit      int
+	Offset     int
+}
+
+// GalleryService lists the photos of one workspace. Like BaseService it sees
+// nothing until scoped with InWorkspace.
+type GalleryService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewGalleryService(db *sql.DB) *GalleryService {
+	return &GalleryService{db: db}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *GalleryService) InWorkspace(workspaceID int) *GalleryService {
+	return &GalleryService{db: s.db, workspaceID: workspaceID}
+}
+
+// ListPhotos returns photos newest first. The second return value reports
+// whether more photos exist after this page.
+func (s *GalleryService) ListPhotos(filter GalleryFilter) ([]GalleryPhoto, bool, error) {
+	conditions := []string{"g.workspace_id = ?"}
+	args := []interface{}{s.workspaceID}
+	if filter.Tag != "" {
+		conditions = append(conditions, `g.restaurant_id IN (
+            SELECT rt.restaurant_id FROM restaurant_tags rt INNER JOIN tags t ON t.id = rt.tag_id WHERE t.name = ?
+        )`)
+		args = append(args, filter.Tag)
+	}
+	if filter.UploaderID != 0 {
+		conditions = append(conditions, "g.uploader_id = ?")
+		args = append(args, filter.UploaderID)
+	}
+	if filter.RadiusKm > 0 {
+		minLat, maxLat, minLng, maxLng := util.BoundingBox(filter.Latitude, filter.Longitude, filter.RadiusKm)
+		conditions = append(conditions, "g.latitude BETWEEN ? AND ? AND g.longitude BETWEEN ? AND ?")
+		args = append(args, minLat, maxLat, minLng, maxLng)
+		// The bounding box lets the index do the work; the circle itself is
+		// checked in SQL too so that LIMIT and OFFSET count the right photos.
+		kmPerLat, kmPerLng := util.KmPerDegree(filter.Latitude)
+		conditions = append(conditions, "((g.latitude - ?) * ?) * ((g.latitude - ?) * ?) + ((g.longitude - ?) * ?) * ((g.longitude - ?) * ?) <= ?")
+		args = append(args,
+			filter.Latitude, kmPerLat, filter.Latitude, kmPerLat,
+			filter.Longitude, kmPerLng, filter.Longitude, kmPerLng,
+			filter.RadiusKm*filter.RadiusKm)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 24
+	}
+	where := "WHERE " + strings.Join(conditions, " AND ")
+
+	query := `
+        SELECT g.source, g.id, g.path, g.caption, g.restaurant_id, g.restaurant_name, g.review_id,
+               g.uploader_id, COALESCE(u.username, ''), g.latitude, g.longitude, g.created_at
+        FROM (
+            SELECT 'restaurant' AS source, rp.id, rp.path, rp.caption, r.id AS restaurant_id, r.name AS restaurant_name,
+                   0 AS review_id, COALESCE(rp.uploaded_by, r.created_by) AS uploader_id,
+                   r.latitude, r.longitude, rp.created_at, r.workspace_id
+            FROM restaurant_photos rp
+            INNER JOIN restaurants r ON r.id = rp.restaurant_id
+            UNION ALL
+            SELECT 'review' AS source, vp.id, vp.path, vp.caption, r.id, r.name,
+                   v.id, v.user_id, r.latitude, r.longitude, vp.created_at, r.workspace_id
+            FROM review_photos vp
+            INNER JOIN reviews v ON v.id = vp.review_id
+            INNER JOIN restaurants r ON r.id = v.restaurant_id
+        ) g
+        LEFT JOIN users u ON u.id = g.uploader_id
+        ` + where + `
+        ORDER BY g.created_at DESC, g.id DESC
+        LIMIT ? OFFSET ?
+    `
+	// One extra row tells whether there is a next page.
+	args = append(args, limit+1, filter.Offset)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("list gallery: %w", err)
+	}
+	defer rows.Close()
+
+	photos := make([]GalleryPhoto, 0, limit)
+	hasMore := false
+	for rows.Next() {
+		var photo GalleryPhoto
+		if err := rows.Scan(
+			&photo.Source,
+			&photo.ID,
+			&photo.Path,
+			&photo.Caption,
+			&photo.RestaurantID,
+			&photo.RestaurantName,
+			&photo.ReviewID,
+			&photo.UploaderID,
+			&photo.UploaderName,
+			&photo.Latitude,
+			&photo.Longitude,
+			&photo.CreatedAt,
+		); err != nil {
+			return nil, false, fmt.Errorf("scan gallery: %w", err)
+		}
+		if len(photos) == limit {
+			hasMore = true
+			break
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("rows gallery: %w", err)
+	}
+	return photos, hasMore, nil
+}
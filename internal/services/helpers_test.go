@@ -0,0 +1,63 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"example.com/gourmetkan/internal/db"
+)
+
+// newTestDB opens a fresh database with the schema applied and foreign keys
+// enforced on every pooled connection.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.EnsureSchema(database); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	return database
+}
+
+// insert runs an INSERT and returns the new row's id.
+func insert(t *testing.T, database *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	result, err := database.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("last insert id: %v", err)
+	}
+	return int(id)
+}
+
+func insertUser(t *testing.T, database *sql.DB, name string) int {
+	t.Helper()
+	return insert(t, database, "INSERT INTO users (github_id, username, avatar_url) VALUES (?, ?, '')", "gh-"+name, name)
+}
+
+func insertWorkspace(t *testing.T, database *sql.DB, name string) int {
+	t.Helper()
+	return insert(t, database, "INSERT INTO workspaces (name) VALUES (?)", name)
+}
+
+func insertRestaurant(t *testing.T, database *sql.DB, workspaceID, createdBy int, name string) int {
+	t.Helper()
+	return insert(t, database, `
+        INSERT INTO restaurants (name, description, latitude, longitude, address, maps_url, created_by, workspace_id)
+        VALUES (?, '', 34.81, 135.56, '', '', ?, ?)
+    `, name, createdBy, workspaceID)
+}
+
+func insertReview(t *testing.T, database *sql.DB, restaurantID, userID, rating int) int {
+	t.Helper()
+	return insert(t, database, "INSERT INTO reviews (restaurant_id, user_id, rating, comment) VALUES (?, ?, ?, 'c')", restaurantID, userID, rating)
+}
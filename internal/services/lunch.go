@@ -0,0 +1,385 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+// ErrLunchClosed is returned when joining or voting after a lunch session has
+// been decided.
+var ErrLunchClosed = errors.New("lunch session is closed")
+
+const (
+	LunchVote = 1
+	LunchVeto = -1
+)
+
+// LunchSession is a group vote between a few candidate restaurants. Anyone
+// with its link who can see the session's workspace can take part.
+type LunchSession struct {
+	ID          int
+	Token       string
+	WorkspaceID int
+	CreatedBy   int
+	CreatorName string
+	BaseName    string
+	RadiusKm    float64
+	// Conditions describes the filters the candidates were drawn with.
+	Conditions string
+	Deadline   time.Time
+	WinnerID   int
+	ClosedAt   time.Time
+}
+
+func (s LunchSession) Closed() bool {
+	return !s.ClosedAt.IsZero()
+}
+
+type LunchVoter struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type LunchCandidate struct {
+	RestaurantID int          `json:"restaurant_id"`
+	Name         string       `json:"name"`
+	PhotoPath    string       `json:"-"`
+	Votes        []LunchVoter `json:"votes"`
+	Vetoes       []LunchVoter `json:"vetoes"`
+}
+
+// LunchState is everything a participant sees of a session.
+type LunchState struct {
+	Session      LunchSession
+	Candidates   []LunchCandidate
+	Participants []LunchVoter
+}
+
+type LunchService struct {
+	db          *sql.DB
+	now         func() time.Time
+	workspaceID int
+}
+
+func NewLunchService(db *sql.DB) *LunchService {
+	return &LunchService{db: db, now: time.Now}
+}
+
+// InWorkspace returns a copy of the service that only finds the workspace's
+// sessions.
+func (s *LunchService) InWorkspace(workspaceID int) *LunchService {
+	return &LunchService{db: s.db, now: s.now, workspaceID: workspaceID}
+}
+
+// CreateSession stores a session in the workspace with its candidates in the
+// given order and makes the creator its first participant. It returns the
+// session token.
+func (s *LunchService) CreateSession(session LunchSession, restaurantIDs []int) (string, error) {
+	if len(restaurantIDs) == 0 {
+		return "", fmt.Errorf("create lunch session: no candidates")
+	}
+	token, err := util.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO lunch_sessions (token, workspace_id, created_by, base_name, radius_km, conditions, deadline)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, token, s.workspaceID, session.CreatedBy, session.BaseName, session.RadiusKm, session.Conditions, session.Deadline.UTC())
+	if err != nil {
+		return "", fmt.Errorf("create lunch session: %w", err)
+	}
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return "", fmt.Errorf("lunch session id: %w", err)
+	}
+	for position, restaurantID := range restaurantIDs {
+		if _, err := tx.Exec("INSERT INTO lunch_candidates (session_id, restaurant_id, position) VALUES (?, ?, ?)", sessionID, restaurantID, position); err != nil {
+			return "", fmt.Errorf("add lunch candidate: %w", err)
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO lunch_participants (session_id, user_id) VALUES (?, ?)", sessionID, session.CreatedBy); err != nil {
+		return "", fmt.Errorf("add lunch participant: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit tx: %w", err)
+	}
+	return token, nil
+}
+
+// GetSession returns the session, or nil when there is no such session.
+// Sessions past their deadline are closed by CloseDue.
+func (s *LunchService) GetSession(token string) (*LunchSession, error) {
+	var session LunchSession
+	var winnerID sql.NullInt64
+	var closedAt sql.NullTime
+	err := s.db.QueryRow(`
+        SELECT l.id, l.token, l.workspace_id, l.created_by, u.username, l.base_name, l.radius_km, l.conditions, l.deadline, l.winner_restaurant_id, l.closed_at
+        FROM lunch_sessions l
+        INNER JOIN users u ON u.id = l.created_by
+        WHERE l.token = ? AND l.workspace_id = ?
+    `, token, s.workspaceID).Scan(&session.ID, &session.Token, &session.WorkspaceID, &session.CreatedBy, &session.CreatorName, &session.BaseName, &session.RadiusKm, &session.Conditions, &session.Deadline, &winnerID, &closedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get lunch session: %w", err)
+	}
+	session.WinnerID = int(winnerID.Int64)
+	if closedAt.Valid {
+		session.ClosedAt = closedAt.Time
+	}
+	return &session, nil
+}
+
+// CloseDue closes every open session whose deadline has passed, in all
+// workspaces, and returns them. It also returns the earliest deadline of the
+// sessions still open, zero when there are none.
+func (s *LunchService) CloseDue() ([]LunchSession, time.Time, error) {
+	rows, err := s.db.Query("SELECT id, token, workspace_id, deadline FROM lunch_sessions WHERE closed_at IS NULL")
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("list open lunch sessions: %w", err)
+	}
+	var open []LunchSession
+	for rows.Next() {
+		var session LunchSession
+		if err := rows.Scan(&session.ID, &session.Token, &session.WorkspaceID, &session.Deadline); err != nil {
+			rows.Close()
+			return nil, time.Time{}, fmt.Errorf("scan open lunch session: %w", err)
+		}
+		open = append(open, session)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, time.Time{}, fmt.Errorf("rows open lunch session: %w", err)
+	}
+	rows.Close()
+
+	now := s.now()
+	var closed []LunchSession
+	var next time.Time
+	for _, session := range open {
+		if now.Before(session.Deadline) {
+			if next.IsZero() || session.Deadline.Before(next) {
+				next = session.Deadline
+			}
+			continue
+		}
+		if err := s.Close(session.ID); err != nil {
+			return closed, next, err
+		}
+		closed = append(closed, session)
+	}
+	return closed, next, nil
+}
+
+// GetState returns the session with its candidates, votes and participants,
+// or nil when there is no such session.
+func (s *LunchService) GetState(token string) (*LunchState, error) {
+	session, err := s.GetSession(token)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	state := &LunchState{Session: *session}
+
+	rows, err := s.db.Query(`
+        SELECT c.restaurant_id, r.name, COALESCE(r.photo_path, '')
+        FROM lunch_candidates c
+        INNER JOIN restaurants r ON r.id = c.restaurant_id
+        WHERE c.session_id = ?
+        ORDER BY c.position ASC
+    `, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list lunch candidates: %w", err)
+	}
+	defer rows.Close()
+	index := make(map[int]int)
+	for rows.Next() {
+		var candidate LunchCandidate
+		if err := rows.Scan(&candidate.RestaurantID, &candidate.Name, &candidate.PhotoPath); err != nil {
+			return nil, fmt.Errorf("scan lunch candidate: %w", err)
+		}
+		candidate.Votes = []LunchVoter{}
+		candidate.Vetoes = []LunchVoter{}
+		index[candidate.RestaurantID] = len(state.Candidates)
+		state.Candidates = append(state.Candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows lunch candidate: %w", err)
+	}
+
+	voteRows, err := s.db.Query(`
+        SELECT v.restaurant_id, v.user_id, u.username, v.value
+        FROM lunch_votes v
+        INNER JOIN users u ON u.id = v.user_id
+        WHERE v.session_id = ?
+        ORDER BY v.created_at ASC, u.username ASC
+    `, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list lunch votes: %w", err)
+	}
+	defer voteRows.Close()
+	for voteRows.Next() {
+		var restaurantID, value int
+		var voter LunchVoter
+		if err := voteRows.Scan(&restaurantID, &voter.UserID, &voter.Username, &value); err != nil {
+			return nil, fmt.Errorf("scan lunch vote: %w", err)
+		}
+		i, ok := index[restaurantID]
+		if !ok {
+			continue
+		}
+		if value == LunchVeto {
+			state.Candidates[i].Vetoes = append(state.Candidates[i].Vetoes, voter)
+		} else {
+			state.Candidates[i].Votes = append(state.Candidates[i].Votes, voter)
+		}
+	}
+	if err := voteRows.Err(); err != nil {
+		return nil, fmt.Errorf("rows lunch vote: %w", err)
+	}
+
+	participantRows, err := s.db.Query(`
+        SELECT u.id, u.username
+        FROM lunch_participants p
+        INNER JOIN users u ON u.id = p.user_id
+        WHERE p.session_id = ?
+        ORDER BY p.joined_at ASC, u.username ASC
+    `, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list lunch participants: %w", err)
+	}
+	defer participantRows.Close()
+	for participantRows.Next() {
+		var participant LunchVoter
+		if err := participantRows.Scan(&participant.UserID, &participant.Username); err != nil {
+			return nil, fmt.Errorf("scan lunch participant: %w", err)
+		}
+		state.Participants = append(state.Participants, participant)
+	}
+	if err := participantRows.Err(); err != nil {
+		return nil, fmt.Errorf("rows lunch participant: %w", err)
+	}
+	return state, nil
+}
+
+// Join adds the user to the session's participants. Joining twice is harmless.
+func (s *LunchService) Join(sessionID, userID int) error {
+	if err := s.ensureOpen(s.db, sessionID); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO lunch_participants (session_id, user_id) VALUES (?, ?)", sessionID, userID); err != nil {
+		return fmt.Errorf("join lunch session: %w", err)
+	}
+	return nil
+}
+
+// Vote records a vote or veto (LunchVote / LunchVeto) on a candidate and joins
+// the user if needed. Casting the same vote again takes it back. It returns
+// sql.ErrNoRows when the restaurant is not a candidate.
+func (s *LunchService) Vote(sessionID, restaurantID, userID, value int) error {
+	if value != LunchVote && value != LunchVeto {
+		return fmt.Errorf("invalid lunch vote %d", value)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.ensureOpen(tx, sessionID); err != nil {
+		return err
+	}
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM lunch_candidates WHERE session_id = ? AND restaurant_id = ?", sessionID, restaurantID).Scan(&exists); err != nil {
+		return fmt.Errorf("check lunch candidate: %w", err)
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	var current int
+	err = tx.QueryRow("SELECT value FROM lunch_votes WHERE session_id = ? AND restaurant_id = ? AND user_id = ?", sessionID, restaurantID, userID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("get lunch vote: %w", err)
+	}
+	if current == value {
+		if _, err := tx.Exec("DELETE FROM lunch_votes WHERE session_id = ? AND restaurant_id = ? AND user_id = ?", sessionID, restaurantID, userID); err != nil {
+			return fmt.Errorf("delete lunch vote: %w", err)
+		}
+	} else if _, err := tx.Exec(`
+		INSERT INTO lunch_votes (session_id, restaurant_id, user_id, value) VALUES (?, ?, ?, ?)
+		ON CONFLICT (session_id, restaurant_id, user_id) DO UPDATE SET value = excluded.value, created_at = CURRENT_TIMESTAMP
+	`, sessionID, restaurantID, userID, value); err != nil {
+		return fmt.Errorf("save lunch vote: %w", err)
+	}
+	if _, err := tx.Exec("INSERT OR IGNORE INTO lunch_participants (session_id, user_id) VALUES (?, ?)", sessionID, userID); err != nil {
+		return fmt.Errorf("join lunch session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// Close decides the session. The winner is the candidate with the fewest
+// vetoes, then the most votes, then the earliest position, so an unvetoed
+// place always beats a vetoed one. Closing a closed session does nothing.
+func (s *LunchService) Close(sessionID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var winnerID int
+	err = tx.QueryRow(`
+        SELECT c.restaurant_id
+        FROM lunch_candidates c
+        LEFT JOIN lunch_votes v ON v.session_id = c.session_id AND v.restaurant_id = c.restaurant_id
+        WHERE c.session_id = ?
+        GROUP BY c.restaurant_id
+        ORDER BY SUM(CASE WHEN v.value = -1 THEN 1 ELSE 0 END) ASC,
+                 SUM(CASE WHEN v.value = 1 THEN 1 ELSE 0 END) DESC,
+                 MIN(c.position) ASC
+        LIMIT 1
+    `, sessionID).Scan(&winnerID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("pick lunch winner: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE lunch_sessions SET winner_restaurant_id = NULLIF(?, 0), closed_at = ? WHERE id = ? AND closed_at IS NULL", winnerID, s.now().UTC(), sessionID); err != nil {
+		return fmt.Errorf("close lunch session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+func (s *LunchService) ensureOpen(q rowQueryer, sessionID int) error {
+	var deadline time.Time
+	var closedAt sql.NullTime
+	err := q.QueryRow("SELECT deadline, closed_at FROM lunch_sessions WHERE id = ?", sessionID).Scan(&deadline, &closedAt)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("get lunch session: %w", err)
+	}
+	if closedAt.Valid || !s.now().Before(deadline) {
+		return ErrLunchClosed
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLunchSessionsStayInWorkspace(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	lab := insertWorkspace(t, database, "lab")
+	first := insertRestaurant(t, database, lab, alice, "first")
+	second := insertRestaurant(t, database, lab, alice, "second")
+	lunches := NewLunchService(database)
+
+	token, err := lunches.InWorkspace(lab).CreateSession(LunchSession{
+		CreatedBy: alice,
+		BaseName:  "station",
+		RadiusKm:  1,
+		Deadline:  time.Now().Add(time.Hour),
+	}, []int{first, second})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	state, err := lunches.InWorkspace(lab).GetState(token)
+	if err != nil || state == nil {
+		t.Fatalf("GetState in the session's workspace = %v, %v", state, err)
+	}
+	if len(state.Candidates) != 2 {
+		t.Errorf("got %d candidates, want 2", len(state.Candidates))
+	}
+	state, err = lunches.InWorkspace(1).GetState(token)
+	if err != nil {
+		t.Fatalf("GetState in another workspace: %v", err)
+	}
+	if state != nil {
+		t.Errorf("GetState in another workspace = %+v, want nil", state.Session)
+	}
+}
+
+func TestCloseDue(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	lab := insertWorkspace(t, database, "lab")
+	first := insertRestaurant(t, database, lab, alice, "first")
+	second := insertRestaurant(t, database, lab, alice, "second")
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	lunches := NewLunchService(database)
+	lunches.now = func() time.Time { return now }
+	create := func(deadline time.Time) string {
+		token, err := lunches.InWorkspace(lab).CreateSession(LunchSession{CreatedBy: alice, BaseName: "station", RadiusKm: 1, Deadline: deadline}, []int{first, second})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		return token
+	}
+	due := create(now.Add(-time.Minute))
+	soon := create(now.Add(5 * time.Minute))
+	create(now.Add(time.Hour))
+
+	closed, next, err := lunches.CloseDue()
+	if err != nil {
+		t.Fatalf("CloseDue: %v", err)
+	}
+	if len(closed) != 1 || closed[0].Token != due || closed[0].WorkspaceID != lab {
+		t.Fatalf("CloseDue closed %+v, want only %s in workspace %d", closed, due, lab)
+	}
+	if !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("next deadline = %v, want %v", next, now.Add(5*time.Minute))
+	}
+	state, err := lunches.InWorkspace(lab).GetState(due)
+	if err != nil || state == nil {
+		t.Fatalf("GetState = %v, %v", state, err)
+	}
+	if !state.Session.Closed() || state.Session.WinnerID != first {
+		t.Errorf("closed session = %+v, want closed with winner %d", state.Session, first)
+	}
+
+	now = now.Add(5 * time.Minute)
+	closed, _, err = lunches.CloseDue()
+	if err != nil {
+		t.Fatalf("CloseDue: %v", err)
+	}
+	if len(closed) != 1 || closed[0].Token != soon {
+		t.Errorf("CloseDue at the second deadline closed %+v, want only %s", closed, soon)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+// MapLinkService expands shared map links (e.g. maps.app.goo.gl short links)
+// through the SafeFetcher and remembers the result so a link is fetched once.
+type MapLinkService struct {
+	db      *sql.DB
+	fetcher *util.SafeFetcher
+}
+
+func NewMapLinkService(db *sql.DB, fetcher *util.SafeFetcher) *MapLinkService {
+	return &MapLinkService{db: db, fetcher: fetcher}
+}
+
+// Expand returns the URL that raw finally points to. Links whose coordinates can
+// already be parsed are returned unchanged without any network access; links
+// pasted without a scheme are taken as https.
+func (s *MapLinkService) Expand(ctx context.Context, raw string) (string, error) {
+	if _, ok := util.ParseMapLocation(raw); ok {
+		return raw, nil
+	}
+	raw = util.WithDefaultScheme(raw)
+	if !s.fetcher.Allowed(raw) {
+		return "", util.ErrURLNotAllowed
+	}
+
+	var cached string
+	err := s.db.QueryRowContext(ctx, "SELECT expanded_url FROM map_url_expansions WHERE source_url = ?", raw).Scan(&cached)
+	if err == nil {
+		return cached, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("get map url expansion: %w", err)
+	}
+
+	expanded, err := s.fetcher.ExpandURL(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO map_url_expansions (source_url, expanded_url) VALUES (?, ?)
+		ON CONFLICT(source_url) DO UPDATE SET expanded_url = excluded.expanded_url, created_at = CURRENT_TIMESTAMP
+	`, raw, expanded); err != nil {
+		return "", fmt.Errorf("store map url expansion: %w", err)
+	}
+	return expanded, nil
+}
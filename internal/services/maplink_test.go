@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+func TestMapLinkExpandSchemeLessLink(t *testing.T) {
+	database := newTestDB(t)
+	// A cached expansion keeps the test off the network; it is stored under
+	// the normalized URL, so finding it shows the scheme was added first.
+	insert(t, database, "INSERT INTO map_url_expansions (source_url, expanded_url) VALUES (?, ?)",
+		"https://maps.app.goo.gl/xyz", "https://www.google.com/maps/place/@34.8,135.5,17z")
+	service := NewMapLinkService(database, util.NewSafeFetcher(util.DefaultMapsURLAllowlist, time.Second))
+
+	got, err := service.Expand(context.Background(), "maps.app.goo.gl/xyz")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if want := "https://www.google.com/maps/place/@34.8,135.5,17z"; got != want {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+
+	for _, raw := range []string{"example.com/maps", "http://127.0.0.1/", "http://[::1]/", "http://169.254.169.254/"} {
+		if _, err := service.Expand(context.Background(), raw); !errors.Is(err, util.ErrURLNotAllowed) {
+			t.Errorf("Expand(%q) error = %v, want ErrURLNotAllowed", raw, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// MarkKind is one of the personal lists a user can put a restaurant on.
+type MarkKind string
+
+const (
+	MarkFavorite MarkKind = "favorite"
+	MarkWantToGo MarkKind = "want_to_go"
+)
+
+// ParseMarkKind returns the kind named by value, or false if there is none.
+func ParseMarkKind(value string) (MarkKind, bool) {
+	switch kind := MarkKind(value); kind {
+	case MarkFavorite, MarkWantToGo:
+		return kind, true
+	default:
+		return "", false
+	}
+}
+
+// RestaurantMarks is what a user has marked a restaurant as.
+type RestaurantMarks struct {
+	Favorite bool
+	WantToGo bool
+}
+
+// Has reports whether the mark of the kind is set.
+func (m RestaurantMarks) Has(kind MarkKind) bool {
+	switch kind {
+	case MarkFavorite:
+		return m.Favorite
+	case MarkWantToGo:
+		return m.WantToGo
+	default:
+		return false
+	}
+}
+
+// MarkService keeps each user's favorite and want-to-go marks. Marks are
+// private to the user; the workspace only limits which restaurants are seen.
+type MarkService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewMarkService(db *sql.DB) *MarkService {
+	return &MarkService{db: db}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *MarkService) InWorkspace(workspaceID int) *MarkService {
+	return &MarkService{db: s.db, workspaceID: workspaceID}
+}
+
+// SetMark puts the restaurant on the user's list of the kind, or takes it off
+// when on is false. Either is a no-op if already so.
+func (s *MarkService) SetMark(userID, restaurantID int, kind MarkKind, on bool) error {
+	if err := ensureRestaurantInWorkspace(s.db, s.workspaceID, restaurantID); err != nil {
+		return err
+	}
+	if on {
+		if _, err := s.db.Exec("INSERT OR IGNORE INTO restaurant_marks (user_id, restaurant_id, kind) VALUES (?, ?, ?)", userID, restaurantID, string(kind)); err != nil {
+			return fmt.Errorf("set mark: %w", err)
+		}
+		return nil
+	}
+	if _, err := s.db.Exec("DELETE FROM restaurant_marks WHERE user_id = ? AND restaurant_id = ? AND kind = ?", userID, restaurantID, string(kind)); err != nil {
+		return fmt.Errorf("clear mark: %w", err)
+	}
+	return nil
+}
+
+// Marks returns the user's marks on the workspace's restaurants, keyed by
+// restaurant ID. Restaurants without marks are absent.
+func (s *MarkService) Marks(userID int) (map[int]RestaurantMarks, error) {
+	marks := make(map[int]RestaurantMarks)
+	if userID == 0 {
+		return marks, nil
+	}
+	rows, err := s.db.Query(`
+        SELECT m.restaurant_id, m.kind
+        FROM restaurant_marks m
+        INNER JOIN restaurants r ON r.id = m.restaurant_id
+        WHERE m.user_id = ? AND r.workspace_id = ?
+    `, userID, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list marks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var restaurantID int
+		var kind string
+		if err := rows.Scan(&restaurantID, &kind); err != nil {
+			return nil, fmt.Errorf("scan mark: %w", err)
+		}
+		mark := marks[restaurantID]
+		switch MarkKind(kind) {
+		case MarkFavorite:
+			mark.Favorite = true
+		case MarkWantToGo:
+			mark.WantToGo = true
+		}
+		marks[restaurantID] = mark
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows mark: %w", err)
+	}
+	return marks, nil
+}
+
+// ListMarked returns the restaurants on the user's list of the kind, most
+// recently marked first.
+func (s *MarkService) ListMarked(userID int, kind MarkKind) ([]Restaurant, error) {
+	rows, err := s.db.Query(`
+	SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url, r.created_by, r.created_at, COALESCE(r.budget, 0), COALESCE(r.opening_hours, '')
+        FROM restaurant_marks m
+        INNER JOIN restaurants r ON r.id = m.restaurant_id
+        WHERE m.user_id = ? AND m.kind = ? AND r.workspace_id = ?
+        ORDER BY m.created_at DESC, r.id DESC
+    `, userID, string(kind), s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list marked restaurants: %w", err)
+	}
+	defer rows.Close()
+
+	var restaurants []Restaurant
+	for rows.Next() {
+		var restaurant Restaurant
+		if err := rows.Scan(
+			&restaurant.ID,
+			&restaurant.Name,
+			&restaurant.Description,
+			&restaurant.PhotoPath,
+			&restaurant.Latitude,
+			&restaurant.Longitude,
+			&restaurant.Address,
+			&restaurant.MapsURL,
+			&restaurant.CreatedBy,
+			&restaurant.CreatedAt,
+			&restaurant.Budget,
+			&restaurant.OpeningHours,
+		); err != nil {
+			return nil, fmt.Errorf("scan restaurant: %w", err)
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows restaurant: %w", err)
+	}
+	return restaurants, nil
+}
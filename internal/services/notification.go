@@ -0,0 +1,113 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NotificationKind is what a notification is about.
+type NotificationKind string
+
+// NotificationReviewReply tells a review's author that someone replied.
+const NotificationReviewReply NotificationKind = "review_reply"
+
+type Notification struct {
+	ID             int
+	Kind           NotificationKind
+	ActorName      string
+	RestaurantID   int
+	RestaurantName string
+	ReviewID       int
+	// Excerpt is the text of the reply the notification is about.
+	Excerpt   string
+	CreatedAt time.Time
+	Read      bool
+}
+
+// NotificationService reads the notifications of users. Notifications are
+// written by the services whose changes cause them, in the same transaction.
+type NotificationService struct {
+	db          *sql.DB
+	workspaceID int
+}
+
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *NotificationService) InWorkspace(workspaceID int) *NotificationService {
+	return &NotificationService{db: s.db, workspaceID: workspaceID}
+}
+
+// notificationJoins joins notifications n to the review v, its restaurant r
+// and the reply p they are about.
+const notificationJoins = `
+        notifications n
+        INNER JOIN reviews v ON v.id = n.review_id
+        INNER JOIN restaurants r ON r.id = v.restaurant_id
+        INNER JOIN review_replies p ON p.id = n.reply_id
+`
+
+// ListNotifications returns up to limit of the user's notifications, latest
+// first.
+func (s *NotificationService) ListNotifications(userID, limit int) ([]Notification, error) {
+	rows, err := s.db.Query(`
+        SELECT n.id, n.kind, a.username, r.id, r.name, v.id, p.body, n.created_at, n.read_at IS NOT NULL
+        FROM `+notificationJoins+`
+        INNER JOIN users a ON a.id = n.actor_id
+        WHERE n.user_id = ? AND n.workspace_id = ?
+        ORDER BY n.created_at DESC, n.id DESC
+        LIMIT ?
+    `, userID, s.workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list notifications: %w", err)
+	}
+	defer rows.Close()
+	var notifications []Notification
+	for rows.Next() {
+		var notification Notification
+		var kind, createdAt string
+		if err := rows.Scan(&notification.ID, &kind, &notification.ActorName, &notification.RestaurantID, &notification.RestaurantName,
+			&notification.ReviewID, &notification.Excerpt, &createdAt, &notification.Read); err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		notification.Kind = NotificationKind(kind)
+		notification.CreatedAt = parseTimestamp(createdAt)
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows notification: %w", err)
+	}
+	return notifications, nil
+}
+
+// UnreadCount counts the user's unread notifications. Every page shows it, so
+// it reads only the notifications index.
+func (s *NotificationService) UnreadCount(userID int) (int, error) {
+	if userID == 0 {
+		return 0, nil
+	}
+	var count int
+	if err := s.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM notifications
+        WHERE user_id = ? AND workspace_id = ? AND read_at IS NULL
+    `, userID, s.workspaceID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkAllRead marks all of the user's notifications in the workspace read.
+func (s *NotificationService) MarkAllRead(userID int) error {
+	if _, err := s.db.Exec(`
+        UPDATE notifications
+        SET read_at = CURRENT_TIMESTAMP
+        WHERE user_id = ? AND workspace_id = ? AND read_at IS NULL
+    `, userID, s.workspaceID); err != nil {
+		return fmt.Errorf("mark notifications read: %w", err)
+	}
+	return nil
+}
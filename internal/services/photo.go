@@ -0,0 +1,257 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPhotoOrder is returned when a reorder request does not list
+// exactly the photos currently attached to the owner.
+var ErrInvalidPhotoOrder = errors.New("invalid photo order")
+
+type Photo struct {
+	ID        int
+	Path      string
+	Caption   string
+	SortOrder int
+}
+
+// PhotoArrangement is how the owner's photos should be laid out: every photo
+// id in display order, a caption per id to change and an optional cover photo
+// id that goes first.
+type PhotoArrangement struct {
+	Order    []int
+	Captions map[int]string
+	CoverID  int
+}
+
+// photoTable describes one of the photo tables (restaurant_photos / review_photos)
+// together with the parent row whose photo_path mirrors the first photo.
+// uploaderColumn is empty when the uploader is implied by the parent row.
+// ownersInWorkspace selects the owner IDs that belong to a workspace, and
+// ownerRestaurant the restaurant whose stats count an owner's photos.
+type photoTable struct {
+	table             string
+	ownerColumn       string
+	parentTable       string
+	uploaderColumn    string
+	ownersInWorkspace string
+	ownerRestaurant   string
+}
+
+var (
+	restaurantPhotoTable = photoTable{
+		table:             "restaurant_photos",
+		ownerColumn:       "restaurant_id",
+		parentTable:       "restaurants",
+		uploaderColumn:    "uploaded_by",
+		ownersInWorkspace: "SELECT id FROM restaurants WHERE workspace_id = ?",
+		ownerRestaurant:   "SELECT id FROM restaurants WHERE id = ?",
+	}
+	reviewPhotoTable = photoTable{
+		table:             "review_photos",
+		ownerColumn:       "review_id",
+		parentTable:       "reviews",
+		ownersInWorkspace: "SELECT v.id FROM reviews v INNER JOIN restaurants r ON r.id = v.restaurant_id WHERE r.workspace_id = ?",
+		ownerRestaurant:   "SELECT restaurant_id FROM reviews WHERE id = ?",
+	}
+)
+
+func listPhotos(q queryer, t photoTable, workspaceID, ownerID int) ([]Photo, error) {
+	rows, err := q.Query(fmt.Sprintf(`
+		SELECT id, path, caption, sort_order
+		FROM %s
+		WHERE %s = ? AND %s IN (%s)
+		ORDER BY sort_order ASC, id ASC
+	`, t.table, t.ownerColumn, t.ownerColumn, t.ownersInWorkspace), ownerID, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", t.table, err)
+	}
+	defer rows.Close()
+
+	photos := make([]Photo, 0)
+	for rows.Next() {
+		var photo Photo
+		if err := rows.Scan(&photo.ID, &photo.Path, &photo.Caption, &photo.SortOrder); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", t.table, err)
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows %s: %w", t.table, err)
+	}
+	return photos, nil
+}
+
+// syncPhotos makes the photo rows of ownerID match photoPaths in order.
+// Rows whose path is kept retain their id, caption and uploader; new rows are
+// attributed to uploadedBy when the table records uploaders.
+func syncPhotos(tx *sql.Tx, t photoTable, workspaceID, ownerID, uploadedBy int, photoPaths []string) error {
+	if err := ensurePhotoOwner(tx, t, workspaceID, ownerID); err != nil {
+		return err
+	}
+	existing, err := listPhotos(tx, t, workspaceID, ownerID)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(photoPaths))
+	for _, path := range photoPaths {
+		keep[path] = true
+	}
+	byPath := make(map[string]int, len(existing))
+	for _, photo := range existing {
+		if !keep[photo.Path] {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", t.table), photo.ID); err != nil {
+				return fmt.Errorf("delete %s: %w", t.table, err)
+			}
+			continue
+		}
+		byPath[photo.Path] = photo.ID
+	}
+
+	for i, path := range photoPaths {
+		if id, ok := byPath[path]; ok {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET sort_order = ? WHERE id = ?", t.table), i, id); err != nil {
+				return fmt.Errorf("order %s: %w", t.table, err)
+			}
+			continue
+		}
+		if t.uploaderColumn != "" && uploadedBy != 0 {
+			if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s, path, sort_order, %s) VALUES (?, ?, ?, ?)", t.table, t.ownerColumn, t.uploaderColumn), ownerID, path, i, uploadedBy); err != nil {
+				return fmt.Errorf("insert %s: %w", t.table, err)
+			}
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s, path, sort_order) VALUES (?, ?, ?)", t.table, t.ownerColumn), ownerID, path, i); err != nil {
+			return fmt.Errorf("insert %s: %w", t.table, err)
+		}
+	}
+	return syncPrimaryPhoto(tx, t, ownerID)
+}
+
+// reorderPhotos rewrites sort_order so that photoIDs appear in the given order.
+func reorderPhotos(tx *sql.Tx, t photoTable, workspaceID, ownerID int, photoIDs []int) error {
+	if err := ensurePhotoOwner(tx, t, workspaceID, ownerID); err != nil {
+		return err
+	}
+	existing, err := listPhotos(tx, t, workspaceID, ownerID)
+	if err != nil {
+		return err
+	}
+	if len(existing) != len(photoIDs) {
+		return ErrInvalidPhotoOrder
+	}
+	known := make(map[int]bool, len(existing))
+	for _, photo := range existing {
+		known[photo.ID] = true
+	}
+	for i, id := range photoIDs {
+		if !known[id] {
+			return ErrInvalidPhotoOrder
+		}
+		delete(known, id)
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET sort_order = ? WHERE id = ?", t.table), i, id); err != nil {
+			return fmt.Errorf("order %s: %w", t.table, err)
+		}
+	}
+	return syncPrimaryPhoto(tx, t, ownerID)
+}
+
+// arrangePhotos applies the arrangement inside tx, so a failure leaves the
+// photos as they were.
+func arrangePhotos(tx *sql.Tx, t photoTable, workspaceID, ownerID int, arrangement PhotoArrangement) error {
+	order := arrangement.Order
+	if arrangement.CoverID != 0 {
+		order = make([]int, 0, len(arrangement.Order))
+		order = append(order, arrangement.CoverID)
+		found := false
+		for _, id := range arrangement.Order {
+			if id == arrangement.CoverID {
+				found = true
+				continue
+			}
+			order = append(order, id)
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+	}
+	if err := reorderPhotos(tx, t, workspaceID, ownerID, order); err != nil {
+		return err
+	}
+	for photoID, caption := range arrangement.Captions {
+		if err := updatePhotoCaption(tx, t, workspaceID, ownerID, photoID, caption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updatePhotoCaption(q execer, t photoTable, workspaceID, ownerID, photoID int, caption string) error {
+	result, err := q.Exec(fmt.Sprintf("UPDATE %s SET caption = ? WHERE id = ? AND %s = ? AND %s IN (%s)", t.table, t.ownerColumn, t.ownerColumn, t.ownersInWorkspace), caption, photoID, ownerID, workspaceID)
+	if err != nil {
+		return fmt.Errorf("update %s caption: %w", t.table, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ensurePhotoOwner returns sql.ErrNoRows unless the owner row belongs to the workspace.
+func ensurePhotoOwner(q rowQueryer, t photoTable, workspaceID, ownerID int) error {
+	var exists int
+	if err := q.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM (%s) WHERE id = ?", t.ownersInWorkspace), workspaceID, ownerID).Scan(&exists); err != nil {
+		return fmt.Errorf("check %s workspace: %w", t.parentTable, err)
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// syncPrimaryPhoto keeps the legacy photo_path column pointing at the first photo,
+// and the owning restaurant's stats counting the photos.
+func syncPrimaryPhoto(tx *sql.Tx, t photoTable, ownerID int) error {
+	var firstPath sql.NullString
+	err := tx.QueryRow(fmt.Sprintf(`
+		SELECT path FROM %s WHERE %s = ? ORDER BY sort_order ASC, id ASC LIMIT 1
+	`, t.table, t.ownerColumn), ownerID).Scan(&firstPath)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("first %s: %w", t.table, err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET photo_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", t.parentTable), firstPath.String, ownerID); err != nil {
+		return fmt.Errorf("sync %s photo_path: %w", t.parentTable, err)
+	}
+	var restaurantID int
+	if err := tx.QueryRow(t.ownerRestaurant, ownerID).Scan(&restaurantID); err != nil {
+		return fmt.Errorf("%s restaurant: %w", t.parentTable, err)
+	}
+	return refreshRestaurantStats(tx, restaurantID)
+}
+
+// PhotoPaths returns the paths of the photos in order.
+func PhotoPaths(photos []Photo) []string {
+	paths := make([]string, 0, len(photos))
+	for _, photo := range photos {
+		paths = append(paths, photo.Path)
+	}
+	return paths
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
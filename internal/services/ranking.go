@@ -0,0 +1,131 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RankingConfig decides how restaurants are ranked by their reviews. The
+// ranking score is a Bayesian average: every restaurant starts with
+// PriorWeight imaginary reviews of PriorRating, so one 5-star review does not
+// outrank forty reviews averaging 4.6.
+type RankingConfig struct {
+	PriorRating float64
+	PriorWeight float64
+	// HalfLife halves the weight of a review each time it gets that much
+	// older, so recent reviews count more; 0 weighs all reviews alike. Ages
+	// are taken when a restaurant's ranking is refreshed, so the caller
+	// should run RefreshRankings periodically when it is set.
+	HalfLife time.Duration
+}
+
+var DefaultRankingConfig = RankingConfig{
+	PriorRating: 3,
+	PriorWeight: 5,
+}
+
+// score returns the Bayesian average of the ratings, given when each was
+// written.
+func (c RankingConfig) score(ratings []int, writtenAt []time.Time, now time.Time) float64 {
+	total := c.PriorRating * c.PriorWeight
+	weights := c.PriorWeight
+	for i, rating := range ratings {
+		weight := 1.0
+		if c.HalfLife > 0 && !writtenAt[i].IsZero() {
+			age := math.Max(now.Sub(writtenAt[i]).Hours(), 0)
+			weight = math.Pow(0.5, age/c.HalfLife.Hours())
+		}
+		total += float64(rating) * weight
+		weights += weight
+	}
+	if weights <= 0 {
+		return c.PriorRating
+	}
+	return total / weights
+}
+
+// rankingQueryer is what refreshRanking needs from a DB or transaction.
+type rankingQueryer interface {
+	queryer
+	execer
+}
+
+// refreshRanking recomputes the ranking score in the restaurant's
+// restaurant_stats row, which refreshRestaurantStats must have written. A
+// restaurant without reviews has no score.
+func refreshRanking(q rankingQueryer, config RankingConfig, restaurantID int, now time.Time) error {
+	rows, err := q.Query("SELECT rating, created_at FROM reviews WHERE restaurant_id = ?", restaurantID)
+	if err != nil {
+		return fmt.Errorf("list ranking reviews: %w", err)
+	}
+	var ratings []int
+	var writtenAt []time.Time
+	for rows.Next() {
+		var rating int
+		var createdAt sql.NullString
+		if err := rows.Scan(&rating, &createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan ranking review: %w", err)
+		}
+		ratings = append(ratings, rating)
+		writtenAt = append(writtenAt, parseTimestamp(createdAt.String))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows ranking review: %w", err)
+	}
+
+	var score interface{}
+	if len(ratings) > 0 {
+		score = config.score(ratings, writtenAt, now)
+	}
+	if _, err := q.Exec(`
+        UPDATE restaurant_stats SET score = ?, updated_at = CURRENT_TIMESTAMP WHERE restaurant_id = ?
+    `, score, restaurantID); err != nil {
+		return fmt.Errorf("save ranking: %w", err)
+	}
+	return nil
+}
+
+// RefreshRankings recomputes the ranking score of every restaurant in every
+// workspace, after RestaurantService.RefreshStats has filled in their stats.
+// It applies a changed RankingConfig and brings the recency weights up to
+// date.
+func (s *ReviewService) RefreshRankings() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT restaurant_id FROM restaurant_stats")
+	if err != nil {
+		return fmt.Errorf("list ranked restaurants: %w", err)
+	}
+	var restaurantIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan ranked restaurant: %w", err)
+		}
+		restaurantIDs = append(restaurantIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows ranked restaurant: %w", err)
+	}
+
+	now := s.now()
+	for _, id := range restaurantIDs {
+		if err := refreshRanking(tx, s.ranking, id, now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
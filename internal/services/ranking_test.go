@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRefreshRankingsDecaysWithTime(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	restaurant := insertRestaurant(t, database, 1, alice, "Ramen")
+	review := insertReview(t, database, restaurant, alice, 5)
+	written := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := database.Exec("UPDATE reviews SET created_at = ? WHERE id = ?", written.Format("2006-01-02 15:04:05"), review); err != nil {
+		t.Fatal(err)
+	}
+
+	restaurants := NewRestaurantService(database)
+	if err := restaurants.RefreshStats(); err != nil {
+		t.Fatalf("RefreshStats: %v", err)
+	}
+	config := RankingConfig{PriorRating: 3, PriorWeight: 1, HalfLife: 24 * time.Hour}
+	service := NewReviewService(database, config)
+	scoreAt := func(now time.Time) float64 {
+		t.Helper()
+		service.now = func() time.Time { return now }
+		if err := service.RefreshRankings(); err != nil {
+			t.Fatalf("RefreshRankings: %v", err)
+		}
+		stats, err := restaurants.InWorkspace(1).StatsForRestaurants([]Restaurant{{ID: restaurant}})
+		if err != nil {
+			t.Fatalf("StatsForRestaurants: %v", err)
+		}
+		return stats[restaurant].Score
+	}
+
+	// Fresh, the review weighs as much as the prior: (3 + 5) / 2.
+	if got := scoreAt(written); math.Abs(got-4) > 1e-9 {
+		t.Errorf("fresh score = %v, want 4", got)
+	}
+	// A day later it weighs half: (3 + 2.5) / 1.5.
+	if got, want := scoreAt(written.Add(24*time.Hour)), 5.5/1.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("day-old score = %v, want %v", got, want)
+	}
+}
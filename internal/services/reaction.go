@@ -0,0 +1,147 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ReactionKind is a reaction a user can leave on a review: the "helpful"
+// vote or one of a fixed set of emoji.
+type ReactionKind string
+
+const (
+	ReactionHelpful ReactionKind = "helpful"
+	ReactionLike    ReactionKind = "like"
+	ReactionLove    ReactionKind = "love"
+	ReactionYum     ReactionKind = "yum"
+	ReactionLaugh   ReactionKind = "laugh"
+	ReactionWow     ReactionKind = "wow"
+)
+
+// EmojiReactions lists the emoji reactions in display order.
+var EmojiReactions = []ReactionKind{ReactionLike, ReactionLove, ReactionYum, ReactionLaugh, ReactionWow}
+
+// ErrOwnReviewVote is returned when a user votes their own review helpful.
+var ErrOwnReviewVote = errors.New("cannot vote own review helpful")
+
+// ParseReactionKind returns the kind named by value, or false if there is
+// none.
+func ParseReactionKind(value string) (ReactionKind, bool) {
+	kind := ReactionKind(value)
+	if kind == ReactionHelpful {
+		return kind, true
+	}
+	for _, emoji := range EmojiReactions {
+		if kind == emoji {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// ReviewReactions are the reactions on a review: how many users left each
+// kind, and which kinds the viewer left.
+type ReviewReactions struct {
+	Counts map[ReactionKind]int
+	Mine   map[ReactionKind]bool
+}
+
+// ReviewOrder is how ListReviews orders a restaurant's reviews.
+type ReviewOrder string
+
+const (
+	ReviewOrderNewest ReviewOrder = "newest"
+	// ReviewOrderHelpful puts the reviews with the most helpful votes first,
+	// newest first among ties.
+	ReviewOrderHelpful ReviewOrder = "helpful"
+)
+
+// ParseReviewOrder returns the order named by value, newest by default.
+func ParseReviewOrder(value string) ReviewOrder {
+	if ReviewOrder(value) == ReviewOrderHelpful {
+		return ReviewOrderHelpful
+	}
+	return ReviewOrderNewest
+}
+
+// orderBy is the ORDER BY clause of the order for reviews aliased v.
+func (o ReviewOrder) orderBy() string {
+	if o == ReviewOrderHelpful {
+		return "(SELECT COUNT(*) FROM review_reactions x WHERE x.review_id = v.id AND x.kind = 'helpful') DESC, v.created_at DESC, v.id DESC"
+	}
+	return "v.created_at DESC"
+}
+
+// SetReaction leaves the user's reaction of the kind on the review, or takes
+// it back when on is false. Either is a no-op if already so. Reviews outside
+// the workspace give sql.ErrNoRows, and a helpful vote on the user's own
+// review ErrOwnReviewVote.
+func (s *ReviewService) SetReaction(reviewID, userID int, kind ReactionKind, on bool) error {
+	var authorID int
+	err := s.db.QueryRow("SELECT user_id FROM reviews WHERE id = ? AND id IN ("+reviewsInWorkspace+")", reviewID, s.workspaceID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("get review author: %w", err)
+	}
+	if on && kind == ReactionHelpful && authorID == userID {
+		return ErrOwnReviewVote
+	}
+	if on {
+		if _, err := s.db.Exec("INSERT OR IGNORE INTO review_reactions (review_id, user_id, kind) VALUES (?, ?, ?)", reviewID, userID, string(kind)); err != nil {
+			return fmt.Errorf("add reaction: %w", err)
+		}
+		return nil
+	}
+	if _, err := s.db.Exec("DELETE FROM review_reactions WHERE review_id = ? AND user_id = ? AND kind = ?", reviewID, userID, string(kind)); err != nil {
+		return fmt.Errorf("remove reaction: %w", err)
+	}
+	return nil
+}
+
+// loadReactions fills in the reactions of the reviews with one query. Mine is
+// set for viewerID; 0 is an anonymous viewer who reacted to nothing.
+func (s *ReviewService) loadReactions(reviews []Review, viewerID int) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(reviews))
+	placeholders := make([]string, 0, len(reviews))
+	args := make([]interface{}, 0, len(reviews)+1)
+	args = append(args, viewerID)
+	for i := range reviews {
+		reviews[i].Reactions = ReviewReactions{Counts: make(map[ReactionKind]int), Mine: make(map[ReactionKind]bool)}
+		index[reviews[i].ID] = i
+		placeholders = append(placeholders, "?")
+		args = append(args, reviews[i].ID)
+	}
+	rows, err := s.db.Query(`
+        SELECT review_id, kind, COUNT(*), MAX(user_id = ?)
+        FROM review_reactions
+        WHERE review_id IN (`+strings.Join(placeholders, ",")+`)
+        GROUP BY review_id, kind
+    `, args...)
+	if err != nil {
+		return fmt.Errorf("count reactions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reviewID, count int
+		var kind string
+		var mine bool
+		if err := rows.Scan(&reviewID, &kind, &count, &mine); err != nil {
+			return fmt.Errorf("scan reaction count: %w", err)
+		}
+		if i, ok := index[reviewID]; ok {
+			reviews[i].Reactions.Counts[ReactionKind(kind)] = count
+			reviews[i].Reactions.Mine[ReactionKind(kind)] = mine
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows reaction count: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reply is a comment in the thread under a review. Replies carry no rating.
+type Reply struct {
+	ID        int
+	ReviewID  int
+	UserID    int
+	Username  string
+	Body      string
+	CreatedAt time.Time
+	// Edited reports whether the author changed the reply after posting.
+	Edited bool
+}
+
+// CreateReply adds the reply to its review's thread and, unless the author
+// replied to their own review, notifies the review's author in the same
+// transaction.
+func (s *ReviewService) CreateReply(reply Reply) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	err = tx.QueryRow("SELECT user_id FROM reviews WHERE id = ? AND id IN ("+reviewsInWorkspace+")", reply.ReviewID, s.workspaceID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get review author: %w", err)
+	}
+	result, err := tx.Exec("INSERT INTO review_replies (review_id, user_id, body) VALUES (?, ?, ?)", reply.ReviewID, reply.UserID, reply.Body)
+	if err != nil {
+		return 0, fmt.Errorf("create reply: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("reply id: %w", err)
+	}
+	if authorID != reply.UserID {
+		if _, err := tx.Exec(`
+            INSERT INTO notifications (user_id, actor_id, kind, review_id, reply_id, workspace_id)
+            VALUES (?, ?, ?, ?, ?, ?)
+        `, authorID, reply.UserID, string(NotificationReviewReply), reply.ReviewID, id, s.workspaceID); err != nil {
+			return 0, fmt.Errorf("create notification: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetReply returns the reply, or nil if it is not in the workspace.
+func (s *ReviewService) GetReply(id int) (*Reply, error) {
+	var reply Reply
+	var createdAt string
+	err := s.db.QueryRow(`
+        SELECT p.id, p.review_id, p.user_id, u.username, p.body, p.created_at, p.updated_at IS NOT NULL
+        FROM review_replies p
+        INNER JOIN users u ON u.id = p.user_id
+        WHERE p.id = ? AND p.review_id IN (`+reviewsInWorkspace+`)
+    `, id, s.workspaceID).Scan(&reply.ID, &reply.ReviewID, &reply.UserID, &reply.Username, &reply.Body, &createdAt, &reply.Edited)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get reply: %w", err)
+	}
+	reply.CreatedAt = parseTimestamp(createdAt)
+	return &reply, nil
+}
+
+// UpdateReply replaces the reply's text. Callers check that the viewer wrote
+// it.
+func (s *ReviewService) UpdateReply(id int, body string) error {
+	result, err := s.db.Exec(`
+        UPDATE review_replies
+        SET body = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND review_id IN (`+reviewsInWorkspace+`)
+    `, body, id, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("update reply: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// DeleteReply deletes the reply; the notification about it goes with it by
+// cascade. Callers check that the viewer wrote it or moderates the workspace.
+func (s *ReviewService) DeleteReply(id int) error {
+	result, err := s.db.Exec("DELETE FROM review_replies WHERE id = ? AND review_id IN ("+reviewsInWorkspace+")", id, s.workspaceID)
+	if err != nil {
+		return fmt.Errorf("delete reply: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// RepliesForReviews loads the threads of all the reviews in one query, keyed
+// by review ID, oldest reply first.
+func (s *ReviewService) RepliesForReviews(reviews []Review) (map[int][]Reply, error) {
+	result := make(map[int][]Reply)
+	if len(reviews) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, 0, len(reviews))
+	args := make([]interface{}, 0, len(reviews)+1)
+	args = append(args, s.workspaceID)
+	for _, review := range reviews {
+		placeholders = append(placeholders, "?")
+		args = append(args, review.ID)
+	}
+	rows, err := s.db.Query(`
+        SELECT p.id, p.review_id, p.user_id, u.username, p.body, p.created_at, p.updated_at IS NOT NULL
+        FROM review_replies p
+        INNER JOIN users u ON u.id = p.user_id
+        WHERE p.review_id IN (`+reviewsInWorkspace+`) AND p.review_id IN (`+strings.Join(placeholders, ",")+`)
+        ORDER BY p.created_at ASC, p.id ASC
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list replies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reply Reply
+		var createdAt string
+		if err := rows.Scan(&reply.ID, &reply.ReviewID, &reply.UserID, &reply.Username, &reply.Body, &createdAt, &reply.Edited); err != nil {
+			return nil, fmt.Errorf("scan reply: %w", err)
+		}
+		reply.CreatedAt = parseTimestamp(createdAt)
+		result[reply.ReviewID] = append(result[reply.ReviewID], reply)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows reply: %w", err)
+	}
+	return result, nil
+}
+
+// loadReplyCounts fills in the reply counts of the workspace's reviews with
+// one query. Reviews of other workspaces count none.
+func (s *ReviewService) loadReplyCounts(reviews []Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(reviews))
+	placeholders := make([]string, 0, len(reviews))
+	args := make([]interface{}, 0, len(reviews)+1)
+	args = append(args, s.workspaceID)
+	for i := range reviews {
+		index[reviews[i].ID] = i
+		placeholders = append(placeholders, "?")
+		args = append(args, reviews[i].ID)
+	}
+	rows, err := s.db.Query(`
+        SELECT review_id, COUNT(*)
+        FROM review_replies
+        WHERE review_id IN (`+reviewsInWorkspace+`) AND review_id IN (`+strings.Join(placeholders, ",")+`)
+        GROUP BY review_id
+    `, args...)
+	if err != nil {
+		return fmt.Errorf("count replies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reviewID, count int
+		if err := rows.Scan(&reviewID, &count); err != nil {
+			return fmt.Errorf("scan reply count: %w", err)
+		}
+		if i, ok := index[reviewID]; ok {
+			reviews[i].ReplyCount = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows reply count: %w", err)
+	}
+	return nil
+}
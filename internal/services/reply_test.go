@@ -0,0 +1,78 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateReplyNotifiesReviewAuthorOnly(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	bob := insertUser(t, database, "bob")
+	restaurant := insertRestaurant(t, database, 1, alice, "Ramen")
+	review := insertReview(t, database, restaurant, alice, 4)
+	reviews := NewReviewService(database, DefaultRankingConfig).InWorkspace(1)
+	notifications := NewNotificationService(database).InWorkspace(1)
+
+	if _, err := reviews.CreateReply(Reply{ReviewID: review, UserID: alice, Body: "thanks"}); err != nil {
+		t.Fatalf("CreateReply by author: %v", err)
+	}
+	if count, err := notifications.UnreadCount(alice); err != nil || count != 0 {
+		t.Fatalf("after own reply UnreadCount = %d, %v; want 0", count, err)
+	}
+
+	reply, err := reviews.CreateReply(Reply{ReviewID: review, UserID: bob, Body: "spicy?"})
+	if err != nil {
+		t.Fatalf("CreateReply by bob: %v", err)
+	}
+	if count, err := notifications.UnreadCount(alice); err != nil || count != 1 {
+		t.Fatalf("after bob's reply UnreadCount = %d, %v; want 1", count, err)
+	}
+	if count, err := notifications.UnreadCount(bob); err != nil || count != 0 {
+		t.Errorf("bob's UnreadCount = %d, %v; want 0", count, err)
+	}
+	other := insertWorkspace(t, database, "other")
+	if count, err := notifications.InWorkspace(other).UnreadCount(alice); err != nil || count != 0 {
+		t.Errorf("other workspace UnreadCount = %d, %v; want 0", count, err)
+	}
+
+	// Deleting the reply takes its notification with it.
+	if err := reviews.DeleteReply(reply); err != nil {
+		t.Fatalf("DeleteReply: %v", err)
+	}
+	if count, err := notifications.UnreadCount(alice); err != nil || count != 0 {
+		t.Errorf("after delete UnreadCount = %d, %v; want 0", count, err)
+	}
+}
+
+func TestRepliesStayInTheirWorkspace(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	bob := insertUser(t, database, "bob")
+	other := insertWorkspace(t, database, "other")
+	public := insertReview(t, database, insertRestaurant(t, database, 1, alice, "Ramen"), alice, 4)
+	private := insertReview(t, database, insertRestaurant(t, database, other, alice, "Sushi"), alice, 5)
+	reviews := NewReviewService(database, DefaultRankingConfig)
+	if _, err := reviews.InWorkspace(1).CreateReply(Reply{ReviewID: public, UserID: bob, Body: "public"}); err != nil {
+		t.Fatalf("CreateReply: %v", err)
+	}
+	if _, err := reviews.InWorkspace(other).CreateReply(Reply{ReviewID: private, UserID: bob, Body: "private"}); err != nil {
+		t.Fatalf("CreateReply: %v", err)
+	}
+
+	both := []Review{{ID: public}, {ID: private}}
+	replies, err := reviews.InWorkspace(1).RepliesForReviews(both)
+	if err != nil {
+		t.Fatalf("RepliesForReviews: %v", err)
+	}
+	if len(replies[public]) != 1 || replies[public][0].Body != "public" || len(replies[private]) != 0 {
+		t.Errorf("public workspace replies = %+v, want only the public reply", replies)
+	}
+
+	if err := reviews.InWorkspace(1).loadReplyCounts(both); err != nil {
+		t.Fatalf("loadReplyCounts: %v", err)
+	}
+	if got := []int{both[0].ReplyCount, both[1].ReplyCount}; !reflect.DeepEqual(got, []int{1, 0}) {
+		t.Errorf("public workspace reply counts = %v, want [1 0]", got)
+	}
+}
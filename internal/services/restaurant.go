@@ -18,10 +18,19 @@ type Restaurant struct {
 	MapsURL     string
 	CreatedBy   int
 	CreatedAt   string
+	// Budget is the typical spend per person in yen, 0 when unknown.
+	Budget int
+	// OpeningHours is in the format read by util.ParseOpeningHours, empty
+	// when unknown.
+	OpeningHours string
 }
 
+// RestaurantService reads and writes the restaurants of one workspace, along
+// with their photos and tags. Like BaseService it sees nothing until scoped
+// with InWorkspace.
 type RestaurantService struct {
-	db *sql.DB
+	db          *sql.DB
+	workspaceID int
 }
 
 type Tag struct {
@@ -33,12 +42,18 @@ func NewRestaurantService(db *sql.DB) *RestaurantService {
 	return &RestaurantService{db: db}
 }
 
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *RestaurantService) InWorkspace(workspaceID int) *RestaurantService {
+	return &RestaurantService{db: s.db, workspaceID: workspaceID}
+}
+
 func (s *RestaurantService) ListRestaurants() ([]Restaurant, error) {
 	rows, err := s.db.Query(`
-	SELECT id, name, description, COALESCE(photo_path, ''), latitude, longitude, address, maps_url, created_by, created_at
+	SELECT id, name, description, COALESCE(photo_path, ''), latitude, longitude, address, maps_url, created_by, created_at, COALESCE(budget, 0), COALESCE(opening_hours, '')
         FROM restaurants
+        WHERE workspace_id = ?
         ORDER BY created_at DESC
-    `)
+    `, s.workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("list restaurants: %w", err)
 	}
@@ -58,6 +73,8 @@ func (s *RestaurantService) ListRestaurants() ([]Restaurant, error) {
 			&restaurant.MapsURL,
 			&restaurant.CreatedBy,
 			&restaurant.CreatedAt,
+			&restaurant.Budget,
+			&restaurant.OpeningHours,
 		); err != nil {
 			return nil, fmt.Errorf("scan restaurant: %w", err)
 		}
@@ -72,10 +89,10 @@ func (s *RestaurantService) ListRestaurants() ([]Restaurant, error) {
 func (s *RestaurantService) GetRestaurant(id int) (*Restaurant, error) {
 	var restaurant Restaurant
 	err := s.db.QueryRow(`
-	SELECT id, name, description, COALESCE(photo_path, ''), latitude, longitude, address, maps_url, created_by, created_at
+	SELECT id, name, description, COALESCE(photo_path, ''), latitude, longitude, address, maps_url, created_by, created_at, COALESCE(budget, 0), COALESCE(opening_hours, '')
         FROM restaurants
-        WHERE id = ?
-    `, id).Scan(
+        WHERE id = ? AND workspace_id = ?
+    `, id, s.workspaceID).Scan(
 		&restaurant.ID,
 		&restaurant.Name,
 		&restaurant.Description,
@@ -86,6 +103,8 @@ func (s *RestaurantService) GetRestaurant(id int) (*Restaurant, error) {
 		&restaurant.MapsURL,
 		&restaurant.CreatedBy,
 		&restaurant.CreatedAt,
+		&restaurant.Budget,
+		&restaurant.OpeningHours,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -98,9 +117,9 @@ func (s *RestaurantService) GetRestaurant(id int) (*Restaurant, error) {
 
 func (s *RestaurantService) CreateRestaurant(input Restaurant) (int, error) {
 	result, err := s.db.Exec(`
-		INSERT INTO restaurants (name, description, photo_path, latitude, longitude, address, maps_url, created_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, input.Name, input.Description, input.PhotoPath, input.Latitude, input.Longitude, input.Address, input.MapsURL, input.CreatedBy)
+		INSERT INTO restaurants (name, description, photo_path, latitude, longitude, address, maps_url, created_by, budget, opening_hours, workspace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), ?)
+	`, input.Name, input.Description, input.PhotoPath, input.Latitude, input.Longitude, input.Address, input.MapsURL, input.CreatedBy, input.Budget, input.OpeningHours, s.workspaceID)
 	if err != nil {
 		return 0, fmt.Errorf("create restaurant: %w", err)
 	}
@@ -114,9 +133,9 @@ func (s *RestaurantService) CreateRestaurant(input Restaurant) (int, error) {
 func (s *RestaurantService) UpdateRestaurant(input Restaurant) error {
 	result, err := s.db.Exec(`
         UPDATE restaurants
-		SET name = ?, description = ?, photo_path = ?, latitude = ?, longitude = ?, address = ?, maps_url = ?, updated_at = CURRENT_TIMESTAMP
-        WHERE id = ?
-	`, input.Name, input.Description, input.PhotoPath, input.Latitude, input.Longitude, input.Address, input.MapsURL, input.ID)
+		SET name = ?, description = ?, photo_path = ?, latitude = ?, longitude = ?, address = ?, maps_url = ?, budget = NULLIF(?, 0), opening_hours = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND workspace_id = ?
+	`, input.Name, input.Description, input.PhotoPath, input.Latitude, input.Longitude, input.Address, input.MapsURL, input.Budget, input.OpeningHours, input.ID, s.workspaceID)
 	if err != nil {
 		return fmt.Errorf("update restaurant: %w", err)
 	}
@@ -133,8 +152,8 @@ func (s *RestaurantService) UpdateRestaurant(input Restaurant) error {
 func (s *RestaurantService) DeleteRestaurant(id int, createdBy int) error {
 	result, err := s.db.Exec(`
 		DELETE FROM restaurants
-		WHERE id = ? AND created_by = ?
-	`, id, createdBy)
+		WHERE id = ? AND created_by = ? AND workspace_id = ?
+	`, id, createdBy, s.workspaceID)
 	if err != nil {
 		return fmt.Errorf("delete restaurant: %w", err)
 	}
@@ -149,62 +168,49 @@ func (s *RestaurantService) DeleteRestaurant(id int, createdBy int) error {
 }
 
 func (s *RestaurantService) ListRestaurantPhotos(restaurantID int) ([]string, error) {
-	rows, err := s.db.Query(`
-		SELECT path
-		FROM restaurant_photos
-		WHERE restaurant_id = ?
-		ORDER BY sort_order ASC, id ASC
-	`, restaurantID)
+	photos, err := listPhotos(s.db, restaurantPhotoTable, s.workspaceID, restaurantID)
 	if err != nil {
-		return nil, fmt.Errorf("list restaurant photos: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return PhotoPaths(photos), nil
+}
 
-	paths := make([]string, 0)
-	for rows.Next() {
-		var path string
-		if err := rows.Scan(&path); err != nil {
-			return nil, fmt.Errorf("scan restaurant photo: %w", err)
-		}
-		paths = append(paths, path)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows restaurant photo: %w", err)
-	}
-	return paths, nil
+func (s *RestaurantService) ListRestaurantPhotoDetails(restaurantID int) ([]Photo, error) {
+	return listPhotos(s.db, restaurantPhotoTable, s.workspaceID, restaurantID)
 }
 
-func (s *RestaurantService) ReplaceRestaurantPhotos(restaurantID int, photoPaths []string) error {
+// ReplaceRestaurantPhotos sets the restaurant's photos to photoPaths in order.
+// Newly added photos are attributed to uploadedBy.
+func (s *RestaurantService) ReplaceRestaurantPhotos(restaurantID, uploadedBy int, photoPaths []string) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM restaurant_photos WHERE restaurant_id = ?", restaurantID); err != nil {
-		return fmt.Errorf("clear restaurant photos: %w", err)
+	if err := syncPhotos(tx, restaurantPhotoTable, s.workspaceID, restaurantID, uploadedBy, photoPaths); err != nil {
+		return err
 	}
 
-	if len(photoPaths) > 0 {
-		stmt, err := tx.Prepare("INSERT INTO restaurant_photos (restaurant_id, path, sort_order) VALUES (?, ?, ?)")
-		if err != nil {
-			return fmt.Errorf("prepare restaurant photos: %w", err)
-		}
-		defer stmt.Close()
-
-		for i, path := range photoPaths {
-			if _, err := stmt.Exec(restaurantID, path, i); err != nil {
-				return fmt.Errorf("insert restaurant photo: %w", err)
-			}
-		}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
 	}
+	return nil
+}
 
-	firstPath := ""
-	if len(photoPaths) > 0 {
-		firstPath = photoPaths[0]
+// ArrangeRestaurantPhotos saves the order, captions and cover photo of a
+// restaurant's photos in one transaction. arrangement.Order must list every
+// photo of the restaurant exactly once; the cover photo moves to the front and
+// the rest keep their relative order.
+func (s *RestaurantService) ArrangeRestaurantPhotos(restaurantID int, arrangement PhotoArrangement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	if _, err := tx.Exec("UPDATE restaurants SET photo_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", firstPath, restaurantID); err != nil {
-		return fmt.Errorf("sync restaurant photo_path: %w", err)
+	defer tx.Rollback()
+
+	if err := arrangePhotos(tx, restaurantPhotoTable, s.workspaceID, restaurantID, arrangement); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -213,6 +219,9 @@ func (s *RestaurantService) ReplaceRestaurantPhotos(restaurantID int, photoPaths
 	return nil
 }
 
+// UpsertTag returns the tag with the name, creating it if needed. Tag names
+// are a vocabulary shared by all workspaces; which tags a workspace sees is
+// decided by its restaurants (see ListTags).
 func (s *RestaurantService) UpsertTag(name string) (Tag, error) {
 	var tag Tag
 	err := s.db.QueryRow("SELECT id, name FROM tags WHERE name = ?", name).Scan(&tag.ID, &tag.Name)
@@ -237,6 +246,9 @@ func (s *RestaurantService) AttachTags(restaurantID int, tagIDs []int) error {
 	if len(tagIDs) == 0 {
 		return nil
 	}
+	if err := ensureRestaurantInWorkspace(s.db, s.workspaceID, restaurantID); err != nil {
+		return err
+	}
 	stmt, err := s.db.Prepare("INSERT OR IGNORE INTO restaurant_tags (restaurant_id, tag_id) VALUES (?, ?)")
 	if err != nil {
 		return fmt.Errorf("prepare tags: %w", err)
@@ -257,6 +269,9 @@ func (s *RestaurantService) ReplaceTags(restaurantID int, tagIDs []int) error {
 	}
 	defer tx.Rollback()
 
+	if err := ensureRestaurantInWorkspace(tx, s.workspaceID, restaurantID); err != nil {
+		return err
+	}
 	if _, err := tx.Exec("DELETE FROM restaurant_tags WHERE restaurant_id = ?", restaurantID); err != nil {
 		return fmt.Errorf("clear tags: %w", err)
 	}
@@ -286,9 +301,10 @@ func (s *RestaurantService) TagsForRestaurant(restaurantID int) ([]Tag, error) {
         SELECT t.id, t.name
         FROM tags t
         INNER JOIN restaurant_tags rt ON rt.tag_id = t.id
-        WHERE rt.restaurant_id = ?
+        INNER JOIN restaurants r ON r.id = rt.restaurant_id
+        WHERE rt.restaurant_id = ? AND r.workspace_id = ?
         ORDER BY t.name ASC
-    `, restaurantID)
+    `, restaurantID, s.workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("list tags: %w", err)
 	}
@@ -318,12 +334,13 @@ func (s *RestaurantService) TagsForRestaurants(restaurants []Restaurant) (map[in
 		return result, nil
 	}
 	placeholders := make([]string, 0, len(ids))
-	args := make([]interface{}, 0, len(ids))
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, s.workspaceID)
 	for _, id := range ids {
 		placeholders = append(placeholders, "?")
 		args = append(args, id)
 	}
-	query := "SELECT rt.restaurant_id, t.name FROM restaurant_tags rt INNER JOIN tags t ON t.id = rt.tag_id WHERE rt.restaurant_id IN (" + strings.Join(placeholders, ",") + ") ORDER BY t.name ASC"
+	query := "SELECT rt.restaurant_id, t.name FROM restaurant_tags rt INNER JOIN tags t ON t.id = rt.tag_id INNER JOIN restaurants r ON r.id = rt.restaurant_id WHERE r.workspace_id = ? AND rt.restaurant_id IN (" + strings.Join(placeholders, ",") + ") ORDER BY t.name ASC"
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list tag map: %w", err)
@@ -343,8 +360,18 @@ func (s *RestaurantService) TagsForRestaurants(restaurants []Restaurant) (map[in
 	return result, nil
 }
 
+// ListTags returns the tags used by the workspace's restaurants.
 func (s *RestaurantService) ListTags() ([]Tag, error) {
-	rows, err := s.db.Query("SELECT id, name FROM tags ORDER BY name ASC")
+	rows, err := s.db.Query(`
+        SELECT t.id, t.name
+        FROM tags t
+        WHERE EXISTS (
+            SELECT 1 FROM restaurant_tags rt
+            INNER JOIN restaurants r ON r.id = rt.restaurant_id
+            WHERE rt.tag_id = t.id AND r.workspace_id = ?
+        )
+        ORDER BY t.name ASC
+    `, s.workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("list tags: %w", err)
 	}
@@ -366,13 +393,13 @@ func (s *RestaurantService) ListTags() ([]Tag, error) {
 
 func (s *RestaurantService) ListRestaurantsByTag(tagName string) ([]Restaurant, error) {
 	rows, err := s.db.Query(`
-	SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url, r.created_by, r.created_at
+	SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url, r.created_by, r.created_at, COALESCE(r.budget, 0), COALESCE(r.opening_hours, '')
         FROM restaurants r
         INNER JOIN restaurant_tags rt ON rt.restaurant_id = r.id
         INNER JOIN tags t ON t.id = rt.tag_id
-        WHERE t.name = ?
+        WHERE t.name = ? AND r.workspace_id = ?
         ORDER BY r.created_at DESC
-    `, tagName)
+    `, tagName, s.workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("list restaurants by tag: %w", err)
 	}
@@ -392,6 +419,8 @@ func (s *RestaurantService) ListRestaurantsByTag(tagName string) ([]Restaurant,
 			&restaurant.MapsURL,
 			&restaurant.CreatedBy,
 			&restaurant.CreatedAt,
+			&restaurant.Budget,
+			&restaurant.OpeningHours,
 		); err != nil {
 			return nil, fmt.Errorf("scan restaurant: %w", err)
 		}
@@ -402,3 +431,71 @@ func (s *RestaurantService) ListRestaurantsByTag(tagName string) ([]Restaurant,
 	}
 	return restaurants, nil
 }
+
+// Bounds is a latitude/longitude rectangle, e.g. the visible area of a map.
+type Bounds struct {
+	MinLat float64
+	MaxLat float64
+	MinLng float64
+	MaxLng float64
+}
+
+// ListRestaurantsInBounds returns the restaurants inside bounds. A non-empty
+// tagName limits them to that tag, like ListRestaurantsByTag.
+func (s *RestaurantService) ListRestaurantsInBounds(bounds Bounds, tagName string) ([]Restaurant, error) {
+	rows, err := s.db.Query(`
+	SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url, r.created_by, r.created_at, COALESCE(r.budget, 0), COALESCE(r.opening_hours, '')
+        FROM restaurants r
+        WHERE r.workspace_id = ?
+          AND r.latitude BETWEEN ? AND ? AND r.longitude BETWEEN ? AND ?
+          AND (? = '' OR EXISTS (
+            SELECT 1 FROM restaurant_tags rt
+            INNER JOIN tags t ON t.id = rt.tag_id
+            WHERE rt.restaurant_id = r.id AND t.name = ?
+          ))
+        ORDER BY r.created_at DESC
+    `, s.workspaceID, bounds.MinLat, bounds.MaxLat, bounds.MinLng, bounds.MaxLng, tagName, tagName)
+	if err != nil {
+		return nil, fmt.Errorf("list restaurants in bounds: %w", err)
+	}
+	defer rows.Close()
+
+	var restaurants []Restaurant
+	for rows.Next() {
+		var restaurant Restaurant
+		if err := rows.Scan(
+			&restaurant.ID,
+			&restaurant.Name,
+			&restaurant.Description,
+			&restaurant.PhotoPath,
+			&restaurant.Latitude,
+			&restaurant.Longitude,
+			&restaurant.Address,
+			&restaurant.MapsURL,
+			&restaurant.CreatedBy,
+			&restaurant.CreatedAt,
+			&restaurant.Budget,
+			&restaurant.OpeningHours,
+		); err != nil {
+			return nil, fmt.Errorf("scan restaurant: %w", err)
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows restaurant: %w", err)
+	}
+	return restaurants, nil
+}
+
+// ensureRestaurantInWorkspace returns sql.ErrNoRows unless the restaurant
+// belongs to the workspace.
+func ensureRestaurantInWorkspace(q rowQueryer, workspaceID, restaurantID int) error {
+	var exists int
+	if err := q.QueryRow("SELECT COUNT(*) FROM restaurants WHERE id = ? AND workspace_id = ?", restaurantID, workspaceID).Scan(&exists); err != nil {
+		return fmt.Errorf("check restaurant workspace: %w", err)
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -3,37 +3,167 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// RatingDimension is one aspect a review can score besides the overall
+// rating.
+type RatingDimension string
+
+const (
+	DimensionTaste      RatingDimension = "taste"
+	DimensionValue      RatingDimension = "value"
+	DimensionSpeed      RatingDimension = "speed"
+	DimensionAtmosphere RatingDimension = "atmosphere"
+	DimensionPortion    RatingDimension = "portion"
+)
+
+// RatingDimensions lists the dimensions in display order.
+var RatingDimensions = []RatingDimension{DimensionTaste, DimensionValue, DimensionSpeed, DimensionAtmosphere, DimensionPortion}
+
+// ParseRatingDimension returns the dimension named by value, or false if
+// there is none.
+func ParseRatingDimension(value string) (RatingDimension, bool) {
+	for _, dimension := range RatingDimensions {
+		if string(dimension) == value {
+			return dimension, true
+		}
+	}
+	return "", false
+}
+
+// column is the reviews column holding the dimension's scores.
+func (d RatingDimension) column() string {
+	return string(d) + "_rating"
+}
+
+// statsAverageColumn and statsCountColumn are the restaurant_stats columns
+// holding the dimension's average and how many reviews scored it.
+func (d RatingDimension) statsAverageColumn() string {
+	return string(d) + "_average"
+}
+
+func (d RatingDimension) statsCountColumn() string {
+	return string(d) + "_count"
+}
+
+// ReviewScores holds a review's optional sub-scores from 1 to 5. Dimensions
+// the reviewer skipped are absent.
+type ReviewScores map[RatingDimension]int
+
 type Review struct {
 	ID           int
 	RestaurantID int
 	UserID       int
 	Username     string
 	Rating       int
+	Scores       ReviewScores
 	Comment      string
 	PhotoPath    string
 	PhotoPaths   []string
 	CreatedAt    string
+	// Reactions and ReplyCount are only filled in by ListReviews.
+	Reactions  ReviewReactions
+	ReplyCount int
 }
 
+// ScoreAverage is the average of one rating over a restaurant's reviews that
+// gave it.
+type ScoreAverage struct {
+	Average float64
+	Count   int
+}
+
+// RatingSummary sums up a restaurant's reviews: the overall average, how many
+// reviews gave each star from 1 to 5 (Distribution[0] is 1 star), and the
+// average of each dimension.
+type RatingSummary struct {
+	Average      float64
+	Count        int
+	Distribution [5]int
+	Dimensions   map[RatingDimension]ScoreAverage
+}
+
+// ReviewService reads and writes reviews of the restaurants in one workspace.
+// Like BaseService it sees nothing until scoped with InWorkspace. Writing a
+// review refreshes its restaurant's ranking in the same transaction.
 type ReviewService struct {
-	db *sql.DB
+	db          *sql.DB
+	workspaceID int
+	ranking     RankingConfig
+	now         func() time.Time
+}
+
+func NewReviewService(db *sql.DB, ranking RankingConfig) *ReviewService {
+	return &ReviewService{db: db, ranking: ranking, now: time.Now}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *ReviewService) InWorkspace(workspaceID int) *ReviewService {
+	scoped := *s
+	scoped.workspaceID = workspaceID
+	return &scoped
+}
+
+// reviewsInWorkspace selects the IDs of the reviews in a workspace.
+const reviewsInWorkspace = "SELECT v.id FROM reviews v INNER JOIN restaurants r ON r.id = v.restaurant_id WHERE r.workspace_id = ?"
+
+// scoreColumns lists the dimension columns in RatingDimensions order, each
+// prefixed with prefix.
+func scoreColumns(prefix string) string {
+	columns := make([]string, 0, len(RatingDimensions))
+	for _, dimension := range RatingDimensions {
+		columns = append(columns, prefix+dimension.column())
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scoreTargets returns scan targets for scoreColumns; scores copies what was
+// scanned into a ReviewScores.
+func scoreTargets() ([]interface{}, func() ReviewScores) {
+	values := make([]sql.NullInt64, len(RatingDimensions))
+	targets := make([]interface{}, len(values))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	return targets, func() ReviewScores {
+		scores := make(ReviewScores)
+		for i, value := range values {
+			if value.Valid {
+				scores[RatingDimensions[i]] = int(value.Int64)
+			}
+		}
+		return scores
+	}
 }
 
-func NewReviewService(db *sql.DB) *ReviewService {
-	return &ReviewService{db: db}
+// scoreArgs returns the scores in scoreColumns order, with nil for skipped
+// dimensions.
+func scoreArgs(scores ReviewScores) []interface{} {
+	args := make([]interface{}, 0, len(RatingDimensions))
+	for _, dimension := range RatingDimensions {
+		if score, ok := scores[dimension]; ok {
+			args = append(args, score)
+		} else {
+			args = append(args, nil)
+		}
+	}
+	return args
 }
 
-func (s *ReviewService) ListReviews(restaurantID int, limit, offset int) ([]Review, error) {
+// ListReviews returns a page of the restaurant's reviews in the order, with
+// their reactions as seen by viewerID.
+func (s *ReviewService) ListReviews(restaurantID, viewerID int, order ReviewOrder, limit, offset int) ([]Review, error) {
 	rows, err := s.db.Query(`
-	SELECT reviews.id, reviews.restaurant_id, reviews.user_id, users.username, reviews.rating, reviews.comment, COALESCE(reviews.photo_path, ''), reviews.created_at
-        FROM reviews
-        JOIN users ON users.id = reviews.user_id
-        WHERE reviews.restaurant_id = ?
-        ORDER BY reviews.created_at DESC
+	SELECT v.id, v.restaurant_id, v.user_id, users.username, v.rating, `+scoreColumns("v.")+`, v.comment, COALESCE(v.photo_path, ''), v.created_at
+        FROM reviews v
+        JOIN users ON users.id = v.user_id
+        JOIN restaurants ON restaurants.id = v.restaurant_id
+        WHERE v.restaurant_id = ? AND restaurants.workspace_id = ?
+        ORDER BY `+order.orderBy()+`
         LIMIT ? OFFSET ?
-    `, restaurantID, limit, offset)
+    `, restaurantID, s.workspaceID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("list reviews: %w", err)
 	}
@@ -42,22 +172,44 @@ func (s *ReviewService) ListReviews(restaurantID int, limit, offset int) ([]Revi
 	var reviews []Review
 	for rows.Next() {
 		var review Review
-		if err := rows.Scan(&review.ID, &review.RestaurantID, &review.UserID, &review.Username, &review.Rating, &review.Comment, &review.PhotoPath, &review.CreatedAt); err != nil {
+		scoreTargets, scores := scoreTargets()
+		targets := append([]interface{}{&review.ID, &review.RestaurantID, &review.UserID, &review.Username, &review.Rating}, scoreTargets...)
+		targets = append(targets, &review.Comment, &review.PhotoPath, &review.CreatedAt)
+		if err := rows.Scan(targets...); err != nil {
 			return nil, fmt.Errorf("scan review: %w", err)
 		}
+		review.Scores = scores()
 		reviews = append(reviews, review)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows review: %w", err)
 	}
+	rows.Close()
+	if err := s.loadReactions(reviews, viewerID); err != nil {
+		return nil, err
+	}
+	if err := s.loadReplyCounts(reviews); err != nil {
+		return nil, err
+	}
 	return reviews, nil
 }
 
 func (s *ReviewService) CreateReview(review Review) (int, error) {
-	result, err := s.db.Exec(`
-		INSERT INTO reviews (restaurant_id, user_id, rating, comment, photo_path)
-		VALUES (?, ?, ?, ?, ?)
-	`, review.RestaurantID, review.UserID, review.Rating, review.Comment, review.PhotoPath)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ensureRestaurantInWorkspace(tx, s.workspaceID, review.RestaurantID); err != nil {
+		return 0, err
+	}
+	args := append([]interface{}{review.RestaurantID, review.UserID, review.Rating}, scoreArgs(review.Scores)...)
+	args = append(args, review.Comment, review.PhotoPath)
+	result, err := tx.Exec(`
+		INSERT INTO reviews (restaurant_id, user_id, rating, `+scoreColumns("")+`, comment, photo_path)
+		VALUES (?, ?, ?, `+strings.TrimSuffix(strings.Repeat("?, ", len(RatingDimensions)), ", ")+`, ?, ?)
+	`, args...)
 	if err != nil {
 		return 0, fmt.Errorf("create review: %w", err)
 	}
@@ -65,94 +217,159 @@ func (s *ReviewService) CreateReview(review Review) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("review id: %w", err)
 	}
+	if err := s.refreshAggregates(tx, review.RestaurantID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
 	return int(id), nil
 }
 
 func (s *ReviewService) GetReview(id int) (*Review, error) {
 	var review Review
+	scoreTargets, scores := scoreTargets()
+	targets := append([]interface{}{&review.ID, &review.RestaurantID, &review.UserID, &review.Rating}, scoreTargets...)
+	targets = append(targets, &review.Comment, &review.PhotoPath, &review.CreatedAt)
 	err := s.db.QueryRow(`
-		SELECT id, restaurant_id, user_id, rating, comment, COALESCE(photo_path, ''), created_at
-		FROM reviews
-		WHERE id = ?
-	`, id).Scan(
-		&review.ID,
-		&review.RestaurantID,
-		&review.UserID,
-		&review.Rating,
-		&review.Comment,
-		&review.PhotoPath,
-		&review.CreatedAt,
-	)
+		SELECT v.id, v.restaurant_id, v.user_id, v.rating, `+scoreColumns("v.")+`, v.comment, COALESCE(v.photo_path, ''), v.created_at
+		FROM reviews v
+		WHERE v.id = ? AND v.id IN (`+reviewsInWorkspace+`)
+	`, id, s.workspaceID).Scan(targets...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get review: %w", err)
 	}
+	review.Scores = scores()
 	return &review, nil
 }
 
 func (s *ReviewService) UpdateReview(review Review) error {
-	result, err := s.db.Exec(`
+	assignments := make([]string, 0, len(RatingDimensions))
+	for _, dimension := range RatingDimensions {
+		assignments = append(assignments, dimension.column()+" = ?")
+	}
+	args := append([]interface{}{review.Rating}, scoreArgs(review.Scores)...)
+	args = append(args, review.Comment, review.PhotoPath, review.ID, review.UserID, s.workspaceID)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
 		UPDATE reviews
-		SET rating = ?, comment = ?, photo_path = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ? AND user_id = ?
-	`, review.Rating, review.Comment, review.PhotoPath, review.ID, review.UserID)
+		SET rating = ?, `+strings.Join(assignments, ", ")+`, comment = ?, photo_path = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND id IN (`+reviewsInWorkspace+`)
+	`, args...)
 	if err != nil {
 		return fmt.Errorf("update review: %w", err)
 	}
-	affected, err := result.RowsAffected()
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	restaurantID, err := restaurantOfReview(tx, review.ID)
 	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
+		return err
 	}
-	if affected == 0 {
-		return sql.ErrNoRows
+	if err := s.refreshAggregates(tx, restaurantID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
 	}
 	return nil
 }
 
 func (s *ReviewService) DeleteReview(id int, userID int) error {
-	result, err := s.db.Exec(`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	restaurantID, err := restaurantOfReview(tx, id)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
 		DELETE FROM reviews
-		WHERE id = ? AND user_id = ?
-	`, id, userID)
+		WHERE id = ? AND user_id = ? AND id IN (`+reviewsInWorkspace+`)
+	`, id, userID, s.workspaceID)
 	if err != nil {
 		return fmt.Errorf("delete review: %w", err)
 	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
+	if err := requireAffected(result); err != nil {
+		return err
 	}
-	if affected == 0 {
-		return sql.ErrNoRows
+	if err := s.refreshAggregates(tx, restaurantID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
 	}
 	return nil
 }
 
+// refreshAggregates brings the restaurant's stats and ranking score up to
+// date after one of its reviews changed.
+func (s *ReviewService) refreshAggregates(tx *sql.Tx, restaurantID int) error {
+	if err := refreshRestaurantStats(tx, restaurantID); err != nil {
+		return err
+	}
+	return refreshRanking(tx, s.ranking, restaurantID, s.now())
+}
+
 func (s *ReviewService) ListReviewPhotos(reviewID int) ([]string, error) {
+	photos, err := listPhotos(s.db, reviewPhotoTable, s.workspaceID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	return PhotoPaths(photos), nil
+}
+
+func (s *ReviewService) ListReviewPhotoDetails(reviewID int) ([]Photo, error) {
+	return listPhotos(s.db, reviewPhotoTable, s.workspaceID, reviewID)
+}
+
+// PhotosForReviews loads the photos of all the reviews in one query, keyed by
+// review ID and in display order.
+func (s *ReviewService) PhotosForReviews(reviews []Review) (map[int][]Photo, error) {
+	result := make(map[int][]Photo)
+	if len(reviews) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, 0, len(reviews))
+	args := make([]interface{}, 0, len(reviews)+1)
+	args = append(args, s.workspaceID)
+	for _, review := range reviews {
+		placeholders = append(placeholders, "?")
+		args = append(args, review.ID)
+	}
 	rows, err := s.db.Query(`
-		SELECT path
-		FROM review_photos
-		WHERE review_id = ?
-		ORDER BY sort_order ASC, id ASC
-	`, reviewID)
+        SELECT p.review_id, p.id, p.path, p.caption, p.sort_order
+        FROM review_photos p
+        WHERE p.review_id IN (`+reviewsInWorkspace+`) AND p.review_id IN (`+strings.Join(placeholders, ",")+`)
+        ORDER BY p.sort_order ASC, p.id ASC
+    `, args...)
 	if err != nil {
-		return nil, fmt.Errorf("list review photos: %w", err)
+		return nil, fmt.Errorf("list review photo map: %w", err)
 	}
 	defer rows.Close()
-
-	paths := make([]string, 0)
 	for rows.Next() {
-		var path string
-		if err := rows.Scan(&path); err != nil {
-			return nil, fmt.Errorf("scan review photo: %w", err)
+		var reviewID int
+		var photo Photo
+		if err := rows.Scan(&reviewID, &photo.ID, &photo.Path, &photo.Caption, &photo.SortOrder); err != nil {
+			return nil, fmt.Errorf("scan review photo map: %w", err)
 		}
-		paths = append(paths, path)
+		result[reviewID] = append(result[reviewID], photo)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows review photo: %w", err)
+		return nil, fmt.Errorf("rows review photo map: %w", err)
 	}
-	return paths, nil
+	return result, nil
 }
 
 func (s *ReviewService) ReplaceReviewPhotos(reviewID int, photoPaths []string) error {
@@ -162,30 +379,31 @@ func (s *ReviewService) ReplaceReviewPhotos(reviewID int, photoPaths []string) e
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM review_photos WHERE review_id = ?", reviewID); err != nil {
-		return fmt.Errorf("clear review photos: %w", err)
+	if err := syncPhotos(tx, reviewPhotoTable, s.workspaceID, reviewID, 0, photoPaths); err != nil {
+		return err
 	}
 
-	if len(photoPaths) > 0 {
-		stmt, err := tx.Prepare("INSERT INTO review_photos (review_id, path, sort_order) VALUES (?, ?, ?)")
-		if err != nil {
-			return fmt.Errorf("prepare review photos: %w", err)
-		}
-		defer stmt.Close()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
 
-		for i, path := range photoPaths {
-			if _, err := stmt.Exec(reviewID, path, i); err != nil {
-				return fmt.Errorf("insert review photo: %w", err)
-			}
-		}
+// ArrangeReviewPhotos saves the order and captions of a review's photos in
+// one transaction. Only the review author may do so; otherwise sql.ErrNoRows
+// is returned.
+func (s *ReviewService) ArrangeReviewPhotos(reviewID, userID int, arrangement PhotoArrangement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
 	}
+	defer tx.Rollback()
 
-	firstPath := ""
-	if len(photoPaths) > 0 {
-		firstPath = photoPaths[0]
+	if err := ensureReviewOwner(tx, reviewID, userID); err != nil {
+		return err
 	}
-	if _, err := tx.Exec("UPDATE reviews SET photo_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", firstPath, reviewID); err != nil {
-		return fmt.Errorf("sync review photo_path: %w", err)
+	if err := arrangePhotos(tx, reviewPhotoTable, s.workspaceID, reviewID, arrangement); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -194,18 +412,80 @@ func (s *ReviewService) ReplaceReviewPhotos(reviewID int, photoPaths []string) e
 	return nil
 }
 
-func (s *ReviewService) AverageRating(restaurantID int) (float64, int, error) {
-	var avg sql.NullFloat64
-	var count int
-	if err := s.db.QueryRow(`
-        SELECT AVG(rating), COUNT(*)
-        FROM reviews
-        WHERE restaurant_id = ?
-    `, restaurantID).Scan(&avg, &count); err != nil {
-		return 0, 0, fmt.Errorf("avg rating: %w", err)
+func ensureReviewOwner(tx *sql.Tx, reviewID, userID int) error {
+	var ownerID int
+	err := tx.QueryRow("SELECT user_id FROM reviews WHERE id = ?", reviewID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("review owner: %w", err)
+	}
+	return nil
+}
+
+// RatingSummary returns the averages and star distribution of the
+// restaurant's reviews, as kept in restaurant_stats. Dimensions no review
+// scored are absent.
+func (s *ReviewService) RatingSummary(restaurantID int) (RatingSummary, error) {
+	summary := RatingSummary{Dimensions: make(map[RatingDimension]ScoreAverage)}
+	columns := []string{"st.review_count", "st.average_rating"}
+	targets := []interface{}{&summary.Count, &summary.Average}
+	for i := range summary.Distribution {
+		columns = append(columns, fmt.Sprintf("st.rating_%d_count", i+1))
+		targets = append(targets, &summary.Distribution[i])
+	}
+	averages := make([]sql.NullFloat64, len(RatingDimensions))
+	counts := make([]int, len(RatingDimensions))
+	for i, dimension := range RatingDimensions {
+		columns = append(columns, "st."+dimension.statsAverageColumn(), "st."+dimension.statsCountColumn())
+		targets = append(targets, &averages[i], &counts[i])
+	}
+	err := s.db.QueryRow(`
+        SELECT `+strings.Join(columns, ", ")+`
+        FROM restaurant_stats st
+        INNER JOIN restaurants r ON r.id = st.restaurant_id
+        WHERE st.restaurant_id = ? AND r.workspace_id = ?
+    `, restaurantID, s.workspaceID).Scan(targets...)
+	if err == sql.ErrNoRows {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, fmt.Errorf("rating summary: %w", err)
+	}
+	for i, dimension := range RatingDimensions {
+		if averages[i].Valid {
+			summary.Dimensions[dimension] = ScoreAverage{Average: averages[i].Float64, Count: counts[i]}
+		}
+	}
+	return summary, nil
+}
+
+// ScoreAverages returns the average of the dimension for each of the
+// workspace's restaurants, keyed by restaurant ID, as kept in
+// restaurant_stats. Restaurants without scores are absent.
+func (s *ReviewService) ScoreAverages(dimension RatingDimension) (map[int]ScoreAverage, error) {
+	rows, err := s.db.Query(`
+        SELECT st.restaurant_id, st.`+dimension.statsAverageColumn()+`, st.`+dimension.statsCountColumn()+`
+        FROM restaurant_stats st
+        INNER JOIN restaurants r ON r.id = st.restaurant_id
+        WHERE r.workspace_id = ? AND st.`+dimension.statsCountColumn()+` > 0
+    `, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("score averages: %w", err)
 	}
-	if !avg.Valid {
-		return 0, 0, nil
+	defer rows.Close()
+	averages := make(map[int]ScoreAverage)
+	for rows.Next() {
+		var restaurantID int
+		var average ScoreAverage
+		if err := rows.Scan(&restaurantID, &average.Average, &average.Count); err != nil {
+			return nil, fmt.Errorf("scan score average: %w", err)
+		}
+		averages[restaurantID] = average
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows score average: %w", err)
 	}
-	return avg.Float64, count, nil
+	return averages, nil
 }
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RestaurantStats are the aggregates list and detail pages show for a
+// restaurant, kept in restaurant_stats so pages need not compute them.
+type RestaurantStats struct {
+	ReviewCount int
+	Average     float64
+	// Score is the ranking score (see RankingConfig), 0 without reviews.
+	Score float64
+	// LastReviewedAt is when the latest review was written, zero if none.
+	LastReviewedAt time.Time
+	// PhotoCount counts the restaurant's photos and its reviews' photos.
+	PhotoCount int
+	// CoverPhotoPath is the restaurant's first photo, or else the first photo
+	// of its latest review with photos; "" when there are none.
+	CoverPhotoPath string
+}
+
+// restaurantStatsUpsert recomputes restaurant_stats for the restaurants
+// matched by the %s condition on r. The ranking score is left to
+// refreshRanking, which needs the RankingConfig.
+var restaurantStatsUpsert = buildRestaurantStatsUpsert()
+
+func buildRestaurantStatsUpsert() string {
+	columns := []string{"review_count", "average_rating", "last_reviewed_at", "photo_count"}
+	values := []string{"COUNT(v.id)", "COALESCE(AVG(v.rating), 0)", "MAX(v.created_at)", `(SELECT COUNT(*) FROM restaurant_photos p WHERE p.restaurant_id = r.id)
+                 + (SELECT COUNT(*) FROM review_photos p INNER JOIN reviews pv ON pv.id = p.review_id WHERE pv.restaurant_id = r.id)`}
+	for rating := 1; rating <= 5; rating++ {
+		columns = append(columns, fmt.Sprintf("rating_%d_count", rating))
+		values = append(values, fmt.Sprintf("COUNT(CASE WHEN v.rating = %d THEN 1 END)", rating))
+	}
+	for _, dimension := range RatingDimensions {
+		columns = append(columns, dimension.statsAverageColumn(), dimension.statsCountColumn())
+		values = append(values, "AVG(v."+dimension.column()+")", "COUNT(v."+dimension.column()+")")
+	}
+	columns = append(columns, "cover_photo_path")
+	values = append(values, `COALESCE(
+                 (SELECT p.path FROM restaurant_photos p WHERE p.restaurant_id = r.id ORDER BY p.sort_order ASC, p.id ASC LIMIT 1),
+                 (SELECT p.path FROM review_photos p INNER JOIN reviews pv ON pv.id = p.review_id
+                  WHERE pv.restaurant_id = r.id ORDER BY pv.created_at DESC, pv.id DESC, p.sort_order ASC, p.id ASC LIMIT 1),
+                 '')`)
+	updates := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		updates = append(updates, column+" = excluded."+column)
+	}
+	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
+	return `
+        INSERT INTO restaurant_stats (restaurant_id, ` + strings.Join(columns, ", ") + `)
+        SELECT r.id, ` + strings.Join(values, ", ") + `
+        FROM restaurants r
+        LEFT JOIN reviews v ON v.restaurant_id = r.id
+        WHERE %s
+        GROUP BY r.id
+        ON CONFLICT(restaurant_id) DO UPDATE SET
+            ` + strings.Join(updates, ",\n            ") + `
+`
+}
+
+// refreshRestaurantStats recomputes the restaurant's stats. Callers run it in
+// the transaction that changed the restaurant's reviews or photos.
+func refreshRestaurantStats(q execer, restaurantID int) error {
+	if _, err := q.Exec(fmt.Sprintf(restaurantStatsUpsert, "r.id = ?"), restaurantID); err != nil {
+		return fmt.Errorf("refresh restaurant stats: %w", err)
+	}
+	return nil
+}
+
+// RefreshStats recomputes the stats of every restaurant in every workspace,
+// filling in restaurants that have none yet.
+func (s *RestaurantService) RefreshStats() error {
+	if _, err := s.db.Exec(fmt.Sprintf(restaurantStatsUpsert, "1 = 1")); err != nil {
+		return fmt.Errorf("refresh restaurant stats: %w", err)
+	}
+	return nil
+}
+
+// StatsForRestaurants loads the stats of the restaurants in one query, keyed
+// by restaurant ID. Restaurants without a stats row are absent.
+func (s *RestaurantService) StatsForRestaurants(restaurants []Restaurant) (map[int]RestaurantStats, error) {
+	result := make(map[int]RestaurantStats)
+	if len(restaurants) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, 0, len(restaurants))
+	args := make([]interface{}, 0, len(restaurants)+1)
+	args = append(args, s.workspaceID)
+	for _, rest := range restaurants {
+		placeholders = append(placeholders, "?")
+		args = append(args, rest.ID)
+	}
+	rows, err := s.db.Query(`
+        SELECT st.restaurant_id, st.review_count, st.average_rating, COALESCE(st.score, 0), COALESCE(st.last_reviewed_at, ''), st.photo_count, st.cover_photo_path
+        FROM restaurant_stats st
+        INNER JOIN restaurants r ON r.id = st.restaurant_id
+        WHERE r.workspace_id = ? AND st.restaurant_id IN (`+strings.Join(placeholders, ",")+`)
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list restaurant stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var restaurantID int
+		var stats RestaurantStats
+		var lastReviewedAt string
+		if err := rows.Scan(&restaurantID, &stats.ReviewCount, &stats.Average, &stats.Score, &lastReviewedAt, &stats.PhotoCount, &stats.CoverPhotoPath); err != nil {
+			return nil, fmt.Errorf("scan restaurant stats: %w", err)
+		}
+		stats.LastReviewedAt = parseTimestamp(lastReviewedAt)
+		result[restaurantID] = stats
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows restaurant stats: %w", err)
+	}
+	return result, nil
+}
+
+// restaurantOfReview returns the restaurant the review is about.
+func restaurantOfReview(q rowQueryer, reviewID int) (int, error) {
+	var restaurantID int
+	err := q.QueryRow("SELECT restaurant_id FROM reviews WHERE id = ?", reviewID).Scan(&restaurantID)
+	if err == sql.ErrNoRows {
+		return 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get review restaurant: %w", err)
+	}
+	return restaurantID, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRatingSummaryFollowsReviewWrites(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	bob := insertUser(t, database, "bob")
+	restaurant := insertRestaurant(t, database, 1, alice, "Ramen")
+	reviews := NewReviewService(database, DefaultRankingConfig).InWorkspace(1)
+
+	aliceReview, err := reviews.CreateReview(Review{RestaurantID: restaurant, UserID: alice, Rating: 5, Scores: ReviewScores{DimensionTaste: 4}})
+	if err != nil {
+		t.Fatalf("CreateReview: %v", err)
+	}
+	bobReview, err := reviews.CreateReview(Review{RestaurantID: restaurant, UserID: bob, Rating: 2})
+	if err != nil {
+		t.Fatalf("CreateReview: %v", err)
+	}
+	summary, err := reviews.RatingSummary(restaurant)
+	if err != nil {
+		t.Fatalf("RatingSummary: %v", err)
+	}
+	want := RatingSummary{
+		Average:      3.5,
+		Count:        2,
+		Distribution: [5]int{0, 1, 0, 0, 1},
+		Dimensions:   map[RatingDimension]ScoreAverage{DimensionTaste: {Average: 4, Count: 1}},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+
+	if err := reviews.DeleteReview(bobReview, bob); err != nil {
+		t.Fatalf("DeleteReview: %v", err)
+	}
+	var createdAt string
+	if err := database.QueryRow("SELECT created_at FROM reviews WHERE id = ?", aliceReview).Scan(&createdAt); err != nil {
+		t.Fatalf("select created_at: %v", err)
+	}
+	restaurants := NewRestaurantService(database).InWorkspace(1)
+	stats, err := restaurants.StatsForRestaurants([]Restaurant{{ID: restaurant}})
+	if err != nil {
+		t.Fatalf("StatsForRestaurants: %v", err)
+	}
+	// The Bayesian average of one 5 against the default prior of five 3s.
+	wantStats := RestaurantStats{ReviewCount: 1, Average: 5, Score: 20.0 / 6, LastReviewedAt: parseTimestamp(createdAt)}
+	if got := stats[restaurant]; got != wantStats {
+		t.Errorf("stats = %+v, want %+v", got, wantStats)
+	}
+
+	if err := restaurants.ReplaceRestaurantPhotos(restaurant, alice, []string{"uploads/front.jpg"}); err != nil {
+		t.Fatalf("ReplaceRestaurantPhotos: %v", err)
+	}
+	if err := reviews.ReplaceReviewPhotos(aliceReview, []string{"uploads/bowl.jpg"}); err != nil {
+		t.Fatalf("ReplaceReviewPhotos: %v", err)
+	}
+	stats, err = restaurants.StatsForRestaurants([]Restaurant{{ID: restaurant}})
+	if err != nil {
+		t.Fatalf("StatsForRestaurants: %v", err)
+	}
+	wantStats.PhotoCount = 2
+	wantStats.CoverPhotoPath = "uploads/front.jpg"
+	if got := stats[restaurant]; got != wantStats {
+		t.Errorf("stats after photos = %+v, want %+v", got, wantStats)
+	}
+
+	// Another workspace sees nothing of the restaurant.
+	other := insertWorkspace(t, database, "other")
+	summary, err = reviews.InWorkspace(other).RatingSummary(restaurant)
+	if err != nil {
+		t.Fatalf("RatingSummary: %v", err)
+	}
+	if summary.Count != 0 || len(summary.Dimensions) != 0 {
+		t.Errorf("other workspace summary = %+v, want empty", summary)
+	}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+// SuggestionFilter limits the restaurants a suggestion may pick. Restaurants
+// with unknown opening hours or budget are kept by the OpenAt and MaxBudget
+// filters, which only drop places known not to match.
+type SuggestionFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	// IncludeTags keeps restaurants with any of the tags; ExcludeTags drops
+	// restaurants with any of them.
+	IncludeTags []string
+	ExcludeTags []string
+	// OpenAt keeps restaurants open at that time; zero disables the filter.
+	OpenAt    time.Time
+	MaxBudget int
+	MinRating float64
+	// UserID is the user whose recent visits make a place less likely.
+	UserID int
+	// WantToGoOnly keeps only the places on UserID's want-to-go list.
+	WantToGoOnly bool
+	// CollectionID keeps only the places in the collection; 0 disables the
+	// filter. Callers check that the user may see the collection.
+	CollectionID int
+}
+
+// SuggestionWeights decides how likely each candidate is to be picked.
+type SuggestionWeights struct {
+	// RatingExponent raises the ranking score to this power, so 0 ignores
+	// ratings and larger values favour well rated places more strongly.
+	RatingExponent float64
+	// UnratedRating stands in for the score of places without reviews.
+	UnratedRating float64
+	// A place the user visited within RecentWindow has its weight multiplied
+	// by RecentFactor, recovering linearly to 1 as the review ages.
+	RecentWindow time.Duration
+	RecentFactor float64
+}
+
+var DefaultSuggestionWeights = SuggestionWeights{
+	RatingExponent: 2,
+	UnratedRating:  3,
+	RecentWindow:   14 * 24 * time.Hour,
+	RecentFactor:   0.2,
+}
+
+type SuggestionCandidate struct {
+	Restaurant  Restaurant
+	Tags        []string
+	DistanceKm  float64
+	Average     float64
+	ReviewCount int
+	// Score is the place's ranking score, 0 without reviews.
+	Score float64
+	// LastVisited is when the filter's user last checked in at or reviewed
+	// the place, zero if never.
+	LastVisited time.Time
+	// WantToGo reports whether the place is on the filter's user's
+	// want-to-go list.
+	WantToGo bool
+	Weight   float64
+}
+
+// SuggestionService picks random restaurants. Picks depend only on the
+// candidates and the seed, so a seed replays the same sequence.
+type SuggestionService struct {
+	db          *sql.DB
+	workspaceID int
+	weights     SuggestionWeights
+	now         func() time.Time
+}
+
+func NewSuggestionService(db *sql.DB, weights SuggestionWeights) *SuggestionService {
+	return &SuggestionService{db: db, weights: weights, now: time.Now}
+}
+
+// InWorkspace returns a copy of the service limited to the workspace.
+func (s *SuggestionService) InWorkspace(workspaceID int) *SuggestionService {
+	scoped := *s
+	scoped.workspaceID = workspaceID
+	return &scoped
+}
+
+// Candidates returns the restaurants matching the filter with their weights,
+// ordered by ID.
+func (s *SuggestionService) Candidates(filter SuggestionFilter) ([]SuggestionCandidate, error) {
+	rows, err := s.db.Query(`
+        SELECT r.id, r.name, r.description, COALESCE(r.photo_path, ''), r.latitude, r.longitude, r.address, r.maps_url,
+               COALESCE(r.budget, 0), COALESCE(r.opening_hours, ''),
+               COALESCE(st.average_rating, 0), COALESCE(st.review_count, 0), COALESCE(st.score, 0),
+               COALESCE((SELECT MAX(v.created_at) FROM reviews v WHERE v.restaurant_id = r.id AND v.user_id = ?), ''),
+               COALESCE((
+                SELECT MAX(c.visited_on) FROM checkins c
+                WHERE c.restaurant_id = r.id
+                  AND (c.user_id = ? OR EXISTS (SELECT 1 FROM checkin_companions p WHERE p.checkin_id = c.id AND p.user_id = ?))
+               ), ''),
+               EXISTS (SELECT 1 FROM restaurant_marks m WHERE m.restaurant_id = r.id AND m.user_id = ? AND m.kind = ?)
+        FROM restaurants r
+        LEFT JOIN restaurant_stats st ON st.restaurant_id = r.id
+        WHERE r.workspace_id = ?
+          AND (? = 0 OR r.id IN (SELECT restaurant_id FROM collection_items WHERE collection_id = ?))
+        ORDER BY r.id ASC
+    `, filter.UserID, filter.UserID, filter.UserID, filter.UserID, string(MarkWantToGo), s.workspaceID, filter.CollectionID, filter.CollectionID)
+	if err != nil {
+		return nil, fmt.Errorf("list suggestion candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []SuggestionCandidate
+	for rows.Next() {
+		var candidate SuggestionCandidate
+		var lastReviewed, lastCheckedIn string
+		rest := &candidate.Restaurant
+		if err := rows.Scan(&rest.ID, &rest.Name, &rest.Description, &rest.PhotoPath, &rest.Latitude, &rest.Longitude, &rest.Address, &rest.MapsURL,
+			&rest.Budget, &rest.OpeningHours, &candidate.Average, &candidate.ReviewCount, &candidate.Score, &lastReviewed, &lastCheckedIn, &candidate.WantToGo); err != nil {
+			return nil, fmt.Errorf("scan suggestion candidate: %w", err)
+		}
+		candidate.LastVisited = laterVisit(parseTimestamp(lastReviewed), parseVisitDate(lastCheckedIn))
+		candidate.DistanceKm = util.HaversineDistanceKm(filter.Latitude, filter.Longitude, rest.Latitude, rest.Longitude)
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows suggestion candidate: %w", err)
+	}
+
+	tags, err := s.tagsByRestaurant()
+	if err != nil {
+		return nil, err
+	}
+	matched := candidates[:0]
+	for _, candidate := range candidates {
+		candidate.Tags = tags[candidate.Restaurant.ID]
+		if !filter.matches(candidate) {
+			continue
+		}
+		candidate.Weight = s.weight(candidate)
+		matched = append(matched, candidate)
+	}
+	return matched, nil
+}
+
+// Suggest returns the first candidate in the seed's sequence that is not in
+// seen, or nil when every candidate has been seen. Passing the IDs suggested
+// so far re-rolls without repeats.
+func (s *SuggestionService) Suggest(filter SuggestionFilter, seed int64, seen []int) (*SuggestionCandidate, error) {
+	candidates, err := s.Candidates(filter)
+	if err != nil {
+		return nil, err
+	}
+	seenSet := make(map[int]bool, len(seen))
+	for _, id := range seen {
+		seenSet[id] = true
+	}
+	for _, candidate := range SuggestionSequence(candidates, seed) {
+		if !seenSet[candidate.Restaurant.ID] {
+			return &candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// SuggestionSequence orders the candidates as successive weighted draws
+// without replacement, using the keys of Efraimidis and Spirakis. The order is
+// fixed by the seed and the order of candidates.
+func SuggestionSequence(candidates []SuggestionCandidate, seed int64) []SuggestionCandidate {
+	rnd := rand.New(rand.NewSource(seed))
+	keys := make([]float64, len(candidates))
+	order := make([]int, len(candidates))
+	for i, candidate := range candidates {
+		order[i] = i
+		weight := candidate.Weight
+		if weight <= 0 {
+			weight = math.SmallestNonzeroFloat64
+		}
+		keys[i] = math.Log(1-rnd.Float64()) / weight
+	}
+	sort.SliceStable(order, func(a, b int) bool { return keys[order[a]] > keys[order[b]] })
+	sequence := make([]SuggestionCandidate, len(candidates))
+	for i, index := range order {
+		sequence[i] = candidates[index]
+	}
+	return sequence
+}
+
+func (f SuggestionFilter) matches(candidate SuggestionCandidate) bool {
+	if f.WantToGoOnly && !candidate.WantToGo {
+		return false
+	}
+	if f.RadiusKm > 0 && candidate.DistanceKm > f.RadiusKm {
+		return false
+	}
+	if len(f.IncludeTags) > 0 && !hasAnyTag(candidate.Tags, f.IncludeTags) {
+		return false
+	}
+	if hasAnyTag(candidate.Tags, f.ExcludeTags) {
+		return false
+	}
+	if f.MaxBudget > 0 && candidate.Restaurant.Budget > f.MaxBudget {
+		return false
+	}
+	if f.MinRating > 0 && (candidate.ReviewCount == 0 || candidate.Average < f.MinRating) {
+		return false
+	}
+	if !f.OpenAt.IsZero() && candidate.Restaurant.OpeningHours != "" {
+		hours, err := util.ParseOpeningHours(candidate.Restaurant.OpeningHours)
+		if err == nil && !hours.OpenAt(f.OpenAt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SuggestionService) weight(candidate SuggestionCandidate) float64 {
+	rating := candidate.Score
+	if candidate.ReviewCount == 0 || rating == 0 {
+		rating = s.weights.UnratedRating
+	}
+	weight := math.Pow(math.Max(rating, 1), s.weights.RatingExponent)
+	if !candidate.LastVisited.IsZero() && s.weights.RecentWindow > 0 {
+		age := s.now().Sub(candidate.LastVisited)
+		if age < s.weights.RecentWindow {
+			progress := math.Max(age.Hours(), 0) / s.weights.RecentWindow.Hours()
+			weight *= s.weights.RecentFactor + (1-s.weights.RecentFactor)*progress
+		}
+	}
+	return weight
+}
+
+func (s *SuggestionService) tagsByRestaurant() (map[int][]string, error) {
+	rows, err := s.db.Query(`
+        SELECT rt.restaurant_id, t.name
+        FROM restaurant_tags rt
+        INNER JOIN tags t ON t.id = rt.tag_id
+        INNER JOIN restaurants r ON r.id = rt.restaurant_id
+        WHERE r.workspace_id = ?
+        ORDER BY t.name ASC
+    `, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list suggestion tags: %w", err)
+	}
+	defer rows.Close()
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var restaurantID int
+		var name string
+		if err := rows.Scan(&restaurantID, &name); err != nil {
+			return nil, fmt.Errorf("scan suggestion tag: %w", err)
+		}
+		tags[restaurantID] = append(tags[restaurantID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows suggestion tag: %w", err)
+	}
+	return tags, nil
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, name := range wanted {
+			if strings.EqualFold(tag, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseTimestamp reads a SQLite timestamp, which is stored in UTC. Values that
+// come out of an aggregate lose their column type and arrive as plain text.
+func parseTimestamp(value string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// suggestionFixture stores four restaurants in the public workspace and
+// returns their IDs in insertion order.
+func suggestionFixture(t *testing.T) (*SuggestionService, []int) {
+	t.Helper()
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	var ids []int
+	for _, name := range []string{"udon", "ramen", "curry", "soba"} {
+		ids = append(ids, insertRestaurant(t, database, 1, alice, name))
+	}
+	return NewSuggestionService(database, DefaultSuggestionWeights).InWorkspace(1), ids
+}
+
+// drawAll calls Suggest with the picks so far as seen until it runs out.
+func drawAll(t *testing.T, suggestions *SuggestionService, seed int64) []int {
+	t.Helper()
+	var seen []int
+	for {
+		candidate, err := suggestions.Suggest(SuggestionFilter{}, seed, seen)
+		if err != nil {
+			t.Fatalf("Suggest: %v", err)
+		}
+		if candidate == nil {
+			return seen
+		}
+		for _, id := range seen {
+			if id == candidate.Restaurant.ID {
+				t.Fatalf("Suggest returned %d again after %v", id, seen)
+			}
+		}
+		seen = append(seen, candidate.Restaurant.ID)
+	}
+}
+
+func TestSuggestSeedGivesStableOrder(t *testing.T) {
+	suggestions, ids := suggestionFixture(t)
+	got := drawAll(t, suggestions, 42)
+	want := []int{ids[1], ids[3], ids[0], ids[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("picks with seed 42 = %v, want %v", got, want)
+	}
+	if again := drawAll(t, suggestions, 42); !reflect.DeepEqual(again, got) {
+		t.Errorf("second run with seed 42 = %v, want %v", again, got)
+	}
+}
+
+func TestSuggestSkipsSeen(t *testing.T) {
+	suggestions, ids := suggestionFixture(t)
+	for _, seen := range [][]int{nil, {ids[1]}, {ids[1], ids[3]}, {ids[0], ids[1], ids[2]}} {
+		candidate, err := suggestions.Suggest(SuggestionFilter{}, 42, seen)
+		if err != nil {
+			t.Fatalf("Suggest: %v", err)
+		}
+		if candidate == nil {
+			t.Fatalf("Suggest(seen %v) = nil, want a pick", seen)
+		}
+		for _, id := range seen {
+			if candidate.Restaurant.ID == id {
+				t.Errorf("Suggest(seen %v) picked seen restaurant %d", seen, id)
+			}
+		}
+	}
+}
+
+func TestSuggestExhausted(t *testing.T) {
+	suggestions, ids := suggestionFixture(t)
+	candidate, err := suggestions.Suggest(SuggestionFilter{}, 42, ids)
+	if err != nil {
+		t.Fatalf("Suggest: %v", err)
+	}
+	if candidate != nil {
+		t.Errorf("Suggest with every restaurant seen = %+v, want nil", candidate.Restaurant)
+	}
+
+	empty := NewSuggestionService(newTestDB(t), DefaultSuggestionWeights).InWorkspace(1)
+	candidate, err = empty.Suggest(SuggestionFilter{}, 42, nil)
+	if err != nil {
+		t.Fatalf("Suggest: %v", err)
+	}
+	if candidate != nil {
+		t.Errorf("Suggest without restaurants = %+v, want nil", candidate.Restaurant)
+	}
+}
+
+func TestCandidatesReadRestaurantStats(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	bob := insertUser(t, database, "bob")
+	reviewed := insertRestaurant(t, database, 1, alice, "ramen")
+	unreviewed := insertRestaurant(t, database, 1, alice, "udon")
+	reviews := NewReviewService(database, DefaultRankingConfig).InWorkspace(1)
+	for _, review := range []Review{{RestaurantID: reviewed, UserID: alice, Rating: 5}, {RestaurantID: reviewed, UserID: bob, Rating: 2}} {
+		if _, err := reviews.CreateReview(review); err != nil {
+			t.Fatalf("CreateReview: %v", err)
+		}
+	}
+
+	candidates, err := NewSuggestionService(database, DefaultSuggestionWeights).InWorkspace(1).Candidates(SuggestionFilter{UserID: bob})
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("len(candidates) = %d, want 2", len(candidates))
+	}
+	// The Bayesian average of a 5 and a 2 against the default prior of five 3s.
+	got := candidates[0]
+	if got.Restaurant.ID != reviewed || got.ReviewCount != 2 || got.Average != 3.5 || got.Score != 22.0/7 || got.LastVisited.IsZero() {
+		t.Errorf("reviewed candidate = %+v, want 2 reviews averaging 3.5 with score 22/7 visited by bob", got)
+	}
+	got = candidates[1]
+	if got.Restaurant.ID != unreviewed || got.ReviewCount != 0 || got.Average != 0 || got.Score != 0 || !got.LastVisited.IsZero() {
+		t.Errorf("unreviewed candidate = %+v, want no reviews", got)
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TrainExpiry is how long after its departure a lunch train stays on the
+// board.
+const TrainExpiry = 30 * time.Minute
+
+// trainRetention is how long expired trains are kept before being purged.
+const trainRetention = 7 * 24 * time.Hour
+
+// Train is a "lunch train": someone heading to a restaurant at a set time
+// that others can join.
+type Train struct {
+	ID             int          `json:"id"`
+	RestaurantID   int          `json:"restaurant_id"`
+	RestaurantName string       `json:"restaurant_name"`
+	CreatedBy      int          `json:"created_by"`
+	CreatorName    string       `json:"creator_name"`
+	DepartsAt      time.Time    `json:"departs_at"`
+	Note           string       `json:"note"`
+	Riders         []TrainRider `json:"riders"`
+}
+
+// ExpiresAt is when the train leaves the board.
+func (t Train) ExpiresAt() time.Time {
+	return t.DepartsAt.Add(TrainExpiry)
+}
+
+type TrainRider struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type TrainService struct {
+	db          *sql.DB
+	workspaceID int
+	now         func() time.Time
+}
+
+func NewTrainService(db *sql.DB) *TrainService {
+	return &TrainService{db: db, now: time.Now}
+}
+
+// InWorkspace returns a copy of the service that only sees the workspace's
+// trains.
+func (s *TrainService) InWorkspace(workspaceID int) *TrainService {
+	scoped := *s
+	scoped.workspaceID = workspaceID
+	return &scoped
+}
+
+// ListTrains returns the workspace's trains that have not expired, soonest
+// departure first. The creator is always the first rider.
+func (s *TrainService) ListTrains() ([]Train, error) {
+	rows, err := s.db.Query(`
+        SELECT t.id, t.restaurant_id, r.name, t.created_by, u.username, t.departs_at, t.note
+        FROM lunch_trains t
+        INNER JOIN restaurants r ON r.id = t.restaurant_id
+        INNER JOIN users u ON u.id = t.created_by
+        WHERE t.workspace_id = ? AND t.departs_at > ?
+        ORDER BY t.departs_at ASC, t.id ASC
+    `, s.workspaceID, s.now().Add(-TrainExpiry).UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list trains: %w", err)
+	}
+	defer rows.Close()
+
+	trains := []Train{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var train Train
+		if err := rows.Scan(&train.ID, &train.RestaurantID, &train.RestaurantName, &train.CreatedBy, &train.CreatorName, &train.DepartsAt, &train.Note); err != nil {
+			return nil, fmt.Errorf("scan train: %w", err)
+		}
+		train.Riders = []TrainRider{}
+		index[train.ID] = len(trains)
+		trains = append(trains, train)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows train: %w", err)
+	}
+	if len(trains) == 0 {
+		return trains, nil
+	}
+
+	riderRows, err := s.db.Query(`
+        SELECT p.train_id, u.id, u.username
+        FROM lunch_train_riders p
+        INNER JOIN lunch_trains t ON t.id = p.train_id
+        INNER JOIN users u ON u.id = p.user_id
+        WHERE t.workspace_id = ? AND t.departs_at > ?
+        ORDER BY p.joined_at ASC, u.username ASC
+    `, s.workspaceID, s.now().Add(-TrainExpiry).UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list train riders: %w", err)
+	}
+	defer riderRows.Close()
+	for riderRows.Next() {
+		var trainID int
+		var rider TrainRider
+		if err := riderRows.Scan(&trainID, &rider.UserID, &rider.Username); err != nil {
+			return nil, fmt.Errorf("scan train rider: %w", err)
+		}
+		if i, ok := index[trainID]; ok {
+			trains[i].Riders = append(trains[i].Riders, rider)
+		}
+	}
+	if err := riderRows.Err(); err != nil {
+		return nil, fmt.Errorf("rows train rider: %w", err)
+	}
+	return trains, nil
+}
+
+// CreateTrain puts a train on the board with its creator as the first rider.
+// Trains that expired long ago are purged at the same time.
+func (s *TrainService) CreateTrain(restaurantID, userID int, departsAt time.Time, note string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO lunch_trains (workspace_id, restaurant_id, created_by, departs_at, note)
+        SELECT workspace_id, id, ?, ?, ? FROM restaurants WHERE id = ? AND workspace_id = ?
+    `, userID, departsAt.UTC(), note, restaurantID, s.workspaceID)
+	if err != nil {
+		return 0, fmt.Errorf("create train: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("train id: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO lunch_train_riders (train_id, user_id) VALUES (?, ?)", id, userID); err != nil {
+		return 0, fmt.Errorf("add train rider: %w", err)
+	}
+	if err := purgeTrains(tx, s.now().Add(-trainRetention)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+	return int(id), nil
+}
+
+func purgeTrains(db execer, before time.Time) error {
+	if _, err := db.Exec("DELETE FROM lunch_train_riders WHERE train_id IN (SELECT id FROM lunch_trains WHERE departs_at < ?)", before.UTC()); err != nil {
+		return fmt.Errorf("purge train riders: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM lunch_trains WHERE departs_at < ?", before.UTC()); err != nil {
+		return fmt.Errorf("purge trains: %w", err)
+	}
+	return nil
+}
+
+// Join adds the user to a train on the board. Joining twice is not an error.
+func (s *TrainService) Join(trainID, userID int) error {
+	result, err := s.db.Exec(`
+        INSERT OR IGNORE INTO lunch_train_riders (train_id, user_id)
+        SELECT id, ? FROM lunch_trains WHERE id = ? AND workspace_id = ? AND departs_at > ?
+    `, userID, trainID, s.workspaceID, s.now().Add(-TrainExpiry).UTC())
+	if err != nil {
+		return fmt.Errorf("join train: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		train, err := s.getTrain(trainID)
+		if err != nil {
+			return err
+		}
+		if train == nil {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// Leave takes the user off a train. The creator cannot leave; they cancel
+// the train instead.
+func (s *TrainService) Leave(trainID, userID int) error {
+	result, err := s.db.Exec(`
+        DELETE FROM lunch_train_riders
+        WHERE train_id = ? AND user_id = ?
+          AND train_id IN (SELECT id FROM lunch_trains WHERE workspace_id = ? AND created_by <> ?)
+    `, trainID, userID, s.workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("leave train: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// Cancel removes the train from the board. Only its creator may cancel it.
+func (s *TrainService) Cancel(trainID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM lunch_trains WHERE id = ? AND workspace_id = ? AND created_by = ?", trainID, s.workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("cancel train: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM lunch_train_riders WHERE train_id = ?", trainID); err != nil {
+		return fmt.Errorf("delete train riders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// getTrain returns the train if it is still on the board, else nil.
+func (s *TrainService) getTrain(id int) (*Train, error) {
+	var train Train
+	err := s.db.QueryRow(`
+        SELECT id, restaurant_id, created_by, departs_at, note
+        FROM lunch_trains
+        WHERE id = ? AND workspace_id = ? AND departs_at > ?
+    `, id, s.workspaceID, s.now().Add(-TrainExpiry).UTC()).Scan(&train.ID, &train.RestaurantID, &train.CreatedBy, &train.DepartsAt, &train.Note)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get train: %w", err)
+	}
+	return &train, nil
+}
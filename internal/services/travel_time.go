@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"example.com/gourmetkan/internal/routing"
+)
+
+// estimatedRouteTTL is how long a fallback estimate is trusted before the routing
+// provider is asked again, so a provider outage does not stick in the cache.
+const estimatedRouteTTL = time.Hour
+
+// storeRoutesTimeout bounds writing routes to the cache. The write does not use
+// the caller's context, which the routing provider may already have used up.
+const storeRoutesTimeout = 2 * time.Second
+
+// TravelTime is the route from a base to one restaurant for each travel mode.
+type TravelTime struct {
+	Walking routing.Route
+	Cycling routing.Route
+}
+
+func (t *TravelTime) setRoute(mode routing.Mode, route routing.Route) {
+	if mode == routing.ModeCycling {
+		t.Cycling = route
+		return
+	}
+	t.Walking = route
+}
+
+// TravelTimeService caches routes per (base, restaurant, mode). A cached route is
+// recomputed when the base or the restaurant has moved since it was stored.
+type TravelTimeService struct {
+	db          *sql.DB
+	router      routing.Router
+	workspaceID int
+}
+
+func NewTravelTimeService(db *sql.DB, router routing.Router) *TravelTimeService {
+	return &TravelTimeService{db: db, router: router}
+}
+
+// InWorkspace returns a copy of the service that only reads and writes the
+// cached routes between the workspace's bases and restaurants.
+func (s *TravelTimeService) InWorkspace(workspaceID int) *TravelTimeService {
+	return &TravelTimeService{db: s.db, router: s.router, workspaceID: workspaceID}
+}
+
+type travelTimeKey struct {
+	restaurantID int
+	mode         routing.Mode
+}
+
+// TravelTimes returns the routes from base to each restaurant, keyed by restaurant ID.
+func (s *TravelTimeService) TravelTimes(ctx context.Context, base Base, restaurants []Restaurant) (map[int]TravelTime, error) {
+	cached, err := s.cachedRoutes(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	origin := routing.Point{Latitude: base.Latitude, Longitude: base.Longitude}
+	result := make(map[int]TravelTime, len(restaurants))
+	for _, mode := range routing.Modes {
+		var missing []Restaurant
+		for _, rest := range restaurants {
+			entry, ok := cached[travelTimeKey{restaurantID: rest.ID, mode: mode}]
+			if !ok || !entry.fresh(base, rest) {
+				missing = append(missing, rest)
+				continue
+			}
+			travelTime := result[rest.ID]
+			travelTime.setRoute(mode, entry.route)
+			result[rest.ID] = travelTime
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		points := make([]routing.Point, len(missing))
+		for i, rest := range missing {
+			points[i] = routing.Point{Latitude: rest.Latitude, Longitude: rest.Longitude}
+		}
+		routes, err := s.router.Routes(ctx, mode, origin, points)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", mode, err)
+		}
+		for i, rest := range missing {
+			travelTime := result[rest.ID]
+			travelTime.setRoute(mode, routes[i])
+			result[rest.ID] = travelTime
+		}
+		// The routes are good even if they cannot be cached; they are only
+		// asked for again on the next page.
+		if err := s.storeRoutes(base, mode, missing, routes); err != nil {
+			log.Printf("store travel times: %v", err)
+		}
+	}
+	return result, nil
+}
+
+type cachedRoute struct {
+	route            routing.Route
+	baseLat, baseLng float64
+	restLat, restLng float64
+	expired          bool
+}
+
+func (c cachedRoute) fresh(base Base, rest Restaurant) bool {
+	return !c.expired &&
+		c.baseLat == base.Latitude && c.baseLng == base.Longitude &&
+		c.restLat == rest.Latitude && c.restLng == rest.Longitude
+}
+
+func (s *TravelTimeService) cachedRoutes(ctx context.Context, base Base) (map[travelTimeKey]cachedRoute, error) {
+	cached := make(map[travelTimeKey]cachedRoute)
+	// Bases that are not stored (ID <= 0, such as the current location) are never cached.
+	if base.ID <= 0 {
+		return cached, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.restaurant_id, t.mode, t.distance_km, t.duration_seconds, t.estimated,
+		       t.base_latitude, t.base_longitude, t.restaurant_latitude, t.restaurant_longitude,
+		       t.estimated AND t.updated_at < datetime('now', ?)
+		FROM travel_times t
+		INNER JOIN bases b ON b.id = t.base_id
+		INNER JOIN restaurants r ON r.id = t.restaurant_id
+		WHERE t.base_id = ? AND b.workspace_id = ? AND r.workspace_id = ?
+	`, fmt.Sprintf("-%d seconds", int(estimatedRouteTTL.Seconds())), base.ID, s.workspaceID, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list travel times: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key travelTimeKey
+		var entry cachedRoute
+		var durationSeconds int64
+		if err := rows.Scan(&key.restaurantID, &key.mode, &entry.route.DistanceKm, &durationSeconds, &entry.route.Estimated,
+			&entry.baseLat, &entry.baseLng, &entry.restLat, &entry.restLng, &entry.expired); err != nil {
+			return nil, fmt.Errorf("scan travel time: %w", err)
+		}
+		entry.route.Duration = time.Duration(durationSeconds) * time.Second
+		entry.route.Found = true
+		cached[key] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows travel time: %w", err)
+	}
+	return cached, nil
+}
+
+func (s *TravelTimeService) storeRoutes(base Base, mode routing.Mode, restaurants []Restaurant, routes []routing.Route) error {
+	if base.ID <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeRoutesTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin travel times: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Routes are only stored between a base and a restaurant of the workspace.
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO travel_times (base_id, restaurant_id, mode, distance_km, duration_seconds, estimated,
+			base_latitude, base_longitude, restaurant_latitude, restaurant_longitude, updated_at)
+		SELECT b.id, r.id, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP
+		FROM bases b, restaurants r
+		WHERE b.id = ? AND b.workspace_id = ? AND r.id = ? AND r.workspace_id = ?
+		ON CONFLICT(base_id, restaurant_id, mode) DO UPDATE SET
+			distance_km = excluded.distance_km,
+			duration_seconds = excluded.duration_seconds,
+			estimated = excluded.estimated,
+			base_latitude = excluded.base_latitude,
+			base_longitude = excluded.base_longitude,
+			restaurant_latitude = excluded.restaurant_latitude,
+			restaurant_longitude = excluded.restaurant_longitude,
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare travel times: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, rest := range restaurants {
+		route := routes[i]
+		if !route.Found {
+			continue
+		}
+		if _, err := stmt.ExecContext(ctx, string(mode), route.DistanceKm, int64(route.Duration.Seconds()), route.Estimated,
+			base.Latitude, base.Longitude, rest.Latitude, rest.Longitude,
+			base.ID, s.workspaceID, rest.ID, s.workspaceID); err != nil {
+			return fmt.Errorf("store travel time: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit travel times: %w", err)
+	}
+	return nil
+}
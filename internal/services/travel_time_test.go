@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"example.com/gourmetkan/internal/routing"
+)
+
+// countingRouter answers every destination with the same route and counts the
+// destinations it was asked for.
+type countingRouter struct {
+	asked int
+}
+
+func (c *countingRouter) Routes(ctx context.Context, mode routing.Mode, origin routing.Point, destinations []routing.Point) ([]routing.Route, error) {
+	c.asked += len(destinations)
+	routes := make([]routing.Route, len(destinations))
+	for i := range routes {
+		routes[i] = routing.Route{DistanceKm: 1, Duration: 10 * time.Minute, Found: true}
+	}
+	return routes, nil
+}
+
+func insertBase(t *testing.T, database *sql.DB, workspaceID int, name string) Base {
+	t.Helper()
+	id := insert(t, database, "INSERT INTO bases (name, latitude, longitude, workspace_id) VALUES (?, 34.8, 135.5, ?)", name, workspaceID)
+	return Base{ID: id, Name: name, Latitude: 34.8, Longitude: 135.5}
+}
+
+func TestTravelTimesStayInWorkspace(t *testing.T) {
+	database := newTestDB(t)
+	alice := insertUser(t, database, "alice")
+	lab := insertWorkspace(t, database, "lab")
+	base := insertBase(t, database, 1, "station")
+	ours := Restaurant{ID: insertRestaurant(t, database, 1, alice, "ours"), Latitude: 34.81, Longitude: 135.56}
+	theirs := Restaurant{ID: insertRestaurant(t, database, lab, alice, "theirs"), Latitude: 34.81, Longitude: 135.56}
+	router := &countingRouter{}
+	public := NewTravelTimeService(database, router).InWorkspace(1)
+
+	if _, err := public.TravelTimes(context.Background(), base, []Restaurant{ours, theirs}); err != nil {
+		t.Fatalf("TravelTimes: %v", err)
+	}
+	var stored int
+	if err := database.QueryRow("SELECT COUNT(*) FROM travel_times WHERE restaurant_id = ?", theirs.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Errorf("stored %d routes to another workspace's restaurant, want 0", stored)
+	}
+
+	router.asked = 0
+	if _, err := public.TravelTimes(context.Background(), base, []Restaurant{ours}); err != nil {
+		t.Fatalf("TravelTimes: %v", err)
+	}
+	if router.asked != 0 {
+		t.Errorf("asked the router for %d routes that were cached, want 0", router.asked)
+	}
+
+	// The lab workspace does not see the public base's cached routes.
+	router.asked = 0
+	if _, err := NewTravelTimeService(database, router).InWorkspace(lab).TravelTimes(context.Background(), base, []Restaurant{ours}); err != nil {
+		t.Fatalf("TravelTimes: %v", err)
+	}
+	if router.asked != len(routing.Modes) {
+		t.Errorf("asked the router for %d routes, want %d", router.asked, len(routing.Modes))
+	}
+}
@@ -12,14 +12,22 @@ type User struct {
 	AvatarURL string
 }
 
+// UserService manages users, who exist across workspaces. Only ListUsers
+// depends on the workspace set with InWorkspace.
 type UserService struct {
-	db *sql.DB
+	db          *sql.DB
+	workspaceID int
 }
 
 func NewUserService(db *sql.DB) *UserService {
 	return &UserService{db: db}
 }
 
+// InWorkspace returns a copy of the service whose ListUsers is limited to the workspace.
+func (s *UserService) InWorkspace(workspaceID int) *UserService {
+	return &UserService{db: s.db, workspaceID: workspaceID}
+}
+
 func (s *UserService) UpsertGitHubUser(githubID, username, avatarURL string) (User, error) {
 	_, err := s.db.Exec(`
         INSERT INTO users (github_id, username, avatar_url)
@@ -51,3 +59,36 @@ func (s *UserService) GetUserByID(id int) (*User, error) {
 	}
 	return &user, nil
 }
+
+// ListUsers returns the members of the workspace and everyone who has added a
+// restaurant or review to it.
+func (s *UserService) ListUsers() ([]User, error) {
+	rows, err := s.db.Query(`
+        SELECT id, github_id, username, COALESCE(avatar_url, '')
+        FROM users u
+        WHERE EXISTS (SELECT 1 FROM workspace_members m WHERE m.user_id = u.id AND m.workspace_id = ?)
+           OR EXISTS (SELECT 1 FROM restaurants r WHERE r.created_by = u.id AND r.workspace_id = ?)
+           OR EXISTS (
+            SELECT 1 FROM reviews v INNER JOIN restaurants r ON r.id = v.restaurant_id
+            WHERE v.user_id = u.id AND r.workspace_id = ?
+           )
+        ORDER BY username ASC
+    `, s.workspaceID, s.workspaceID, s.workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.GitHubID, &user.Username, &user.AvatarURL); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows user: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"example.com/gourmetkan/internal/util"
+)
+
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleMember = "member"
+)
+
+// Workspace separates one group's bases, restaurants, tags and reviews from
+// another's. Public workspaces are readable by everyone and writable by any
+// logged-in user without membership; the default workspace is the shared pool.
+type Workspace struct {
+	ID       int
+	Name     string
+	IsPublic bool
+	// Role is the viewing user's membership role, empty when not a member.
+	Role string
+}
+
+type WorkspaceMember struct {
+	UserID    int
+	Username  string
+	AvatarURL string
+	Role      string
+}
+
+type WorkspaceInvite struct {
+	Token         string
+	WorkspaceID   int
+	WorkspaceName string
+	ExpiresAt     time.Time
+}
+
+type WorkspaceService struct {
+	db *sql.DB
+}
+
+func NewWorkspaceService(db *sql.DB) *WorkspaceService {
+	return &WorkspaceService{db: db}
+}
+
+// ListWorkspaces returns the public workspaces and those the user belongs to.
+// A userID of 0 lists only the public ones.
+func (s *WorkspaceService) ListWorkspaces(userID int) ([]Workspace, error) {
+	rows, err := s.db.Query(`
+        SELECT w.id, w.name, w.is_public, COALESCE(m.role, '')
+        FROM workspaces w
+        LEFT JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = ?
+        WHERE w.is_public = 1 OR m.user_id IS NOT NULL
+        ORDER BY w.is_public DESC, w.id ASC
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []Workspace
+	for rows.Next() {
+		var workspace Workspace
+		if err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.IsPublic, &workspace.Role); err != nil {
+			return nil, fmt.Errorf("scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows workspace: %w", err)
+	}
+	return workspaces, nil
+}
+
+// GetWorkspace returns the workspace if the user may use it, i.e. it is public
+// or the user is a member. Otherwise it returns nil.
+func (s *WorkspaceService) GetWorkspace(id, userID int) (*Workspace, error) {
+	var workspace Workspace
+	err := s.db.QueryRow(`
+        SELECT w.id, w.name, w.is_public, COALESCE(m.role, '')
+        FROM workspaces w
+        LEFT JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = ?
+        WHERE w.id = ? AND (w.is_public = 1 OR m.user_id IS NOT NULL)
+    `, userID, id).Scan(&workspace.ID, &workspace.Name, &workspace.IsPublic, &workspace.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get workspace: %w", err)
+	}
+	return &workspace, nil
+}
+
+// CreateWorkspace creates a private workspace owned by userID. The bases of
+// copyBasesFrom are copied so the new workspace starts with somewhere to
+// measure distances from.
+func (s *WorkspaceService) CreateWorkspace(name string, userID, copyBasesFrom int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO workspaces (name, is_public, created_by) VALUES (?, 0, ?)", name, userID)
+	if err != nil {
+		return 0, fmt.Errorf("create workspace: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("workspace id: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)", id, userID, WorkspaceRoleOwner); err != nil {
+		return 0, fmt.Errorf("add workspace owner: %w", err)
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO bases (name, latitude, longitude, workspace_id)
+        SELECT name, latitude, longitude, ? FROM bases WHERE workspace_id = ? ORDER BY id ASC
+    `, id, copyBasesFrom); err != nil {
+		return 0, fmt.Errorf("copy workspace bases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+	return int(id), nil
+}
+
+func (s *WorkspaceService) ListMembers(workspaceID int) ([]WorkspaceMember, error) {
+	rows, err := s.db.Query(`
+        SELECT u.id, u.username, COALESCE(u.avatar_url, ''), m.role
+        FROM workspace_members m
+        INNER JOIN users u ON u.id = m.user_id
+        WHERE m.workspace_id = ?
+        ORDER BY m.role = 'owner' DESC, u.username ASC
+    `, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []WorkspaceMember
+	for rows.Next() {
+		var member WorkspaceMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.AvatarURL, &member.Role); err != nil {
+			return nil, fmt.Errorf("scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows member: %w", err)
+	}
+	return members, nil
+}
+
+// RemoveMember removes a member. Owners cannot be removed, so a workspace
+// always keeps its owner.
+func (s *WorkspaceService) RemoveMember(workspaceID, userID int) error {
+	result, err := s.db.Exec("DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ? AND role <> ?", workspaceID, userID, WorkspaceRoleOwner)
+	if err != nil {
+		return fmt.Errorf("remove member: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateInvite issues an invite link token that anyone logged in can use to
+// join until it expires.
+func (s *WorkspaceService) CreateInvite(workspaceID, createdBy int, ttl time.Duration) (string, error) {
+	token, err := util.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.Exec("INSERT INTO workspace_invites (token, workspace_id, created_by, expires_at) VALUES (?, ?, ?, ?)", token, workspaceID, createdBy, time.Now().UTC().Add(ttl)); err != nil {
+		return "", fmt.Errorf("create invite: %w", err)
+	}
+	return token, nil
+}
+
+func (s *WorkspaceService) ListInvites(workspaceID int) ([]WorkspaceInvite, error) {
+	rows, err := s.db.Query(`
+        SELECT i.token, i.workspace_id, w.name, i.expires_at
+        FROM workspace_invites i
+        INNER JOIN workspaces w ON w.id = i.workspace_id
+        WHERE i.workspace_id = ? AND i.expires_at > ?
+        ORDER BY i.expires_at DESC
+    `, workspaceID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []WorkspaceInvite
+	for rows.Next() {
+		var invite WorkspaceInvite
+		if err := rows.Scan(&invite.Token, &invite.WorkspaceID, &invite.WorkspaceName, &invite.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows invite: %w", err)
+	}
+	return invites, nil
+}
+
+// GetInvite returns the invite if it exists and has not expired.
+func (s *WorkspaceService) GetInvite(token string) (*WorkspaceInvite, error) {
+	var invite WorkspaceInvite
+	err := s.db.QueryRow(`
+        SELECT i.token, i.workspace_id, w.name, i.expires_at
+        FROM workspace_invites i
+        INNER JOIN workspaces w ON w.id = i.workspace_id
+        WHERE i.token = ? AND i.expires_at > ?
+    `, token, time.Now().UTC()).Scan(&invite.Token, &invite.WorkspaceID, &invite.WorkspaceName, &invite.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// AcceptInvite makes the user a member of the invite's workspace and returns
+// its ID. Accepting twice is harmless.
+func (s *WorkspaceService) AcceptInvite(token string, userID int) (int, error) {
+	invite, err := s.GetInvite(token)
+	if err != nil {
+		return 0, err
+	}
+	if invite == nil {
+		return 0, sql.ErrNoRows
+	}
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)", invite.WorkspaceID, userID, WorkspaceRoleMember); err != nil {
+		return 0, fmt.Errorf("accept invite: %w", err)
+	}
+	return invite.WorkspaceID, nil
+}
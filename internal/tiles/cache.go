@@ -0,0 +1,112 @@
+package tiles
+
+import (
+	"container/list"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCache keeps the tile cache directory under maxBytes by removing the
+// least recently used tiles. The files already in the directory are indexed
+// on first use, oldest first.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+
+	load    sync.Once
+	mu      sync.Mutex
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+	size    int64
+}
+
+type cacheEntry struct {
+	rel  string
+	size int64
+}
+
+func newDiskCache(dir string, maxBytes int64) *diskCache {
+	return &diskCache{dir: dir, maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// touch marks the tile at rel as just used.
+func (c *diskCache) touch(rel string) {
+	c.load.Do(c.index)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[rel]; ok {
+		c.order.MoveToFront(element)
+	}
+}
+
+// add records a tile just written at rel and removes old tiles until the
+// cache fits again.
+func (c *diskCache) add(rel string, size int64) {
+	c.load.Do(c.index)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(rel, size)
+	c.evict()
+}
+
+func (c *diskCache) put(rel string, size int64) {
+	if element, ok := c.entries[rel]; ok {
+		entry := element.Value.(*cacheEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[rel] = c.order.PushFront(&cacheEntry{rel: rel, size: size})
+	c.size += size
+}
+
+func (c *diskCache) evict() {
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		element := c.order.Back()
+		entry := element.Value.(*cacheEntry)
+		c.order.Remove(element)
+		delete(c.entries, entry.rel)
+		c.size -= entry.size
+		// A tile that cannot be removed is forgotten anyway; it is replaced
+		// the next time it is fetched.
+		_ = os.Remove(filepath.Join(c.dir, entry.rel))
+	}
+}
+
+// index reads the tiles a previous run left in the directory.
+func (c *diskCache) index() {
+	type file struct {
+		rel     string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	_ = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".png") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{rel: rel, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.put(f.rel, f.size)
+	}
+	c.evict()
+}
@@ -0,0 +1,98 @@
+package tiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTile(t *testing.T, dir, rel string, size int, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := filepath.Join("15", "1", "1.png")
+	used := filepath.Join("15", "1", "2.png")
+	writeTile(t, dir, old, 40, now.Add(-2*time.Hour))
+	writeTile(t, dir, used, 40, now.Add(-3*time.Hour))
+
+	cache := newDiskCache(dir, 100)
+	// used is the oldest file, but it is read before the new tile arrives.
+	cache.touch(used)
+	fresh := filepath.Join("15", "1", "3.png")
+	writeTile(t, dir, fresh, 40, now)
+	cache.add(fresh, 40)
+
+	if exists(filepath.Join(dir, old)) {
+		t.Errorf("%s was kept, want it evicted", old)
+	}
+	for _, rel := range []string{used, fresh} {
+		if !exists(filepath.Join(dir, rel)) {
+			t.Errorf("%s was evicted, want it kept", rel)
+		}
+	}
+	if cache.size != 80 {
+		t.Errorf("cache size = %d, want 80", cache.size)
+	}
+}
+
+func TestDiskCacheTrimsExistingTilesOnFirstUse(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, rel := range []string{"a.png", "b.png", "c.png"} {
+		writeTile(t, dir, rel, 50, now.Add(time.Duration(i)*time.Minute))
+	}
+	writeTile(t, dir, ".tile-123", 500, now)
+
+	cache := newDiskCache(dir, 100)
+	cache.touch("c.png")
+
+	if exists(filepath.Join(dir, "a.png")) {
+		t.Error("a.png was kept, want the oldest tile evicted")
+	}
+	if !exists(filepath.Join(dir, "b.png")) || !exists(filepath.Join(dir, "c.png")) {
+		t.Error("newer tiles were evicted")
+	}
+	if !exists(filepath.Join(dir, ".tile-123")) {
+		t.Error("a file that is not a tile was removed")
+	}
+}
+
+func TestDiskCacheReplacesSize(t *testing.T) {
+	dir := t.TempDir()
+	cache := newDiskCache(dir, 100)
+	writeTile(t, dir, "a.png", 30, time.Now())
+	cache.add("a.png", 30)
+	cache.add("a.png", 60)
+	if cache.size != 60 || cache.order.Len() != 1 {
+		t.Errorf("cache size = %d with %d entries, want 60 with 1", cache.size, cache.order.Len())
+	}
+}
+
+func TestTileZoomRange(t *testing.T) {
+	source := NewSource(Config{Dir: t.TempDir()})
+	for _, z := range []int{-1, MinZoom - 1, MaxZoom + 1} {
+		if _, err := source.Tile(context.Background(), z, 0, 0); err != ErrNotFound {
+			t.Errorf("Tile(z=%d) error = %v, want ErrNotFound", z, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package tiles serves map tiles from this origin, either from a directory of
+// self-hosted tiles or through a caching proxy of an upstream tile server, so
+// the page never loads images from a third-party host.
+package tiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for coordinates outside the tile pyramid or tiles
+// that the source does not have.
+var ErrNotFound = errors.New("tiles: not found")
+
+// MinZoom and MaxZoom bound the zoom levels that are served. The map page
+// clamps its zoom to the same range, so nothing outside it is ever needed.
+const (
+	MinZoom = 3
+	MaxZoom = 18
+)
+
+type Config struct {
+	// Dir serves pre-rendered tiles laid out as {z}/{x}/{y}.png. When set, no
+	// upstream requests are made.
+	Dir string
+	// UpstreamURL is a template such as "https://tile.openstreetmap.org/{z}/{x}/{y}.png".
+	UpstreamURL string
+	// CacheDir keeps proxied tiles on disk for CacheTTL. Once the tiles there
+	// take more than CacheMaxBytes, the least recently used ones are removed.
+	CacheDir      string
+	CacheTTL      time.Duration
+	CacheMaxBytes int64
+	UserAgent     string
+	Timeout       time.Duration
+}
+
+type Source struct {
+	cfg    Config
+	client *http.Client
+	cache  *diskCache
+}
+
+func NewSource(cfg Config) *Source {
+	if cfg.CacheTTL <= 0 {
+		// The OpenStreetMap tile usage policy asks for at least seven days.
+		cfg.CacheTTL = 7 * 24 * time.Hour
+	}
+	if cfg.CacheMaxBytes <= 0 {
+		cfg.CacheMaxBytes = 256 << 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &Source{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cache:  newDiskCache(cfg.CacheDir, cfg.CacheMaxBytes),
+	}
+}
+
+// Tile returns the PNG for the tile at z/x/y.
+func (s *Source) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	if z < MinZoom || z > MaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, ErrNotFound
+	}
+	rel := filepath.Join(strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y)+".png")
+	if s.cfg.Dir != "" {
+		data, err := os.ReadFile(filepath.Join(s.cfg.Dir, rel))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tile: %w", err)
+		}
+		return data, nil
+	}
+	if s.cfg.UpstreamURL == "" {
+		return nil, ErrNotFound
+	}
+
+	var cachePath string
+	var stale []byte
+	if s.cfg.CacheDir != "" {
+		cachePath = filepath.Join(s.cfg.CacheDir, rel)
+		if info, err := os.Stat(cachePath); err == nil {
+			data, err := os.ReadFile(cachePath)
+			if err == nil && time.Since(info.ModTime()) < s.cfg.CacheTTL {
+				s.cache.touch(rel)
+				return data, nil
+			}
+			stale = data
+		}
+	}
+
+	data, err := s.fetch(ctx, z, x, y)
+	if err != nil {
+		// An outdated tile is better than a hole in the map.
+		if stale != nil {
+			return stale, nil
+		}
+		return nil, err
+	}
+	if cachePath != "" {
+		// A failed cache write only costs another upstream request later.
+		if err := writeFileAtomic(cachePath, data); err == nil {
+			s.cache.add(rel, int64(len(data)))
+		}
+	}
+	return data, nil
+}
+
+func (s *Source) fetch(ctx context.Context, z, x, y int) ([]byte, error) {
+	target := strings.NewReplacer(
+		"{z}", strconv.Itoa(z),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+	).Replace(s.cfg.UpstreamURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	if s.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", s.cfg.UserAgent)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tile upstream failed: %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "image/png") {
+		return nil, fmt.Errorf("tile upstream returned %q", contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read tile: %w", err)
+	}
+	return data, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create tile cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tile-*")
+	if err != nil {
+		return fmt.Errorf("create tile cache file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write tile cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("close tile cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("store tile cache file: %w", err)
+	}
+	return nil
+}
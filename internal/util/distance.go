@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
 const earthRadiusKm = 6371.0
@@ -30,3 +31,42 @@ func FormatDistanceKm(km float64) string {
 	}
 	return fmt.Sprintf("%.1f km", km)
 }
+
+// FormatMinutes renders a travel time rounded up to whole minutes, e.g. "12分" or "1時間5分".
+func FormatMinutes(d time.Duration) string {
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes < 1 {
+		minutes = 1
+	}
+	if minutes < 60 {
+		return fmt.Sprintf("%d分", minutes)
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%d時間", minutes/60)
+	}
+	return fmt.Sprintf("%d時間%d分", minutes/60, minutes%60)
+}
+
+// BoundingBox returns the latitude/longitude rectangle that contains every point
+// within radiusKm of the center. It is meant as a cheap SQL prefilter before the
+// exact Haversine check.
+func BoundingBox(lat, lng, radiusKm float64) (minLat, maxLat, minLng, maxLng float64) {
+	deltaLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	minLat = math.Max(lat-deltaLat, -90)
+	maxLat = math.Min(lat+deltaLat, 90)
+	cosLat := math.Cos(toRadians(lat))
+	if cosLat < 1e-6 || maxLat >= 90 || minLat <= -90 {
+		return minLat, maxLat, -180, 180
+	}
+	deltaLng := deltaLat / cosLat
+	return minLat, maxLat, math.Max(lng-deltaLng, -180), math.Min(lng+deltaLng, 180)
+}
+
+// KmPerDegree returns how many kilometres one degree of latitude and one
+// degree of longitude span around lat. Scaling coordinate differences by them
+// gives an equirectangular distance that SQL can compute without trigonometry
+// and that agrees with HaversineDistanceKm to within metres at city radii.
+func KmPerDegree(lat float64) (kmPerLat, kmPerLng float64) {
+	kmPerLat = earthRadiusKm * math.Pi / 180
+	return kmPerLat, kmPerLat * math.Cos(toRadians(lat))
+}
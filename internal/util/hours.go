@@ -0,0 +1,157 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpeningHours holds the opening times of each weekday as minutes from
+// midnight. A range may end after 24:00 for places open past midnight.
+type OpeningHours struct {
+	days [7][]openRange
+}
+
+type openRange struct {
+	start int
+	end   int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"日": time.Sunday, "月": time.Monday, "火": time.Tuesday, "水": time.Wednesday,
+	"木": time.Thursday, "金": time.Friday, "土": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseOpeningHours reads opening hours written as entries separated by ";"
+// or newlines, e.g. "月-金 11:00-14:00,17:30-22:00; 土・日 11:00-21:00".
+// Each entry is an optional list of weekdays followed by comma-separated
+// time ranges; an entry without weekdays applies to every day. Days that no
+// entry mentions are closed. A closing time before the opening time, or past
+// 24:00 such as "18:00-26:00", runs into the next day.
+func ParseOpeningHours(value string) (OpeningHours, error) {
+	var hours OpeningHours
+	entries := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' })
+	if len(entries) == 0 {
+		return hours, fmt.Errorf("no opening hours")
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		days := allWeekdays()
+		fields := strings.Fields(entry)
+		if first := fields[0][0]; first < '0' || first > '9' {
+			parsed, err := parseWeekdays(fields[0])
+			if err != nil {
+				return hours, err
+			}
+			days, fields = parsed, fields[1:]
+		}
+		timesPart := strings.Join(fields, "")
+		if timesPart == "" {
+			return hours, fmt.Errorf("no times in %q", entry)
+		}
+		for _, part := range strings.Split(timesPart, ",") {
+			open, err := parseOpenRange(part)
+			if err != nil {
+				return hours, err
+			}
+			for _, day := range days {
+				hours.days[day] = append(hours.days[day], open)
+			}
+		}
+	}
+	return hours, nil
+}
+
+// OpenAt reports whether the place is open at t, in t's location.
+func (h OpeningHours) OpenAt(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	for _, open := range h.days[t.Weekday()] {
+		if minute >= open.start && minute < open.end {
+			return true
+		}
+	}
+	previous := (t.Weekday() + 6) % 7
+	for _, open := range h.days[previous] {
+		if minute+24*60 >= open.start && minute+24*60 < open.end {
+			return true
+		}
+	}
+	return false
+}
+
+func allWeekdays() []time.Weekday {
+	return []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+}
+
+// parseWeekdays reads "月-金", "土・日", "sat,sun" and similar.
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '・' || r == '、' }) {
+		first, last, isRange := strings.Cut(item, "-")
+		from, ok := weekdayNames[strings.ToLower(strings.TrimSuffix(first, "曜"))]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[strings.ToLower(strings.TrimSuffix(last, "曜"))]; !ok {
+				return nil, fmt.Errorf("invalid weekday %q", last)
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == to {
+				break
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("no weekdays")
+	}
+	return days, nil
+}
+
+func parseOpenRange(value string) (openRange, error) {
+	first, last, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return openRange{}, fmt.Errorf("invalid time range %q", value)
+	}
+	start, err := parseClock(first)
+	if err != nil {
+		return openRange{}, err
+	}
+	end, err := parseClock(last)
+	if err != nil {
+		return openRange{}, err
+	}
+	if start >= 24*60 {
+		return openRange{}, fmt.Errorf("invalid opening time %q", first)
+	}
+	if end <= start {
+		end += 24 * 60
+	}
+	if end-start > 24*60 {
+		return openRange{}, fmt.Errorf("invalid time range %q", value)
+	}
+	return openRange{start: start, end: end}, nil
+}
+
+// parseClock reads "HH:MM" as minutes; hours up to 48 allow "26:00".
+func parseClock(value string) (int, error) {
+	hourPart, minutePart, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	hour, err1 := strconv.Atoi(hourPart)
+	minute, err2 := strconv.Atoi(minutePart)
+	if err1 != nil || err2 != nil || hour < 0 || hour > 48 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
@@ -1,85 +1,249 @@
 package util
 
 import (
-	"context"
-	"fmt"
-	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
-	"time"
+	"strings"
+)
+
+// MapFormat names the notation a location was extracted from.
+type MapFormat string
+
+const (
+	MapFormatGooglePlace MapFormat = "google_place"
+	MapFormatGeoURI      MapFormat = "geo_uri"
+	MapFormatOSM         MapFormat = "openstreetmap"
+	MapFormatApple       MapFormat = "apple_maps"
+	MapFormatGoogleAt    MapFormat = "google_at"
+	MapFormatQuery       MapFormat = "query"
+	MapFormatPlusCode    MapFormat = "plus_code"
+	MapFormatDMS         MapFormat = "dms"
+	MapFormatDecimal     MapFormat = "decimal"
 )
 
 var (
-	mapsAtPattern    = regexp.MustCompile(`@(-?\d+\.\d+),(-?\d+\.\d+)`)
-	mapsQueryPattern = regexp.MustCompile(`q=(-?\d+\.\d+),(-?\d+\.\d+)`)
+	mapsPlacePattern   = regexp.MustCompile(`!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)`)
+	mapsAtPattern      = regexp.MustCompile(`@(-?\d+\.\d+),(-?\d+\.\d+)`)
+	mapsQueryPattern   = regexp.MustCompile(`(?:^|[?&#;/])(?:q|query|ll|sll|center|destination|daddr|coordinate)=(-?\d+(?:\.\d+)?),\s*(-?\d+(?:\.\d+)?)`)
+	geoURIPattern      = regexp.MustCompile(`(?i)^geo:(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)`)
+	osmMarkerPattern   = regexp.MustCompile(`[?&]mlat=(-?\d+(?:\.\d+)?)&mlon=(-?\d+(?:\.\d+)?)`)
+	osmMapPattern      = regexp.MustCompile(`#map=\d+(?:\.\d+)?/(-?\d+(?:\.\d+)?)/(-?\d+(?:\.\d+)?)`)
+	plusCodePattern    = regexp.MustCompile(`(?i)(?:^|[^0-9A-Z])([23456789CFGHJMPQRVWX]{8}\+[23456789CFGHJMPQRVWX]{2,}|[23456789CFGHJMPQRVWX]{2,6}0{2,6}\+)`)
+	decimalPattern     = regexp.MustCompile(`^\s*\(?\s*(-?\d{1,2}(?:\.\d+)?)\s*[,\s]\s*(-?\d{1,3}(?:\.\d+)?)\s*\)?\s*$`)
+	dmsPattern         = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)\s*°\s*(?:(\d{1,2}(?:\.\d+)?)\s*['′’]\s*)?(?:(\d{1,2}(?:\.\d+)?)\s*(?:"|″|”|'')\s*)?([NSEW])`)
+	dmsPrefixPattern   = regexp.MustCompile(`([NSEW])\s*(\d{1,3}(?:\.\d+)?)\s*°\s*(?:(\d{1,2}(?:\.\d+)?)\s*['′’]\s*)?(?:(\d{1,2}(?:\.\d+)?)\s*(?:"|″|”|''))?`)
+	japaneseDMSPattern = regexp.MustCompile(`(北緯|南緯|東経|西経)\s*(\d{1,3}(?:\.\d+)?)\s*度\s*(?:(\d{1,2}(?:\.\d+)?)\s*分\s*)?(?:(\d{1,2}(?:\.\d+)?)\s*秒)?`)
 )
 
 type MapLocation struct {
 	Latitude  float64
 	Longitude float64
+	Format    MapFormat
 }
 
+// mapExtractor tries to read a location from one notation. raw is the input as
+// given, query is it query-unescaped and path is it path-unescaped (which keeps '+').
+type mapExtractor struct {
+	format  MapFormat
+	extract func(raw, query, path string) (float64, float64, bool)
+}
+
+// mapExtractors are tried in order. Notations that pin the place itself come
+// before ones that only describe the map viewport.
+var mapExtractors = []mapExtractor{
+	{format: MapFormatGooglePlace, extract: func(_, query, _ string) (float64, float64, bool) {
+		return matchPair(mapsPlacePattern, query)
+	}},
+	{format: MapFormatGeoURI, extract: extractGeoURI},
+	{format: MapFormatOSM, extract: func(_, query, _ string) (float64, float64, bool) {
+		if lat, lng, ok := matchPair(osmMarkerPattern, query); ok {
+			return lat, lng, true
+		}
+		return matchPair(osmMapPattern, query)
+	}},
+	{format: MapFormatApple, extract: func(raw, query, _ string) (float64, float64, bool) {
+		if !isAppleMapsURL(raw) {
+			return 0, 0, false
+		}
+		return matchPair(mapsQueryPattern, query)
+	}},
+	{format: MapFormatGoogleAt, extract: func(_, query, _ string) (float64, float64, bool) {
+		return matchPair(mapsAtPattern, query)
+	}},
+	{format: MapFormatQuery, extract: func(_, query, _ string) (float64, float64, bool) {
+		return matchPair(mapsQueryPattern, query)
+	}},
+	{format: MapFormatPlusCode, extract: func(raw, _, path string) (float64, float64, bool) {
+		for _, candidate := range []string{path, raw} {
+			if match := plusCodePattern.FindStringSubmatch(candidate); len(match) == 2 {
+				if lat, lng, ok := DecodePlusCode(match[1]); ok {
+					return lat, lng, true
+				}
+			}
+		}
+		return 0, 0, false
+	}},
+	{format: MapFormatDMS, extract: func(_, query, _ string) (float64, float64, bool) {
+		if lat, lng, ok := extractDMS(query); ok {
+			return lat, lng, true
+		}
+		if lat, lng, ok := extractPrefixDMS(query); ok {
+			return lat, lng, true
+		}
+		return extractJapaneseDMS(query)
+	}},
+	{format: MapFormatDecimal, extract: func(_, query, _ string) (float64, float64, bool) {
+		return matchPair(decimalPattern, query)
+	}},
+}
+
+// ParseMapLocation extracts coordinates from a map URL or coordinate text and
+// reports in Format which notation matched.
 func ParseMapLocation(raw string) (MapLocation, bool) {
+	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return MapLocation{}, false
 	}
-	decoded, err := url.QueryUnescape(raw)
+	query, err := url.QueryUnescape(raw)
 	if err != nil {
-		decoded = raw
+		query = raw
 	}
-
-	if match := mapsAtPattern.FindStringSubmatch(decoded); len(match) == 3 {
-		lat, err1 := strconv.ParseFloat(match[1], 64)
-		lng, err2 := strconv.ParseFloat(match[2], 64)
-		if err1 == nil && err2 == nil {
-			return MapLocation{Latitude: lat, Longitude: lng}, true
-		}
+	path, err := url.PathUnescape(raw)
+	if err != nil {
+		path = raw
 	}
 
-	if match := mapsQueryPattern.FindStringSubmatch(decoded); len(match) == 3 {
-		lat, err1 := strconv.ParseFloat(match[1], 64)
-		lng, err2 := strconv.ParseFloat(match[2], 64)
-		if err1 == nil && err2 == nil {
-			return MapLocation{Latitude: lat, Longitude: lng}, true
+	for _, extractor := range mapExtractors {
+		lat, lng, ok := extractor.extract(raw, query, path)
+		if !ok || !ValidateLatitude(lat) || !ValidateLongitude(lng) {
+			continue
 		}
+		return MapLocation{Latitude: lat, Longitude: lng, Format: extractor.format}, true
 	}
-
 	return MapLocation{}, false
 }
 
-func ExpandShortURL(ctx context.Context, raw string) (string, error) {
-	if raw == "" {
-		return "", fmt.Errorf("empty url")
+func matchPair(pattern *regexp.Regexp, value string) (float64, float64, bool) {
+	match := pattern.FindStringSubmatch(value)
+	if len(match) != 3 {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(match[1], 64)
+	lng, err2 := strconv.ParseFloat(match[2], 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// extractGeoURI handles RFC 5870 geo URIs. Android shares "geo:0,0?q=lat,lng(label)"
+// for pins, so a zero position falls back to the q parameter.
+func extractGeoURI(_, query, _ string) (float64, float64, bool) {
+	lat, lng, ok := matchPair(geoURIPattern, query)
+	if !ok {
+		return 0, 0, false
+	}
+	if lat == 0 && lng == 0 {
+		if qLat, qLng, ok := matchPair(mapsQueryPattern, query); ok {
+			return qLat, qLng, true
+		}
 	}
+	return lat, lng, true
+}
+
+func isAppleMapsURL(raw string) bool {
 	parsed, err := url.Parse(raw)
 	if err != nil {
-		return "", fmt.Errorf("parse url: %w", err)
+		return false
 	}
-	if parsed.Scheme == "" {
-		parsed.Scheme = "https"
+	host := strings.ToLower(parsed.Hostname())
+	return host == "maps.apple.com" || host == "maps.apple"
+}
+
+// extractDMS reads 34°48'39"N 135°33'40"E style text, including decimal minutes.
+func extractDMS(value string) (float64, float64, bool) {
+	matches := dmsPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) < 2 {
+		return 0, 0, false
 	}
+	return combineHemispheres(
+		dmsComponent{hemisphere: matches[0][4], degrees: matches[0][1], minutes: matches[0][2], seconds: matches[0][3]},
+		dmsComponent{hemisphere: matches[1][4], degrees: matches[1][1], minutes: matches[1][2], seconds: matches[1][3]},
+	)
+}
 
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 3 {
-				return http.ErrUseLastResponse
-			}
-			return nil
-		},
+// extractPrefixDMS reads N 34°48.65' E 135°33.67' style text.
+func extractPrefixDMS(value string) (float64, float64, bool) {
+	matches := dmsPrefixPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) < 2 {
+		return 0, 0, false
 	}
+	return combineHemispheres(
+		dmsComponent{hemisphere: matches[0][1], degrees: matches[0][2], minutes: matches[0][3], seconds: matches[0][4]},
+		dmsComponent{hemisphere: matches[1][1], degrees: matches[1][2], minutes: matches[1][3], seconds: matches[1][4]},
+	)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, parsed.String(), nil)
-	if err != nil {
-		return "", fmt.Errorf("new request: %w", err)
+// extractJapaneseDMS reads 北緯34度48分39秒 東経135度33分40秒 style text.
+func extractJapaneseDMS(value string) (float64, float64, bool) {
+	matches := japaneseDMSPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) < 2 {
+		return 0, 0, false
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request: %w", err)
+	hemispheres := map[string]string{"北緯": "N", "南緯": "S", "東経": "E", "西経": "W"}
+	return combineHemispheres(
+		dmsComponent{hemisphere: hemispheres[matches[0][1]], degrees: matches[0][2], minutes: matches[0][3], seconds: matches[0][4]},
+		dmsComponent{hemisphere: hemispheres[matches[1][1]], degrees: matches[1][2], minutes: matches[1][3], seconds: matches[1][4]},
+	)
+}
+
+type dmsComponent struct {
+	hemisphere string
+	degrees    string
+	minutes    string
+	seconds    string
+}
+
+// combineHemispheres turns one latitude and one longitude component, in either
+// order, into signed decimal degrees.
+func combineHemispheres(components ...dmsComponent) (float64, float64, bool) {
+	var lat, lng float64
+	var latSet, lngSet bool
+	for _, component := range components {
+		degrees, ok := dmsToDegrees(component.degrees, component.minutes, component.seconds)
+		if !ok {
+			return 0, 0, false
+		}
+		switch component.hemisphere {
+		case "N":
+			lat, latSet = degrees, true
+		case "S":
+			lat, latSet = -degrees, true
+		case "E":
+			lng, lngSet = degrees, true
+		case "W":
+			lng, lngSet = -degrees, true
+		}
 	}
-	defer resp.Body.Close()
+	return lat, lng, latSet && lngSet
+}
 
-	finalURL := resp.Request.URL.String()
-	return finalURL, nil
+func dmsToDegrees(degreesText, minutesText, secondsText string) (float64, bool) {
+	degrees, err := strconv.ParseFloat(degreesText, 64)
+	if err != nil {
+		return 0, false
+	}
+	var minutes, seconds float64
+	if minutesText != "" {
+		if minutes, err = strconv.ParseFloat(minutesText, 64); err != nil || minutes >= 60 {
+			return 0, false
+		}
+	}
+	if secondsText != "" {
+		if seconds, err = strconv.ParseFloat(secondsText, 64); err != nil || seconds >= 60 {
+			return 0, false
+		}
+	}
+	return degrees + minutes/60 + seconds/3600, true
 }
@@ -0,0 +1,134 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+var parseMapLocationTests = []struct {
+	name   string
+	raw    string
+	ok     bool
+	lat    float64
+	lng    float64
+	format MapFormat
+}{
+	{"google full place link prefers the pin over the viewport",
+		"https://www.google.com/maps/place/Ramen/@34.8110,135.5620,17z/data=!3m1!4b1!4m6!3m5!1s0x0:0x0!8m2!3d34.8115!4d135.5625",
+		true, 34.8115, 135.5625, MapFormatGooglePlace},
+	{"google viewport link", "https://www.google.com/maps/@34.8110,135.5620,17z", true, 34.8110, 135.5620, MapFormatGoogleAt},
+	{"google short link needs expanding first", "https://maps.app.goo.gl/AbCdEf123", false, 0, 0, ""},
+	{"google goo.gl short link needs expanding first", "https://goo.gl/maps/AbCdEf123", false, 0, 0, ""},
+	{"google q query", "https://maps.google.com/?q=34.8110,135.5620", true, 34.8110, 135.5620, MapFormatQuery},
+	{"google search api query with escaped comma", "https://www.google.com/maps/search/?api=1&query=34.8110%2C135.5620", true, 34.8110, 135.5620, MapFormatQuery},
+	{"google ll query", "https://maps.google.com/maps?ll=34.8110,135.5620&z=16", true, 34.8110, 135.5620, MapFormatQuery},
+	{"google center query", "https://www.google.com/maps/@?api=1&map_action=map&center=-33.8688,151.2093", true, -33.8688, 151.2093, MapFormatQuery},
+	{"google directions destination", "https://www.google.com/maps/dir/?api=1&destination=34.8110,135.5620", true, 34.8110, 135.5620, MapFormatQuery},
+	{"apple maps ll", "https://maps.apple.com/?ll=34.8110,135.5620&q=Ramen", true, 34.8110, 135.5620, MapFormatApple},
+	{"apple maps coordinate", "https://maps.apple.com/?address=Osaka&coordinate=34.8110,135.5620", true, 34.8110, 135.5620, MapFormatApple},
+	{"apple maps without coordinates", "https://maps.apple.com/?q=Ramen", false, 0, 0, ""},
+	{"geo uri", "geo:34.8110,135.5620", true, 34.8110, 135.5620, MapFormatGeoURI},
+	{"geo uri with parameters", "geo:34.8110,135.5620?z=17", true, 34.8110, 135.5620, MapFormatGeoURI},
+	{"geo uri upper case", "GEO:-12.5,-45.25", true, -12.5, -45.25, MapFormatGeoURI},
+	{"android geo pin", "geo:0,0?q=34.8110,135.5620(Ramen)", true, 34.8110, 135.5620, MapFormatGeoURI},
+	{"geo uri out of range", "geo:95,10", false, 0, 0, ""},
+	{"openstreetmap marker", "https://www.openstreetmap.org/?mlat=34.8110&mlon=135.5620#map=17/34.8000/135.5000", true, 34.8110, 135.5620, MapFormatOSM},
+	{"openstreetmap viewport", "https://www.openstreetmap.org/#map=17/34.8110/135.5620", true, 34.8110, 135.5620, MapFormatOSM},
+	{"full plus code", "8Q6QR2CW+4V", true, 34.8203125, 135.0471875, MapFormatPlusCode},
+	{"full plus code lower case", "8q6qr2cw+4v", true, 34.8203125, 135.0471875, MapFormatPlusCode},
+	{"full plus code link", "https://plus.codes/8Q6QR2CW+4V", true, 34.8203125, 135.0471875, MapFormatPlusCode},
+	{"full plus code in escaped google link", "https://www.google.com/maps/place/8Q6QR2CW%2B4V", true, 34.8203125, 135.0471875, MapFormatPlusCode},
+	{"padded plus code", "8Q6Q0000+", true, 34.5, 135.5, MapFormatPlusCode},
+	{"short plus code with locality needs a reference", "R2CW+4V 茨木市", false, 0, 0, ""},
+	{"short plus code", "R2CW+4V", false, 0, 0, ""},
+	{"dms", `34°48'39"N 135°33'40"E`, true, 34.810833, 135.561111, MapFormatDMS},
+	{"dms southern and western", `33°52'7.7"S 151°12'33.5"W`, true, -33.868806, -151.209306, MapFormatDMS},
+	{"dms hemisphere prefix with decimal minutes", "N 34°48.65' E 135°33.67'", true, 34.810833, 135.561167, MapFormatDMS},
+	{"japanese dms", "北緯34度48分39秒 東経135度33分40秒", true, 34.810833, 135.561111, MapFormatDMS},
+	{"dms minutes out of range", `34°61'0"N 135°33'40"E`, false, 0, 0, ""},
+	{"decimal pair", "34.8110, 135.5620", true, 34.8110, 135.5620, MapFormatDecimal},
+	{"decimal pair in parentheses", "(34.8110 135.5620)", true, 34.8110, 135.5620, MapFormatDecimal},
+	{"decimal latitude out of range", "91.0, 135.0", false, 0, 0, ""},
+	{"empty", "", false, 0, 0, ""},
+	{"blank", "   ", false, 0, 0, ""},
+	{"plain text", "ramen near the station", false, 0, 0, ""},
+}
+
+func TestParseMapLocation(t *testing.T) {
+	for _, tt := range parseMapLocationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseMapLocation(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("ParseMapLocation(%q) ok = %v, want %v (got %+v)", tt.raw, ok, tt.ok, got)
+			}
+			if !ok {
+				return
+			}
+			if math.Abs(got.Latitude-tt.lat) > 1e-6 || math.Abs(got.Longitude-tt.lng) > 1e-6 {
+				t.Errorf("ParseMapLocation(%q) = %f,%f, want %f,%f", tt.raw, got.Latitude, got.Longitude, tt.lat, tt.lng)
+			}
+			if got.Format != tt.format {
+				t.Errorf("ParseMapLocation(%q) format = %s, want %s", tt.raw, got.Format, tt.format)
+			}
+		})
+	}
+}
+
+func TestDecodePlusCode(t *testing.T) {
+	tests := []struct {
+		code string
+		ok   bool
+		lat  float64
+		lng  float64
+	}{
+		{"8Q6QR2CW+4V", true, 34.8203125, 135.0471875},
+		{"8Q6QR2CW+", true, 34.82125, 135.04625},
+		{"8Q6Q0000+", true, 34.5, 135.5},
+		{"8Q000000+", true, 40, 130},
+		{"R2CW+4V", false, 0, 0},
+		{"8Q6QR2C+4V", false, 0, 0},
+		{"8Q6QR2CW4V", false, 0, 0},
+		{"8Q6QR2CW+4V+", false, 0, 0},
+		{"8Q6Q0R00+", false, 0, 0},
+		{"8Q6Q000+", false, 0, 0},
+		{"8Q6Q0000+4V", false, 0, 0},
+		{"XQ6QR2CW+4V", false, 0, 0},
+		{"8Y6QR2CW+4V", false, 0, 0},
+		{"8A6QR2CW+4V", false, 0, 0},
+		{"", false, 0, 0},
+	}
+	for _, tt := range tests {
+		lat, lng, ok := DecodePlusCode(tt.code)
+		if ok != tt.ok {
+			t.Errorf("DecodePlusCode(%q) ok = %v, want %v", tt.code, ok, tt.ok)
+			continue
+		}
+		if ok && (math.Abs(lat-tt.lat) > 1e-9 || math.Abs(lng-tt.lng) > 1e-9) {
+			t.Errorf("DecodePlusCode(%q) = %f,%f, want %f,%f", tt.code, lat, lng, tt.lat, tt.lng)
+		}
+	}
+}
+
+func FuzzParseMapLocation(f *testing.F) {
+	for _, tt := range parseMapLocationTests {
+		f.Add(tt.raw)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		got, ok := ParseMapLocation(raw)
+		if !ok {
+			if got != (MapLocation{}) {
+				t.Errorf("ParseMapLocation(%q) = %+v with ok false", raw, got)
+			}
+			return
+		}
+		if math.IsNaN(got.Latitude) || got.Latitude < -90 || got.Latitude > 90 {
+			t.Errorf("ParseMapLocation(%q) latitude %f out of range", raw, got.Latitude)
+		}
+		if math.IsNaN(got.Longitude) || got.Longitude < -180 || got.Longitude > 180 {
+			t.Errorf("ParseMapLocation(%q) longitude %f out of range", raw, got.Longitude)
+		}
+		if got.Format == "" {
+			t.Errorf("ParseMapLocation(%q) matched without a format", raw)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// NavigationMode is a travel mode for a directions link.
+type NavigationMode string
+
+const (
+	NavigationWalking NavigationMode = "walking"
+	NavigationTransit NavigationMode = "transit"
+	NavigationDriving NavigationMode = "driving"
+)
+
+// NavigationApp is a map application that can open directions.
+type NavigationApp string
+
+const (
+	NavigationGoogle NavigationApp = "google"
+	NavigationApple  NavigationApp = "apple"
+	NavigationOSM    NavigationApp = "openstreetmap"
+)
+
+// NavigationModes and NavigationApps fix the order links are generated in.
+var (
+	NavigationModes = []NavigationMode{NavigationWalking, NavigationTransit, NavigationDriving}
+	NavigationApps  = []NavigationApp{NavigationGoogle, NavigationApple, NavigationOSM}
+)
+
+type NavigationLink struct {
+	App  NavigationApp  `json:"app"`
+	Mode NavigationMode `json:"mode"`
+	URL  string         `json:"url"`
+}
+
+// NavigationURL returns a directions URL from one point to another, or false
+// when the app has no such mode (OpenStreetMap has no public transit routing).
+func NavigationURL(app NavigationApp, mode NavigationMode, fromLat, fromLng, toLat, toLng float64) (string, bool) {
+	from := formatCoordinate(fromLat) + "," + formatCoordinate(fromLng)
+	to := formatCoordinate(toLat) + "," + formatCoordinate(toLng)
+	switch app {
+	case NavigationGoogle:
+		travelModes := map[NavigationMode]string{NavigationWalking: "walking", NavigationTransit: "transit", NavigationDriving: "driving"}
+		travelMode, ok := travelModes[mode]
+		if !ok {
+			return "", false
+		}
+		values := url.Values{}
+		values.Set("api", "1")
+		values.Set("origin", from)
+		values.Set("destination", to)
+		values.Set("travelmode", travelMode)
+		return "https://www.google.com/maps/dir/?" + values.Encode(), true
+	case NavigationApple:
+		dirFlags := map[NavigationMode]string{NavigationWalking: "w", NavigationTransit: "r", NavigationDriving: "d"}
+		dirFlag, ok := dirFlags[mode]
+		if !ok {
+			return "", false
+		}
+		values := url.Values{}
+		values.Set("saddr", from)
+		values.Set("daddr", to)
+		values.Set("dirflg", dirFlag)
+		return "https://maps.apple.com/?" + values.Encode(), true
+	case NavigationOSM:
+		engines := map[NavigationMode]string{NavigationWalking: "fossgis_osrm_foot", NavigationDriving: "fossgis_osrm_car"}
+		engine, ok := engines[mode]
+		if !ok {
+			return "", false
+		}
+		values := url.Values{}
+		values.Set("engine", engine)
+		values.Set("route", from+";"+to)
+		return "https://www.openstreetmap.org/directions?" + values.Encode(), true
+	}
+	return "", false
+}
+
+// NavigationLinks returns every supported app and mode combination, grouped by app.
+func NavigationLinks(fromLat, fromLng, toLat, toLng float64) []NavigationLink {
+	links := make([]NavigationLink, 0, len(NavigationApps)*len(NavigationModes))
+	for _, app := range NavigationApps {
+		for _, mode := range NavigationModes {
+			if link, ok := NavigationURL(app, mode, fromLat, fromLng, toLat, toLng); ok {
+				links = append(links, NavigationLink{App: app, Mode: mode, URL: link})
+			}
+		}
+	}
+	return links
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', 6, 64)
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNavigationURL(t *testing.T) {
+	const fromLat, fromLng, toLat, toLng = 34.811, 135.562, 34.8203125, 135.5
+	tests := []struct {
+		app    NavigationApp
+		mode   NavigationMode
+		ok     bool
+		prefix string
+		query  map[string]string
+	}{
+		{NavigationGoogle, NavigationWalking, true, "https://www.google.com/maps/dir/?",
+			map[string]string{"api": "1", "origin": "34.811000,135.562000", "destination": "34.820312,135.500000", "travelmode": "walking"}},
+		{NavigationGoogle, NavigationTransit, true, "https://www.google.com/maps/dir/?", map[string]string{"travelmode": "transit"}},
+		{NavigationGoogle, NavigationDriving, true, "https://www.google.com/maps/dir/?", map[string]string{"travelmode": "driving"}},
+		{NavigationApple, NavigationWalking, true, "https://maps.apple.com/?",
+			map[string]string{"saddr": "34.811000,135.562000", "daddr": "34.820312,135.500000", "dirflg": "w"}},
+		{NavigationApple, NavigationTransit, true, "https://maps.apple.com/?", map[string]string{"dirflg": "r"}},
+		{NavigationApple, NavigationDriving, true, "https://maps.apple.com/?", map[string]string{"dirflg": "d"}},
+		{NavigationOSM, NavigationWalking, true, "https://www.openstreetmap.org/directions?",
+			map[string]string{"engine": "fossgis_osrm_foot", "route": "34.811000,135.562000;34.820312,135.500000"}},
+		{NavigationOSM, NavigationDriving, true, "https://www.openstreetmap.org/directions?", map[string]string{"engine": "fossgis_osrm_car"}},
+		{NavigationOSM, NavigationTransit, false, "", nil},
+		{NavigationGoogle, "flying", false, "", nil},
+		{"bing", NavigationWalking, false, "", nil},
+	}
+	for _, tt := range tests {
+		got, ok := NavigationURL(tt.app, tt.mode, fromLat, fromLng, toLat, toLng)
+		if ok != tt.ok {
+			t.Errorf("NavigationURL(%s, %s) ok = %v, want %v", tt.app, tt.mode, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			if got != "" {
+				t.Errorf("NavigationURL(%s, %s) = %q with ok false", tt.app, tt.mode, got)
+			}
+			continue
+		}
+		if len(got) < len(tt.prefix) || got[:len(tt.prefix)] != tt.prefix {
+			t.Errorf("NavigationURL(%s, %s) = %q, want prefix %q", tt.app, tt.mode, got, tt.prefix)
+			continue
+		}
+		values, err := url.ParseQuery(got[len(tt.prefix):])
+		if err != nil {
+			t.Errorf("NavigationURL(%s, %s) = %q: %v", tt.app, tt.mode, got, err)
+			continue
+		}
+		for key, want := range tt.query {
+			if values.Get(key) != want {
+				t.Errorf("NavigationURL(%s, %s) %s = %q, want %q", tt.app, tt.mode, key, values.Get(key), want)
+			}
+		}
+	}
+}
+
+func TestNavigationLinks(t *testing.T) {
+	links := NavigationLinks(34.811, 135.562, 34.82, 135.5)
+	want := []struct {
+		app  NavigationApp
+		mode NavigationMode
+	}{
+		{NavigationGoogle, NavigationWalking},
+		{NavigationGoogle, NavigationTransit},
+		{NavigationGoogle, NavigationDriving},
+		{NavigationApple, NavigationWalking},
+		{NavigationApple, NavigationTransit},
+		{NavigationApple, NavigationDriving},
+		{NavigationOSM, NavigationWalking},
+		{NavigationOSM, NavigationDriving},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("NavigationLinks returned %d links, want %d: %+v", len(links), len(want), links)
+	}
+	for i, link := range links {
+		if link.App != want[i].app || link.Mode != want[i].mode {
+			t.Errorf("link %d = %s %s, want %s %s", i, link.App, link.Mode, want[i].app, want[i].mode)
+		}
+		if expected, _ := NavigationURL(link.App, link.Mode, 34.811, 135.562, 34.82, 135.5); link.URL != expected {
+			t.Errorf("link %d URL = %q, want %q", i, link.URL, expected)
+		}
+	}
+}
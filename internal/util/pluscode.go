@@ -0,0 +1,67 @@
+package util
+
+import "strings"
+
+// Open Location Code (Plus Code) constants, see
+// https://github.com/google/open-location-code/blob/main/docs/specification.md
+const (
+	plusCodeAlphabet   = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator  = '+'
+	plusCodePadding    = '0'
+	plusCodeSepPos     = 8
+	plusCodePairDigits = 10
+	plusCodeGridRows   = 5
+	plusCodeGridCols   = 4
+)
+
+// DecodePlusCode returns the center of a full Plus Code such as "8Q6QR2CW+4V".
+// Short codes ("R2CW+4V 茨木市") need a reference location and are rejected.
+func DecodePlusCode(code string) (float64, float64, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	sep := strings.IndexRune(code, plusCodeSeparator)
+	if sep != plusCodeSepPos || strings.Count(code, string(plusCodeSeparator)) != 1 {
+		return 0, 0, false
+	}
+	digits := code[:sep] + code[sep+1:]
+	if pad := strings.IndexRune(digits, plusCodePadding); pad >= 0 {
+		// Padding must be a trailing, even-length run ending at the separator.
+		if pad%2 != 0 || pad == 0 || len(code) != sep+1 || strings.Trim(digits[pad:], "0") != "" {
+			return 0, 0, false
+		}
+		digits = digits[:pad]
+	}
+	if len(digits) == plusCodeSepPos+1 {
+		return 0, 0, false
+	}
+
+	values := make([]int, 0, len(digits))
+	for _, r := range digits {
+		index := strings.IndexRune(plusCodeAlphabet, r)
+		if index < 0 {
+			return 0, 0, false
+		}
+		values = append(values, index)
+	}
+	// The first latitude digit only goes up to 180/20 and the first longitude digit to 360/20.
+	if values[0] > 8 || (len(values) > 1 && values[1] > 17) {
+		return 0, 0, false
+	}
+
+	lat, lng := -90.0, -180.0
+	latRes, lngRes := 400.0, 400.0
+	for i := 0; i < len(values) && i < plusCodePairDigits; i += 2 {
+		latRes /= 20
+		lngRes /= 20
+		lat += float64(values[i]) * latRes
+		if i+1 < len(values) {
+			lng += float64(values[i+1]) * lngRes
+		}
+	}
+	for i := plusCodePairDigits; i < len(values); i++ {
+		latRes /= plusCodeGridRows
+		lngRes /= plusCodeGridCols
+		lat += float64(values[i]/plusCodeGridCols) * latRes
+		lng += float64(values[i]%plusCodeGridCols) * lngRes
+	}
+	return lat + latRes/2, lng + lngRes/2, true
+}
@@ -0,0 +1,272 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrURLNotAllowed     = errors.New("url is not in the allowlist")
+	ErrAddressNotAllowed = errors.New("address is not publicly routable")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+)
+
+// DefaultMapsURLAllowlist lists the hosts (optionally with a required path prefix)
+// that map links may be expanded through. Subdomains of a host match too.
+var DefaultMapsURLAllowlist = []string{
+	"maps.app.goo.gl",
+	"goo.gl/maps",
+	"g.co/kgs",
+	"maps.google.com",
+	"google.com/maps",
+	"google.co.jp/maps",
+}
+
+// blockedNetworks are ranges that are not covered by the net.IP helpers but must
+// never be reached from the server either.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+)
+
+// SafeFetcher performs outbound requests to user-supplied URLs. Every hop must
+// match the allowlist and every connection is dialed to an address that has been
+// checked to be public, so DNS rebinding cannot redirect it into the local network.
+type SafeFetcher struct {
+	allowlist    []allowEntry
+	client       *http.Client
+	maxRedirects int
+	// lookupIPAddr and dial default to the system resolver and a net.Dialer;
+	// tests replace them to fake DNS answers and reach a local server.
+	lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dial         func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type allowEntry struct {
+	host       string
+	pathPrefix string
+}
+
+func NewSafeFetcher(allowlist []string, timeout time.Duration) *SafeFetcher {
+	entries := make([]allowEntry, 0, len(allowlist))
+	for _, raw := range allowlist {
+		raw = strings.ToLower(strings.TrimSpace(raw))
+		if raw == "" {
+			continue
+		}
+		host, path, _ := strings.Cut(raw, "/")
+		entry := allowEntry{host: strings.TrimPrefix(host, "www.")}
+		if path != "" {
+			entry.pathPrefix = "/" + path
+		}
+		entries = append(entries, entry)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	f := &SafeFetcher{
+		allowlist:    entries,
+		maxRedirects: 5,
+		lookupIPAddr: net.DefaultResolver.LookupIPAddr,
+		dial:         dialer.DialContext,
+	}
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			ip, err := f.resolvePublicIP(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			return f.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          4,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	f.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return f
+}
+
+// WithDefaultScheme prefixes https:// to a link pasted without a scheme, such
+// as "maps.app.goo.gl/xyz", so it can be checked against the allowlist.
+func WithDefaultScheme(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.Contains(raw, "://") {
+		return raw
+	}
+	return "https://" + raw
+}
+
+// Allowed reports whether raw is an http(s) URL on an allowlisted host and path.
+func (f *SafeFetcher) Allowed(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return f.allowedURL(parsed)
+}
+
+func (f *SafeFetcher) allowedURL(u *url.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	if u.User != nil {
+		return false
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, entry := range f.allowlist {
+		if host != entry.host && !strings.HasSuffix(host, "."+entry.host) {
+			continue
+		}
+		if entry.pathPrefix == "" || u.Path == entry.pathPrefix || strings.HasPrefix(u.Path, entry.pathPrefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandURL follows redirects of a short link and returns the final URL.
+// Each hop is checked against the allowlist before it is requested.
+func (f *SafeFetcher) ExpandURL(ctx context.Context, raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("empty url")
+	}
+	current, err := url.Parse(WithDefaultScheme(raw))
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+
+	for hop := 0; hop <= f.maxRedirects; hop++ {
+		if !f.allowedURL(current) {
+			return "", fmt.Errorf("%w: %s", ErrURLNotAllowed, current.Host)
+		}
+		location, err := f.nextLocation(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if location == nil {
+			return current.String(), nil
+		}
+		current = current.ResolveReference(location)
+	}
+	return "", ErrTooManyRedirects
+}
+
+// nextLocation requests target once and returns its redirect location, or nil
+// when the response is not a redirect.
+func (f *SafeFetcher) nextLocation(ctx context.Context, target *url.URL) (*url.URL, error) {
+	resp, err := f.do(ctx, http.MethodHead, target)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		resp, err = f.do(ctx, http.MethodGet, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("parse location: %w", err)
+	}
+	return parsed, nil
+}
+
+func (f *SafeFetcher) do(ctx context.Context, method string, target *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	// Only the status line and headers matter; the body is never read.
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (f *SafeFetcher) resolvePublicIP(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return nil, fmt.Errorf("%w: %s", ErrAddressNotAllowed, ip)
+		}
+		return ip, nil
+	}
+	addrs, err := f.lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("resolve %s: no addresses", host)
+	}
+	// Refuse the host if any of its addresses is internal rather than picking a
+	// public one, so a split answer cannot be used to probe the network.
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrAddressNotAllowed, host, addr.IP)
+		}
+	}
+	return addrs[0].IP, nil
+}
+
+// IsPublicIP reports whether ip is a globally routable unicast address.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -77,8 +77,511 @@
     });
   }
 
+  function bindPhotoArrange() {
+    const lists = document.querySelectorAll('.js-photo-arrange');
+    lists.forEach((list) => {
+      let dragging = null;
+
+      list.addEventListener('dragstart', (event) => {
+        const item = event.target.closest('.photo-arrange-item');
+        if (!item) {
+          return;
+        }
+        dragging = item;
+        item.classList.add('is-dragging');
+        event.dataTransfer.effectAllowed = 'move';
+      });
+
+      list.addEventListener('dragend', () => {
+        if (dragging) {
+          dragging.classList.remove('is-dragging');
+        }
+        dragging = null;
+      });
+
+      list.addEventListener('dragover', (event) => {
+        if (!dragging) {
+          return;
+        }
+        event.preventDefault();
+        const target = event.target.closest('.photo-arrange-item');
+        if (!target || target === dragging) {
+          return;
+        }
+        const rect = target.getBoundingClientRect();
+        const after = event.clientX > rect.left + rect.width / 2;
+        list.insertBefore(dragging, after ? target.nextSibling : target);
+      });
+    });
+  }
+
+  const TILE_SIZE = 256;
+  // Markers closer than CLUSTER_CELL pixels are merged up to this zoom level.
+  const CLUSTER_MAX_ZOOM = 15;
+  const CLUSTER_CELL = 60;
+
+  // Web Mercator: lat/lng to world pixel coordinates at the given zoom.
+  function project(lat, lng, zoom) {
+    const scale = TILE_SIZE * 2 ** zoom;
+    const sin = Math.min(Math.max(Math.sin((lat * Math.PI) / 180), -0.9999), 0.9999);
+    return {
+      x: ((lng + 180) / 360) * scale,
+      y: (0.5 - Math.log((1 + sin) / (1 - sin)) / (4 * Math.PI)) * scale,
+    };
+  }
+
+  function unproject(x, y, zoom) {
+    const scale = TILE_SIZE * 2 ** zoom;
+    const n = Math.PI - (2 * Math.PI * y) / scale;
+    return {
+      lat: (180 / Math.PI) * Math.atan(Math.sinh(n)),
+      lng: (x / scale) * 360 - 180,
+    };
+  }
+
+  function bindMap() {
+    const el = document.querySelector('.js-map');
+    if (!el) {
+      return;
+    }
+    const tileLayer = document.createElement('div');
+    tileLayer.className = 'map-tiles';
+    const markerLayer = document.createElement('div');
+    markerLayer.className = 'map-markers';
+    const popup = document.createElement('div');
+    popup.className = 'map-popup';
+    popup.hidden = true;
+    el.prepend(tileLayer, markerLayer);
+    el.appendChild(popup);
+
+    const base = { lat: parseFloat(el.dataset.lat), lng: parseFloat(el.dataset.lng) };
+    // The tile server only serves this range of zoom levels.
+    const minZoom = parseInt(el.dataset.minZoom, 10);
+    const maxZoom = parseInt(el.dataset.maxZoom, 10);
+    let zoom = 15;
+    let center = project(base.lat, base.lng, zoom);
+    let features = [];
+    let popupFeature = null;
+    const tiles = new Map();
+
+    const origin = () => ({ x: center.x - el.clientWidth / 2, y: center.y - el.clientHeight / 2 });
+
+    function renderTiles() {
+      const o = origin();
+      const count = 2 ** zoom;
+      const minX = Math.floor(o.x / TILE_SIZE);
+      const maxX = Math.floor((o.x + el.clientWidth) / TILE_SIZE);
+      const minY = Math.max(0, Math.floor(o.y / TILE_SIZE));
+      const maxY = Math.min(count - 1, Math.floor((o.y + el.clientHeight) / TILE_SIZE));
+      const wanted = new Set();
+      for (let ty = minY; ty <= maxY; ty += 1) {
+        for (let tx = minX; tx <= maxX; tx += 1) {
+          const key = `${zoom}/${tx}/${ty}`;
+          wanted.add(key);
+          let img = tiles.get(key);
+          if (!img) {
+            img = document.createElement('img');
+            img.className = 'map-tile';
+            img.alt = '';
+            img.draggable = false;
+            img.src = el.dataset.tiles
+              .replace('{z}', String(zoom))
+              .replace('{x}', String(((tx % count) + count) % count))
+              .replace('{y}', String(ty));
+            tiles.set(key, img);
+            tileLayer.appendChild(img);
+          }
+          img.style.transform = `translate(${tx * TILE_SIZE - o.x}px, ${ty * TILE_SIZE - o.y}px)`;
+        }
+      }
+      tiles.forEach((img, key) => {
+        if (!wanted.has(key)) {
+          img.remove();
+          tiles.delete(key);
+        }
+      });
+    }
+
+    function placeAt(node, x, y) {
+      node.style.transform = `translate(${x}px, ${y}px) translate(-50%, -50%)`;
+    }
+
+    function renderMarkers() {
+      markerLayer.textContent = '';
+      const o = origin();
+      const groups = new Map();
+      features.forEach((feature) => {
+        const [lng, lat] = feature.geometry.coordinates;
+        const p = project(lat, lng, zoom);
+        const x = p.x - o.x;
+        const y = p.y - o.y;
+        if (x < -CLUSTER_CELL || y < -CLUSTER_CELL || x > el.clientWidth + CLUSTER_CELL || y > el.clientHeight + CLUSTER_CELL) {
+          return;
+        }
+        // Cells are keyed in world pixels so clusters do not change while panning.
+        const key = zoom <= CLUSTER_MAX_ZOOM
+          ? `${Math.floor(p.x / CLUSTER_CELL)}:${Math.floor(p.y / CLUSTER_CELL)}`
+          : String(feature.properties.id);
+        if (!groups.has(key)) {
+          groups.set(key, []);
+        }
+        groups.get(key).push({ feature, x, y });
+      });
+
+      groups.forEach((group) => {
+        const x = group.reduce((sum, p) => sum + p.x, 0) / group.length;
+        const y = group.reduce((sum, p) => sum + p.y, 0) / group.length;
+        const marker = document.createElement('button');
+        marker.type = 'button';
+        if (group.length === 1) {
+          marker.className = 'map-marker';
+          marker.setAttribute('aria-label', group[0].feature.properties.name);
+          marker.addEventListener('click', () => showPopup(group[0].feature));
+        } else {
+          marker.className = 'map-cluster';
+          marker.textContent = String(group.length);
+          marker.setAttribute('aria-label', `${group.length}件の店舗`);
+          marker.addEventListener('click', () => zoomAt(x, y, zoom + 2));
+        }
+        placeAt(marker, x, y);
+        markerLayer.appendChild(marker);
+      });
+
+      const b = project(base.lat, base.lng, zoom);
+      const baseMarker = document.createElement('div');
+      baseMarker.className = 'map-base-marker';
+      baseMarker.title = el.dataset.baseName || '';
+      placeAt(baseMarker, b.x - o.x, b.y - o.y);
+      markerLayer.appendChild(baseMarker);
+    }
+
+    function positionPopup() {
+      if (!popupFeature) {
+        return;
+      }
+      const [lng, lat] = popupFeature.geometry.coordinates;
+      const p = project(lat, lng, zoom);
+      const o = origin();
+      popup.style.transform = `translate(${p.x - o.x}px, ${p.y - o.y}px) translate(-50%, calc(-100% - 14px))`;
+    }
+
+    function showPopup(feature) {
+      popupFeature = feature;
+      popup.textContent = '';
+      const link = document.createElement('a');
+      link.href = feature.properties.url;
+      link.textContent = feature.properties.name;
+      const meta = document.createElement('div');
+      meta.className = 'muted';
+      meta.textContent = [feature.properties.distance, ...(feature.properties.tags || []).map((tag) => `#${tag}`)].join(' ');
+      popup.append(link, meta);
+      popup.hidden = false;
+      positionPopup();
+    }
+
+    function hidePopup() {
+      popupFeature = null;
+      popup.hidden = true;
+    }
+
+    function render() {
+      renderTiles();
+      renderMarkers();
+      positionPopup();
+    }
+
+    let fetchTimer = null;
+    let fetchController = null;
+    function fetchFeatures() {
+      const o = origin();
+      const padX = el.clientWidth / 2;
+      const padY = el.clientHeight / 2;
+      const nw = unproject(o.x - padX, o.y - padY, zoom);
+      const se = unproject(o.x + el.clientWidth + padX, o.y + el.clientHeight + padY, zoom);
+      const clampLng = (lng) => Math.min(Math.max(lng, -180), 180);
+      const bbox = [clampLng(nw.lng), se.lat, clampLng(se.lng), nw.lat].map((v) => v.toFixed(6)).join(',');
+      const url = new URL(el.dataset.source, window.location.origin);
+      url.searchParams.set('bbox', bbox);
+      if (fetchController) {
+        fetchController.abort();
+      }
+      fetchController = new AbortController();
+      fetch(url, { signal: fetchController.signal, credentials: 'same-origin' })
+        .then((res) => (res.ok ? res.json() : Promise.reject(new Error(String(res.status)))))
+        .then((data) => {
+          features = data.features || [];
+          renderMarkers();
+        })
+        .catch(() => {});
+    }
+    function scheduleFetch() {
+      clearTimeout(fetchTimer);
+      fetchTimer = setTimeout(fetchFeatures, 200);
+    }
+
+    // zoomAt changes the zoom level keeping the point at screen (sx, sy) fixed.
+    function zoomAt(sx, sy, nextZoom) {
+      const target = Math.min(Math.max(nextZoom, minZoom), maxZoom);
+      if (target === zoom) {
+        return;
+      }
+      const o = origin();
+      const anchor = unproject(o.x + sx, o.y + sy, zoom);
+      const p = project(anchor.lat, anchor.lng, target);
+      center = { x: p.x - sx + el.clientWidth / 2, y: p.y - sy + el.clientHeight / 2 };
+      zoom = target;
+      render();
+      scheduleFetch();
+    }
+
+    let drag = null;
+    el.addEventListener('pointerdown', (event) => {
+      if (event.target.closest('button, a, .map-popup')) {
+        return;
+      }
+      drag = { x: event.clientX, y: event.clientY, cx: center.x, cy: center.y, moved: false };
+      el.setPointerCapture(event.pointerId);
+    });
+    el.addEventListener('pointermove', (event) => {
+      if (!drag) {
+        return;
+      }
+      const dx = event.clientX - drag.x;
+      const dy = event.clientY - drag.y;
+      if (Math.abs(dx) + Math.abs(dy) > 3) {
+        drag.moved = true;
+      }
+      center = { x: drag.cx - dx, y: drag.cy - dy };
+      render();
+    });
+    const endDrag = () => {
+      if (!drag) {
+        return;
+      }
+      if (!drag.moved) {
+        hidePopup();
+      }
+      drag = null;
+      scheduleFetch();
+    };
+    el.addEventListener('pointerup', endDrag);
+    el.addEventListener('pointercancel', endDrag);
+
+    let lastWheel = 0;
+    el.addEventListener('wheel', (event) => {
+      event.preventDefault();
+      const now = Date.now();
+      if (now - lastWheel < 250) {
+        return;
+      }
+      lastWheel = now;
+      const rect = el.getBoundingClientRect();
+      zoomAt(event.clientX - rect.left, event.clientY - rect.top, zoom + (event.deltaY < 0 ? 1 : -1));
+    }, { passive: false });
+    el.addEventListener('dblclick', (event) => {
+      if (event.target.closest('button, a, .map-popup')) {
+        return;
+      }
+      const rect = el.getBoundingClientRect();
+      zoomAt(event.clientX - rect.left, event.clientY - rect.top, zoom + 1);
+    });
+    el.querySelector('.js-map-zoom-in').addEventListener('click', () => zoomAt(el.clientWidth / 2, el.clientHeight / 2, zoom + 1));
+    el.querySelector('.js-map-zoom-out').addEventListener('click', () => zoomAt(el.clientWidth / 2, el.clientHeight / 2, zoom - 1));
+    window.addEventListener('resize', render);
+
+    render();
+    fetchFeatures();
+  }
+
+  function bindGeolocate() {
+    const form = document.querySelector('.js-geolocate');
+    if (!form || !navigator.geolocation) {
+      return;
+    }
+    form.hidden = false;
+    const button = form.querySelector('button');
+    form.addEventListener('submit', (event) => {
+      if (form.elements.latitude.value && form.elements.longitude.value) {
+        return;
+      }
+      event.preventDefault();
+      button.disabled = true;
+      navigator.geolocation.getCurrentPosition((position) => {
+        form.elements.latitude.value = position.coords.latitude.toFixed(6);
+        form.elements.longitude.value = position.coords.longitude.toFixed(6);
+        form.submit();
+      }, () => {
+        button.disabled = false;
+        window.alert('現在地を取得できませんでした。');
+      }, { enableHighAccuracy: false, timeout: 10000, maximumAge: 60000 });
+    });
+  }
+
+  // Group lunch: the page listens to the session's event stream and redraws
+  // the counts; votes are posted in the background so the page stays put.
+  function bindLunch() {
+    const panel = document.querySelector('[data-lunch-events]');
+    if (!panel || !window.EventSource) {
+      return;
+    }
+    const userID = Number(panel.dataset.userId);
+    let closed = false;
+
+    const render = (state) => {
+      const names = state.participants.map((voter) => voter.username);
+      const participants = panel.querySelector('.js-lunch-participants');
+      if (participants) {
+        participants.textContent = names.join('、');
+      }
+      state.candidates.forEach((candidate) => {
+        const item = document.querySelector(`.lunch-candidate[data-restaurant-id="${candidate.restaurant_id}"]`);
+        if (!item) {
+          return;
+        }
+        item.querySelector('.js-lunch-votes').textContent = candidate.votes.length;
+        item.querySelector('.js-lunch-vetoes').textContent = candidate.vetoes.length;
+        item.querySelector('.js-lunch-voters').textContent = candidate.votes.map((voter) => voter.username).join('、');
+        const mine = {
+          vote: candidate.votes.some((voter) => voter.user_id === userID),
+          veto: candidate.vetoes.some((voter) => voter.user_id === userID),
+        };
+        item.querySelectorAll('.js-lunch-vote').forEach((form) => {
+          form.querySelector('button').classList.toggle('selected', mine[form.elements.value.value]);
+        });
+      });
+      if (state.closed && !closed) {
+        closed = true;
+        window.location.reload();
+      }
+    };
+
+    const source = new EventSource(panel.dataset.lunchEvents);
+    source.addEventListener('state', (event) => {
+      render(JSON.parse(event.data));
+    });
+
+    document.querySelectorAll('.js-lunch-vote').forEach((form) => {
+      form.addEventListener('submit', (event) => {
+        event.preventDefault();
+        fetch(form.action, {
+          method: 'POST',
+          body: new URLSearchParams(new FormData(form)),
+          headers: { Accept: 'application/json' },
+          credentials: 'same-origin',
+        }).then((response) => {
+          if (!response.ok) {
+            throw new Error(response.statusText);
+          }
+          return response.json();
+        }).then(render).catch(() => {
+          window.location.reload();
+        });
+      });
+    });
+  }
+
+  // Lunch train board: redrawn from the board's event stream, and trains are
+  // dropped here once they expire since the server does not announce that.
+  function bindTrainBoard() {
+    const board = document.querySelector('.js-train-board');
+    if (!board) {
+      return;
+    }
+    const userID = Number(board.dataset.userId || 0);
+    const csrf = board.dataset.csrf || '';
+    const expiryMs = Number(board.dataset.expiryMinutes) * 60 * 1000;
+    const empty = board.querySelector('.js-train-empty');
+
+    const actionForm = (train, action, label, className) => {
+      const form = document.createElement('form');
+      form.method = 'post';
+      form.action = `/trains/${train.id}/${action}`;
+      const token = document.createElement('input');
+      token.type = 'hidden';
+      token.name = 'csrf_token';
+      token.value = csrf;
+      const button = document.createElement('button');
+      button.type = 'submit';
+      button.textContent = label;
+      if (className) {
+        button.className = className;
+      }
+      form.append(token, button);
+      return form;
+    };
+
+    const renderTrain = (train) => {
+      const departs = new Date(train.departs_at);
+      const item = document.createElement('li');
+      item.className = 'train';
+      item.dataset.trainId = train.id;
+      item.dataset.expiresAt = new Date(departs.getTime() + expiryMs).toISOString();
+
+      const body = document.createElement('div');
+      const time = document.createElement('strong');
+      time.className = 'train-departs';
+      time.textContent = `${String(departs.getHours()).padStart(2, '0')}:${String(departs.getMinutes()).padStart(2, '0')}`;
+      const link = document.createElement('a');
+      link.href = `/restaurants/${train.restaurant_id}`;
+      link.textContent = train.restaurant_name;
+      body.append(time, ' ', link);
+      if (train.note) {
+        const note = document.createElement('span');
+        note.className = 'muted';
+        note.textContent = train.note;
+        body.append(' ', note);
+      }
+      const riders = document.createElement('div');
+      riders.className = 'muted';
+      riders.textContent = `${train.riders.map((rider) => rider.username).join('、')}（${train.riders.length}人）`;
+      body.append(riders);
+      item.append(body);
+
+      if (userID && csrf) {
+        if (train.created_by === userID) {
+          item.append(actionForm(train, 'cancel', '取り消す', 'btn danger'));
+        } else if (train.riders.some((rider) => rider.user_id === userID)) {
+          item.append(actionForm(train, 'leave', 'やめる'));
+        } else {
+          item.append(actionForm(train, 'join', '乗る'));
+        }
+      }
+      return item;
+    };
+
+    const dropExpired = () => {
+      const now = Date.now();
+      board.querySelectorAll('.train').forEach((item) => {
+        if (Date.parse(item.dataset.expiresAt) <= now) {
+          item.remove();
+        }
+      });
+      if (empty) {
+        empty.hidden = board.querySelector('.train') !== null;
+      }
+    };
+
+    if (window.EventSource) {
+      const source = new EventSource(board.dataset.events);
+      source.addEventListener('trains', (event) => {
+        const state = JSON.parse(event.data);
+        board.querySelectorAll('.train').forEach((item) => item.remove());
+        state.trains.forEach((train) => {
+          board.insertBefore(renderTrain(train), empty);
+        });
+        dropExpired();
+      });
+    }
+    window.setInterval(dropExpired, 30000);
+  }
+
   document.addEventListener('DOMContentLoaded', () => {
     bindDropzones();
     bindPhotoRemoveButtons();
+    bindPhotoArrange();
+    bindMap();
+    bindGeolocate();
+    bindLunch();
+    bindTrainBoard();
   });
 })();